@@ -0,0 +1,776 @@
+package asch
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"sync"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+const (
+	defaultBlockSize = 64 << 20 // 64 MiB
+	smallHeapLimit   = 1 << 30  // heaps up to 1 GiB get blocks of 1/8 of their size
+	minAllocation    = 256      // smallest buddy node
+)
+
+// Allocator sub-allocates buffers and images from large vk.DeviceMemory blocks, so the
+// application stays far below maxMemoryAllocationCount. Blocks are kept per memory type
+// and carved up by a buddy allocator; large resources get dedicated allocations.
+// Linear (buffers) and optimal (images) resources live in separate blocks whenever
+// bufferImageGranularity is larger than the smallest buddy node.
+type Allocator struct {
+	mu            sync.Mutex
+	device        vk.Device
+	gpu           vk.PhysicalDevice
+	memProperties vk.PhysicalDeviceMemoryProperties
+	granularity   vk.DeviceSize
+	atomSize      vk.DeviceSize      // nonCoherentAtomSize
+	deviceAddress bool               // memory is allocated with the device address flag
+	blocks        [32][]*memoryBlock // default pool, per memory type
+	dedicated     [32]int            // live dedicated allocations per memory type
+	dedicatedSize [32]vk.DeviceSize
+	pools         []*Pool
+
+	budget budgetTracker
+}
+
+// Pool is a custom pool with its own blocks of a single memory type.
+type Pool struct {
+	allocator  *Allocator
+	memoryType uint32
+	blockSize  vk.DeviceSize
+	maxBlocks  int
+	blocks     []*memoryBlock
+}
+
+// PoolCreateInfo describes a custom pool, zero BlockSize picks the default
+// and zero MaxBlocks means no limit.
+type PoolCreateInfo struct {
+	MemoryTypeIndex uint32
+	BlockSize       vk.DeviceSize
+	MaxBlocks       int
+}
+
+// AllocationCreateInfo tells the allocator where a resource should live.
+type AllocationCreateInfo struct {
+	Intent MemoryIntent
+	// Dedicated forces a vk.DeviceMemory of its own for the resource.
+	Dedicated bool
+	// Pool allocates from a custom pool instead of the default blocks.
+	Pool *Pool
+}
+
+// Allocation is a range of device memory handed out by the Allocator.
+type Allocation struct {
+	allocator  *Allocator
+	block      *memoryBlock // nil for dedicated allocations
+	Memory     vk.DeviceMemory
+	Offset     vk.DeviceSize
+	Size       vk.DeviceSize
+	MemoryType uint32
+	Flags      vk.MemoryPropertyFlags
+	mapped     bool
+	dedicated  unsafe.Pointer // mapping of a dedicated allocation
+}
+
+type resourceKind int
+
+const (
+	kindLinear resourceKind = iota
+	kindOptimal
+)
+
+type memoryBlock struct {
+	memory      vk.DeviceMemory
+	memoryType  uint32
+	size        vk.DeviceSize
+	kind        resourceKind
+	buddy       buddy
+	used        vk.DeviceSize
+	allocations int
+	mapped      unsafe.Pointer
+	mapCount    int
+}
+
+func NewAllocator(device vk.Device, gpu vk.PhysicalDevice) (*Allocator, error) {
+	var gpuProperties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(gpu, &gpuProperties)
+	gpuProperties.Deref()
+	gpuProperties.Limits.Deref()
+	a := &Allocator{
+		device:        device,
+		gpu:           gpu,
+		memProperties: getMemoryProperties(gpu),
+		granularity:   max(gpuProperties.Limits.BufferImageGranularity, 1),
+		atomSize:      max(gpuProperties.Limits.NonCoherentAtomSize, 1),
+	}
+	gpuProperties.Free()
+	if a.memProperties.MemoryTypeCount == 0 {
+		return nil, fmt.Errorf("NewAllocator: device reports no memory types")
+	}
+	a.budget.init(gpu, a.memProperties)
+	return a, nil
+}
+
+// EnableDeviceAddress allocates all further memory with vk.MemoryAllocateDeviceAddressBit,
+// so buffers with vk.BufferUsageShaderDeviceAddressBit can be placed anywhere. The device
+// must have been created with the bufferDeviceAddress feature, see DeviceFeatures.
+func (a *Allocator) EnableDeviceAddress() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deviceAddress = true
+}
+
+// DeviceAddress reports whether EnableDeviceAddress was called.
+func (a *Allocator) DeviceAddress() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.deviceAddress
+}
+
+// MemoryProperties returns the memory types and heaps of the device.
+func (a *Allocator) MemoryProperties() vk.PhysicalDeviceMemoryProperties {
+	return a.memProperties
+}
+
+// FindMemoryType picks the memory type for the intent among the allowed typeBits.
+func (a *Allocator) FindMemoryType(typeBits uint32, intent MemoryIntent) (uint32, error) {
+	required, preferred := intent.properties()
+	return findMemoryType(&a.memProperties, typeBits, required, preferred)
+}
+
+func (a *Allocator) NewPool(info PoolCreateInfo) (*Pool, error) {
+	if info.MemoryTypeIndex >= a.memProperties.MemoryTypeCount {
+		return nil, fmt.Errorf("NewPool: memory type %d does not exist", info.MemoryTypeIndex)
+	}
+	blockSize := info.BlockSize
+	if blockSize == 0 {
+		blockSize = a.blockSize(info.MemoryTypeIndex)
+	}
+	p := &Pool{
+		allocator:  a,
+		memoryType: info.MemoryTypeIndex,
+		blockSize:  ceilPow2(max(blockSize, minAllocation)),
+		maxBlocks:  info.MaxBlocks,
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pools = append(a.pools, p)
+	return p, nil
+}
+
+// Destroy frees the pool blocks, all of its allocations must have been freed.
+func (p *Pool) Destroy() {
+	a := p.allocator
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, block := range p.blocks {
+		if block.allocations > 0 {
+			slog.Warn(fmt.Sprintf("Pool.Destroy: block still holds %d allocations", block.allocations))
+		}
+		a.freeBlock(block)
+	}
+	p.blocks = nil
+	for i := range a.pools {
+		if a.pools[i] == p {
+			a.pools = append(a.pools[:i], a.pools[i+1:]...)
+			break
+		}
+	}
+}
+
+// AllocateForBuffer allocates and binds memory for the buffer.
+func (a *Allocator) AllocateForBuffer(buffer vk.Buffer, info AllocationCreateInfo) (*Allocation, error) {
+	var memReq vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(a.device, buffer, &memReq)
+	memReq.Deref()
+	allocation, err := a.allocate(memReq, kindLinear, info)
+	if err != nil {
+		return nil, err
+	}
+	err = vk.Error(vk.BindBufferMemory(a.device, buffer, allocation.Memory, allocation.Offset))
+	if err != nil {
+		allocation.Free()
+		err = fmt.Errorf("vk.BindBufferMemory failed with %s", err)
+		return nil, err
+	}
+	return allocation, nil
+}
+
+// AllocateForImage allocates and binds memory for an image with optimal tiling.
+func (a *Allocator) AllocateForImage(image vk.Image, info AllocationCreateInfo) (*Allocation, error) {
+	var memReq vk.MemoryRequirements
+	vk.GetImageMemoryRequirements(a.device, image, &memReq)
+	memReq.Deref()
+	allocation, err := a.allocate(memReq, kindOptimal, info)
+	if err != nil {
+		return nil, err
+	}
+	err = vk.Error(vk.BindImageMemory(a.device, image, allocation.Memory, allocation.Offset))
+	if err != nil {
+		allocation.Free()
+		err = fmt.Errorf("vk.BindImageMemory failed with %s", err)
+		return nil, err
+	}
+	return allocation, nil
+}
+
+func (a *Allocator) allocate(memReq vk.MemoryRequirements, kind resourceKind, info AllocationCreateInfo) (*Allocation, error) {
+	memoryType, err := a.FindMemoryType(memReq.MemoryTypeBits, info.Intent)
+	if info.Pool != nil {
+		memoryType, err = info.Pool.memoryType, nil
+		if memReq.MemoryTypeBits&(1<<memoryType) == 0 {
+			err = fmt.Errorf("allocate: resource cannot live in memory type %d of the pool", memoryType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.memProperties.MemoryTypes[memoryType].PropertyFlags&hostNonCoherent == vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit) {
+		// whole atoms, so flushing or invalidating never touches a neighbouring allocation
+		memReq.Alignment = max(memReq.Alignment, a.atomSize)
+		memReq.Size = alignUp(memReq.Size, a.atomSize)
+	}
+	if a.granularity <= minAllocation {
+		// node boundaries are page boundaries, linear and optimal resources can share blocks
+		kind = kindLinear
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	blockSize := a.blockSize(memoryType)
+	if info.Pool != nil {
+		blockSize = info.Pool.blockSize
+	}
+	if info.Dedicated || (info.Pool == nil && memReq.Size > blockSize/2) {
+		return a.allocateDedicated(memReq.Size, memoryType)
+	}
+	if memReq.Size > blockSize {
+		return nil, fmt.Errorf("allocate: %d bytes do not fit into pool blocks of %d bytes", memReq.Size, blockSize)
+	}
+
+	blocks := &a.blocks[memoryType]
+	maxBlocks := 0
+	if info.Pool != nil {
+		blocks = &info.Pool.blocks
+		maxBlocks = info.Pool.maxBlocks
+	}
+	for _, block := range *blocks {
+		if block.kind != kind {
+			continue
+		}
+		if allocation, ok := a.allocateFromBlock(block, memReq); ok {
+			return allocation, nil
+		}
+	}
+	if maxBlocks > 0 && len(*blocks) >= maxBlocks {
+		return nil, fmt.Errorf("allocate: pool is full with %d blocks", len(*blocks))
+	}
+	block, err := a.newBlock(memoryType, blockSize, kind)
+	if err != nil {
+		return nil, err
+	}
+	*blocks = append(*blocks, block)
+	allocation, _ := a.allocateFromBlock(block, memReq)
+	return allocation, nil
+}
+
+func (a *Allocator) allocateFromBlock(block *memoryBlock, memReq vk.MemoryRequirements) (*Allocation, bool) {
+	offset, ok := block.buddy.alloc(memReq.Size, memReq.Alignment)
+	if !ok {
+		return nil, false
+	}
+	block.used += memReq.Size
+	block.allocations++
+	return &Allocation{
+		allocator:  a,
+		block:      block,
+		Memory:     block.memory,
+		Offset:     offset,
+		Size:       memReq.Size,
+		MemoryType: block.memoryType,
+		Flags:      a.memProperties.MemoryTypes[block.memoryType].PropertyFlags,
+	}, true
+}
+
+func (a *Allocator) allocateDedicated(size vk.DeviceSize, memoryType uint32) (*Allocation, error) {
+	memory, err := a.allocateMemory(size, memoryType)
+	if err != nil {
+		return nil, err
+	}
+	a.dedicated[memoryType]++
+	a.dedicatedSize[memoryType] += size
+	return &Allocation{
+		allocator:  a,
+		Memory:     memory,
+		Size:       size,
+		MemoryType: memoryType,
+		Flags:      a.memProperties.MemoryTypes[memoryType].PropertyFlags,
+	}, nil
+}
+
+func (a *Allocator) newBlock(memoryType uint32, size vk.DeviceSize, kind resourceKind) (*memoryBlock, error) {
+	memory, err := a.allocateMemory(size, memoryType)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryBlock{
+		memory:     memory,
+		memoryType: memoryType,
+		size:       size,
+		kind:       kind,
+		buddy:      newBuddy(size, minAllocation),
+	}, nil
+}
+
+func (a *Allocator) allocateMemory(size vk.DeviceSize, memoryType uint32) (vk.DeviceMemory, error) {
+	allocInfo := vk.MemoryAllocateInfo{
+		SType:           vk.StructureTypeMemoryAllocateInfo,
+		AllocationSize:  size,
+		MemoryTypeIndex: memoryType,
+	}
+	if a.deviceAddress {
+		flagsInfo := vk.MemoryAllocateFlagsInfo{
+			SType: vk.StructureTypeMemoryAllocateFlagsInfo,
+			Flags: vk.MemoryAllocateFlags(vk.MemoryAllocateDeviceAddressBit),
+		}
+		ref, _ := flagsInfo.PassRef()
+		allocInfo.PNext = unsafe.Pointer(ref)
+		defer flagsInfo.Free()
+	}
+	heap := a.memProperties.MemoryTypes[memoryType].HeapIndex
+	var memory vk.DeviceMemory
+	err := vk.Error(vk.AllocateMemory(a.device, &allocInfo, nil, &memory))
+	if err != nil {
+		b := a.budget.heap(heap)
+		err = fmt.Errorf("vk.AllocateMemory of %d bytes in memory type %d failed with %w (heap %d: %d of %d budget bytes used)",
+			size, memoryType, err, heap, b.Usage, b.Budget)
+		return vk.NullDeviceMemory, err
+	}
+	a.budget.allocated(heap, size)
+	return memory, nil
+}
+
+func (a *Allocator) freeMemory(memory vk.DeviceMemory, size vk.DeviceSize, memoryType uint32) {
+	vk.FreeMemory(a.device, memory, nil)
+	a.budget.freed(a.memProperties.MemoryTypes[memoryType].HeapIndex, size)
+}
+
+func (a *Allocator) freeBlock(block *memoryBlock) {
+	if block.mapped != nil {
+		vk.UnmapMemory(a.device, block.memory)
+		block.mapped = nil
+	}
+	a.freeMemory(block.memory, block.size, block.memoryType)
+}
+
+// blockSize follows VMA: 64 MiB blocks, or 1/8 of heaps up to 1 GiB.
+func (a *Allocator) blockSize(memoryType uint32) vk.DeviceSize {
+	heap := a.memProperties.MemoryHeaps[a.memProperties.MemoryTypes[memoryType].HeapIndex]
+	if heap.Size <= smallHeapLimit {
+		return ceilPow2(max(heap.Size/8, minAllocation))
+	}
+	return defaultBlockSize
+}
+
+// Free returns the memory to the allocator.
+func (al *Allocation) Free() {
+	if al == nil || al.allocator == nil {
+		return
+	}
+	a := al.allocator
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	al.unmapLocked()
+	if al.block == nil {
+		a.freeMemory(al.Memory, al.Size, al.MemoryType)
+		a.dedicated[al.MemoryType]--
+		a.dedicatedSize[al.MemoryType] -= al.Size
+	} else {
+		block := al.block
+		block.buddy.release(al.Offset)
+		block.used -= al.Size
+		block.allocations--
+		if block.allocations == 0 {
+			a.releaseEmptyBlock(block)
+		}
+	}
+	al.allocator = nil
+	al.block = nil
+}
+
+// releaseEmptyBlock frees an empty block unless it is the last one of its list.
+func (a *Allocator) releaseEmptyBlock(block *memoryBlock) {
+	lists := []*[]*memoryBlock{&a.blocks[block.memoryType]}
+	for _, p := range a.pools {
+		lists = append(lists, &p.blocks)
+	}
+	for _, blocks := range lists {
+		for i, b := range *blocks {
+			if b != block {
+				continue
+			}
+			if len(*blocks) > 1 {
+				a.freeBlock(block)
+				*blocks = append((*blocks)[:i], (*blocks)[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// Map returns the allocation range of host visible memory as a byte slice.
+// Blocks stay mapped while any of their allocations is mapped.
+func (al *Allocation) Map() ([]byte, error) {
+	if al == nil || al.allocator == nil {
+		return nil, errAllocationFreed
+	}
+	al.allocator.mu.Lock()
+	defer al.allocator.mu.Unlock()
+	return al.mapLocked()
+}
+
+// errAllocationFreed is returned when mapping an allocation after Free.
+var errAllocationFreed = errors.New("allocation was freed")
+
+func (al *Allocation) mapLocked() ([]byte, error) {
+	if al.Flags&vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit) == 0 {
+		return nil, fmt.Errorf("Allocation.Map: memory type %d is not host visible", al.MemoryType)
+	}
+	a := al.allocator
+	if al.block == nil {
+		if al.dedicated == nil {
+			err := vk.Error(vk.MapMemory(a.device, al.Memory, 0, al.Size, 0, &al.dedicated))
+			if err != nil {
+				err = fmt.Errorf("vk.MapMemory failed with %s", err)
+				return nil, err
+			}
+		}
+		al.mapped = true
+		return unsafe.Slice((*byte)(al.dedicated), al.Size), nil
+	}
+	block := al.block
+	if block.mapped == nil {
+		err := vk.Error(vk.MapMemory(a.device, block.memory, 0, block.size, 0, &block.mapped))
+		if err != nil {
+			err = fmt.Errorf("vk.MapMemory failed with %s", err)
+			return nil, err
+		}
+	}
+	if !al.mapped {
+		block.mapCount++
+		al.mapped = true
+	}
+	return unsafe.Slice((*byte)(unsafe.Add(block.mapped, al.Offset)), al.Size), nil
+}
+
+func (al *Allocation) Unmap() {
+	if al == nil || al.allocator == nil {
+		return
+	}
+	al.allocator.mu.Lock()
+	defer al.allocator.mu.Unlock()
+	al.unmapLocked()
+}
+
+func (al *Allocation) unmapLocked() {
+	if !al.mapped {
+		return
+	}
+	al.mapped = false
+	if al.block == nil {
+		vk.UnmapMemory(al.allocator.device, al.Memory)
+		al.dedicated = nil
+		return
+	}
+	al.block.mapCount--
+	if al.block.mapCount == 0 {
+		vk.UnmapMemory(al.allocator.device, al.block.memory)
+		al.block.mapped = nil
+	}
+}
+
+// hostNonCoherent masks the flags telling host visible memory without coherency.
+const hostNonCoherent = vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCoherentBit)
+
+// Coherent reports whether host writes and GPU writes are visible without Flush and Invalidate.
+func (al *Allocation) Coherent() bool {
+	return al.Flags&vk.MemoryPropertyFlags(vk.MemoryPropertyHostCoherentBit) != 0
+}
+
+// Flush makes host writes to the mapped range visible to the device. Offset and size are
+// relative to the allocation, vk.WholeSize reaches its end. A no-op on coherent memory.
+func (al *Allocation) Flush(offset, size vk.DeviceSize) error {
+	return al.mappedRange("vk.FlushMappedMemoryRanges", offset, size, vk.FlushMappedMemoryRanges)
+}
+
+// Invalidate makes device writes to the mapped range visible to the host.
+// A no-op on coherent memory.
+func (al *Allocation) Invalidate(offset, size vk.DeviceSize) error {
+	return al.mappedRange("vk.InvalidateMappedMemoryRanges", offset, size, vk.InvalidateMappedMemoryRanges)
+}
+
+func (al *Allocation) mappedRange(name string, offset, size vk.DeviceSize,
+	call func(vk.Device, uint32, []vk.MappedMemoryRange) vk.Result) error {
+	if al.Coherent() {
+		return nil
+	}
+	if al.allocator == nil {
+		return fmt.Errorf("%s: %w", name, errAllocationFreed)
+	}
+	al.allocator.mu.Lock()
+	defer al.allocator.mu.Unlock()
+	return al.mappedRangeLocked(name, offset, size, call)
+}
+
+// access maps the allocation for the duration of fn unless it is mapped already. The
+// allocator lock is held meanwhile, so fn flushes and invalidates with mappedRangeLocked.
+func (al *Allocation) access(fn func(mem []byte) error) error {
+	if al == nil || al.allocator == nil {
+		return errAllocationFreed
+	}
+	al.allocator.mu.Lock()
+	defer al.allocator.mu.Unlock()
+	wasMapped := al.mapped
+	mem, err := al.mapLocked()
+	if err != nil {
+		return err
+	}
+	err = fn(mem)
+	if !wasMapped {
+		al.unmapLocked()
+	}
+	return err
+}
+
+func (al *Allocation) mappedRangeLocked(name string, offset, size vk.DeviceSize,
+	call func(vk.Device, uint32, []vk.MappedMemoryRange) vk.Result) error {
+	if al.Coherent() {
+		return nil
+	}
+	a := al.allocator
+	if !al.mapped {
+		return fmt.Errorf("%s: allocation is not mapped", name)
+	}
+	if size == vk.DeviceSize(vk.WholeSize) || offset+size > al.Size {
+		size = al.Size - min(offset, al.Size)
+	}
+	if size == 0 {
+		return nil
+	}
+
+	// round out to whole atoms, but never past the end of the memory object
+	memorySize := al.Size
+	if al.block != nil {
+		memorySize = al.block.size
+	}
+	start := (al.Offset + offset) / a.atomSize * a.atomSize
+	end := min(alignUp(al.Offset+offset+size, a.atomSize), memorySize)
+	ranges := []vk.MappedMemoryRange{{
+		SType:  vk.StructureTypeMappedMemoryRange,
+		Memory: al.Memory,
+		Offset: start,
+		Size:   end - start,
+	}}
+	err := vk.Error(call(a.device, 1, ranges))
+	if err != nil {
+		err = fmt.Errorf("%s failed with %s", name, err)
+		return err
+	}
+	return nil
+}
+
+// HeapStats describes the allocator usage of one memory heap.
+type HeapStats struct {
+	Heap        uint32
+	Size        vk.DeviceSize // size of the heap
+	DeviceLocal bool
+
+	Blocks      int
+	Dedicated   int           // dedicated allocations
+	BlockBytes  vk.DeviceSize // bytes allocated from the driver, dedicated allocations included
+	Allocations int           // live allocations, dedicated included
+	UsedBytes   vk.DeviceSize // bytes of the live allocations
+
+	FreeBytes        vk.DeviceSize // unallocated bytes inside blocks
+	LargestFreeRange vk.DeviceSize
+	// Fragmentation is 0 when the free space of every block is one range,
+	// and approaches 1 as it is split into many small ones.
+	Fragmentation float64
+}
+
+// Stats returns the usage of every memory heap.
+func (a *Allocator) Stats() []HeapStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := make([]HeapStats, a.memProperties.MemoryHeapCount)
+	largestPerBlock := make([]vk.DeviceSize, len(stats))
+	for i := range stats {
+		heap := a.memProperties.MemoryHeaps[i]
+		stats[i].Heap = uint32(i)
+		stats[i].Size = heap.Size
+		stats[i].DeviceLocal = heap.Flags&vk.MemoryHeapFlags(vk.MemoryHeapDeviceLocalBit) != 0
+	}
+	addBlock := func(block *memoryBlock) {
+		h := a.memProperties.MemoryTypes[block.memoryType].HeapIndex
+		s := &stats[h]
+		s.Blocks++
+		s.BlockBytes += block.size
+		s.Allocations += block.allocations
+		s.UsedBytes += block.used
+		free, largest := block.buddy.freeBytes(), block.buddy.largestFree()
+		s.FreeBytes += free
+		s.LargestFreeRange = max(s.LargestFreeRange, largest)
+		largestPerBlock[h] += largest
+	}
+	for t := range a.blocks {
+		for _, block := range a.blocks[t] {
+			addBlock(block)
+		}
+		if a.dedicated[t] > 0 {
+			s := &stats[a.memProperties.MemoryTypes[t].HeapIndex]
+			s.Dedicated += a.dedicated[t]
+			s.Allocations += a.dedicated[t]
+			s.BlockBytes += a.dedicatedSize[t]
+			s.UsedBytes += a.dedicatedSize[t]
+		}
+	}
+	for _, p := range a.pools {
+		for _, block := range p.blocks {
+			addBlock(block)
+		}
+	}
+	for i := range stats {
+		if stats[i].FreeBytes > 0 {
+			stats[i].Fragmentation = 1 - float64(largestPerBlock[i])/float64(stats[i].FreeBytes)
+		}
+	}
+	return stats
+}
+
+// Destroy frees every block. Live allocations become invalid.
+func (a *Allocator) Destroy() {
+	for len(a.pools) > 0 {
+		a.pools[0].Destroy()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for t := range a.blocks {
+		for _, block := range a.blocks[t] {
+			a.freeBlock(block)
+		}
+		a.blocks[t] = nil
+		if a.dedicated[t] > 0 {
+			slog.Warn(fmt.Sprintf("Allocator.Destroy: %d dedicated allocations of memory type %d leaked", a.dedicated[t], t))
+		}
+	}
+}
+
+// buddy is a binary buddy allocator over a power of two sized range. Nodes are
+// aligned to their own size, which covers every power of two alignment up to it.
+type buddy struct {
+	size    vk.DeviceSize
+	minSize vk.DeviceSize
+	free    []map[vk.DeviceSize]struct{} // free node offsets per level, level 0 is the whole range
+	taken   map[vk.DeviceSize]int        // offset of allocated nodes to their level
+}
+
+func newBuddy(size, minSize vk.DeviceSize) buddy {
+	levels := bits.Len64(uint64(size / minSize)) // size/minSize is a power of two
+	b := buddy{
+		size:    size,
+		minSize: minSize,
+		free:    make([]map[vk.DeviceSize]struct{}, levels),
+		taken:   make(map[vk.DeviceSize]int),
+	}
+	for i := range b.free {
+		b.free[i] = make(map[vk.DeviceSize]struct{})
+	}
+	b.free[0][0] = struct{}{}
+	return b
+}
+
+func (b *buddy) nodeSize(level int) vk.DeviceSize {
+	return b.size >> level
+}
+
+func (b *buddy) alloc(size, alignment vk.DeviceSize) (vk.DeviceSize, bool) {
+	need := ceilPow2(max(size, alignment, b.minSize))
+	if need > b.size {
+		return 0, false
+	}
+	level := bits.Len64(uint64(b.size/need)) - 1
+	l := level
+	for l >= 0 && len(b.free[l]) == 0 {
+		l--
+	}
+	if l < 0 {
+		return 0, false
+	}
+	offset := lowestOffset(b.free[l])
+	delete(b.free[l], offset)
+	for ; l < level; l++ {
+		// split, keep the lower half and free the upper one
+		b.free[l+1][offset+b.nodeSize(l+1)] = struct{}{}
+	}
+	b.taken[offset] = level
+	return offset, true
+}
+
+func (b *buddy) release(offset vk.DeviceSize) {
+	level, ok := b.taken[offset]
+	if !ok {
+		return
+	}
+	delete(b.taken, offset)
+	for level > 0 {
+		buddyOffset := offset ^ b.nodeSize(level)
+		if _, free := b.free[level][buddyOffset]; !free {
+			break
+		}
+		delete(b.free[level], buddyOffset)
+		offset = min(offset, buddyOffset)
+		level--
+	}
+	b.free[level][offset] = struct{}{}
+}
+
+func (b *buddy) freeBytes() vk.DeviceSize {
+	var total vk.DeviceSize
+	for l := range b.free {
+		total += vk.DeviceSize(len(b.free[l])) * b.nodeSize(l)
+	}
+	return total
+}
+
+func (b *buddy) largestFree() vk.DeviceSize {
+	for l := range b.free {
+		if len(b.free[l]) > 0 {
+			return b.nodeSize(l)
+		}
+	}
+	return 0
+}
+
+// lowestOffset keeps allocations packed towards the start of a block.
+func lowestOffset(nodes map[vk.DeviceSize]struct{}) vk.DeviceSize {
+	first := true
+	var lowest vk.DeviceSize
+	for offset := range nodes {
+		if first || offset < lowest {
+			lowest, first = offset, false
+		}
+	}
+	return lowest
+}
+
+func ceilPow2(v vk.DeviceSize) vk.DeviceSize {
+	if v <= 1 {
+		return 1
+	}
+	return 1 << bits.Len64(uint64(v-1))
+}
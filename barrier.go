@@ -0,0 +1,437 @@
+package asch
+
+import (
+	"fmt"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// ResourceState describes a use of a resource: the pipeline stages and accesses of the
+// use and, for images, the layout it needs.
+type ResourceState struct {
+	Stages vk.PipelineStageFlags
+	Access vk.AccessFlags
+	Layout vk.ImageLayout
+}
+
+// Common uses of resources. Layout is ignored for buffers.
+var (
+	StateTransferSrc = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		Access: vk.AccessFlags(vk.AccessTransferReadBit),
+		Layout: vk.ImageLayoutTransferSrcOptimal,
+	}
+	StateTransferDst = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		Access: vk.AccessFlags(vk.AccessTransferWriteBit),
+		Layout: vk.ImageLayoutTransferDstOptimal,
+	}
+	StateShaderRead = ResourceState{
+		Stages: shaderStages,
+		Access: vk.AccessFlags(vk.AccessShaderReadBit),
+		Layout: vk.ImageLayoutShaderReadOnlyOptimal,
+	}
+	StateFragmentShaderRead = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+		Access: vk.AccessFlags(vk.AccessShaderReadBit),
+		Layout: vk.ImageLayoutShaderReadOnlyOptimal,
+	}
+	StateComputeShaderRead = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit),
+		Access: vk.AccessFlags(vk.AccessShaderReadBit),
+		Layout: vk.ImageLayoutShaderReadOnlyOptimal,
+	}
+	StateComputeShaderWrite = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit),
+		Access: vk.AccessFlags(vk.AccessShaderWriteBit),
+		Layout: vk.ImageLayoutGeneral,
+	}
+	StateComputeShaderReadWrite = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageComputeShaderBit),
+		Access: vk.AccessFlags(vk.AccessShaderReadBit | vk.AccessShaderWriteBit),
+		Layout: vk.ImageLayoutGeneral,
+	}
+	StateColorAttachment = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		Access: vk.AccessFlags(vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit),
+		Layout: vk.ImageLayoutColorAttachmentOptimal,
+	}
+	StateDepthAttachment = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageEarlyFragmentTestsBit | vk.PipelineStageLateFragmentTestsBit),
+		Access: vk.AccessFlags(vk.AccessDepthStencilAttachmentReadBit | vk.AccessDepthStencilAttachmentWriteBit),
+		Layout: vk.ImageLayoutDepthStencilAttachmentOptimal,
+	}
+	StatePresent = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit),
+		Layout: vk.ImageLayoutPresentSrc,
+	}
+	StateHostRead = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageHostBit),
+		Access: vk.AccessFlags(vk.AccessHostReadBit),
+		Layout: vk.ImageLayoutGeneral,
+	}
+	StateVertexBuffer = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageVertexInputBit),
+		Access: vk.AccessFlags(vk.AccessVertexAttributeReadBit),
+	}
+	StateIndexBuffer = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageVertexInputBit),
+		Access: vk.AccessFlags(vk.AccessIndexReadBit),
+	}
+	StateUniformBuffer = ResourceState{
+		Stages: shaderStages,
+		Access: vk.AccessFlags(vk.AccessUniformReadBit),
+	}
+	StateIndirectBuffer = ResourceState{
+		Stages: vk.PipelineStageFlags(vk.PipelineStageDrawIndirectBit),
+		Access: vk.AccessFlags(vk.AccessIndirectCommandReadBit),
+	}
+)
+
+// writeAccess are the Vulkan 1.0 accesses which write memory.
+const writeAccess = vk.AccessFlags(vk.AccessShaderWriteBit | vk.AccessColorAttachmentWriteBit |
+	vk.AccessDepthStencilAttachmentWriteBit | vk.AccessTransferWriteBit | vk.AccessHostWriteBit | vk.AccessMemoryWriteBit)
+
+// syncState is the tracked state of a buffer or of an image subresource.
+type syncState struct {
+	layout vk.ImageLayout
+	// owner is the queue family owning the resource, vk.QueueFamilyIgnored before first use
+	owner uint32
+	// releasedBy is the family which released the resource to owner, vk.QueueFamilyIgnored
+	// once acquired; the acquire repeats the transition from releasedLayout
+	releasedBy     uint32
+	releasedLayout vk.ImageLayout
+	// writeStages and writeAccess are the last write, or the last barrier when writeAccess is 0
+	writeStages vk.PipelineStageFlags
+	writeAccess vk.AccessFlags
+	// readStages and readAccess are the reads since, which the write is visible to
+	readStages vk.PipelineStageFlags
+	readAccess vk.AccessFlags
+}
+
+func newSyncState() syncState {
+	return syncState{owner: vk.QueueFamilyIgnored, releasedBy: vk.QueueFamilyIgnored}
+}
+
+// synced records state as reached through a barrier recorded on family.
+func (s *syncState) synced(state ResourceState, family uint32) {
+	*s = syncState{
+		layout:      state.Layout,
+		owner:       family,
+		releasedBy:  vk.QueueFamilyIgnored,
+		writeStages: state.Stages,
+		writeAccess: state.Access & writeAccess,
+		readStages:  state.Stages,
+		readAccess:  state.Access &^ writeAccess,
+	}
+}
+
+// barrierInfo is one barrier without the resource it applies to.
+type barrierInfo struct {
+	srcStages, dstStages vk.PipelineStageFlags
+	srcAccess, dstAccess vk.AccessFlags
+	oldLayout, newLayout vk.ImageLayout
+	srcFamily, dstFamily uint32
+}
+
+// transition moves s to state on family and returns the barrier needed, if any.
+// Discarded contents need neither their previous layout nor an ownership transfer.
+func (s *syncState) transition(state ResourceState, family uint32, discard bool) (barrierInfo, bool, error) {
+	b := barrierInfo{
+		dstStages: state.Stages,
+		dstAccess: state.Access,
+		oldLayout: s.layout,
+		newLayout: state.Layout,
+		srcFamily: vk.QueueFamilyIgnored,
+		dstFamily: vk.QueueFamilyIgnored,
+	}
+	if discard {
+		b.oldLayout = vk.ImageLayoutUndefined
+	}
+
+	switch {
+	case s.releasedBy != vk.QueueFamilyIgnored && !discard:
+		// acquire, repeating the layout transition of the release
+		if s.owner != family {
+			return b, false, fmt.Errorf("released to queue family %d, used on %d", s.owner, family)
+		}
+		if s.layout != state.Layout {
+			return b, false, fmt.Errorf("released in layout %d, used in layout %d", s.layout, state.Layout)
+		}
+		b.srcFamily, b.dstFamily = s.releasedBy, family
+		b.oldLayout = s.releasedLayout
+		s.synced(state, family)
+		return b, true, nil
+	case s.owner != vk.QueueFamilyIgnored && s.owner != family && !discard:
+		return b, false, fmt.Errorf("owned by queue family %d, release it before use on %d", s.owner, family)
+	}
+
+	if state.Access&writeAccess == 0 && b.oldLayout == b.newLayout && (s.owner == family || s.owner == vk.QueueFamilyIgnored) {
+		// reads only wait for the last write, and only once per stage and access
+		s.owner = family
+		covered := s.readStages&state.Stages == state.Stages && s.readAccess&state.Access == state.Access
+		s.readStages |= state.Stages
+		s.readAccess |= state.Access
+		if s.writeStages == 0 || covered {
+			return b, false, nil
+		}
+		b.srcStages, b.srcAccess = s.writeStages, s.writeAccess
+		return b, true, nil
+	}
+	// writes and layout transitions wait for the reads as well. The stages of another
+	// family may not exist on this one, and a barrier would not order against its queue
+	// anyway, discarded contents taken over from it start at the top of the pipe.
+	if !discard || s.owner == family {
+		b.srcStages = s.writeStages | s.readStages
+	}
+	if !discard {
+		b.srcAccess = s.writeAccess
+	}
+	s.synced(state, family)
+	return b, true, nil
+}
+
+// release hands s over to dstFamily in the layout of state, to be acquired by its first use there.
+func (s *syncState) release(state ResourceState, family, dstFamily uint32) (barrierInfo, error) {
+	if s.owner != vk.QueueFamilyIgnored && s.owner != family || s.releasedBy != vk.QueueFamilyIgnored {
+		return barrierInfo{}, fmt.Errorf("owned by queue family %d, cannot be released by %d", s.owner, family)
+	}
+	b := barrierInfo{
+		srcStages: s.writeStages | s.readStages,
+		srcAccess: s.writeAccess,
+		dstStages: vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit),
+		oldLayout: s.layout,
+		newLayout: state.Layout,
+		srcFamily: family,
+		dstFamily: dstFamily,
+	}
+	*s = syncState{
+		layout:         state.Layout,
+		owner:          dstFamily,
+		releasedBy:     family,
+		releasedLayout: b.oldLayout,
+	}
+	return b, nil
+}
+
+// ImageRange selects levels and layers of an image. Zero Levels and Layers reach the
+// last level and layer.
+type ImageRange struct {
+	BaseLevel uint32
+	Levels    uint32
+	BaseLayer uint32
+	Layers    uint32
+}
+
+type imageBarrier struct {
+	img  *Image
+	info barrierInfo
+	r    ImageRange
+}
+
+type bufferBarrier struct {
+	buf  *Buffer
+	info barrierInfo
+}
+
+// Barriers collects what a command buffer of one queue family needs before using
+// buffers and images in new ways, from the state asch tracks for every buffer and image
+// subresource, and records it as a single vk.CmdPipelineBarrier. Reads following reads
+// need no barrier, reads following a write wait for it once per stage and access.
+//
+// The tracked state moves on when a use is added, so uses are added in the order the GPU
+// executes them and each subresource is used at most once per Record. The bindings do not
+// expose vkCmdPipelineBarrier2, so synchronization2 is never used.
+type Barriers struct {
+	family  uint32
+	images  []imageBarrier
+	buffers []bufferBarrier
+	err     error
+}
+
+// NewBarriers creates a barrier recorder for command buffers of the queue family.
+func NewBarriers(queueFamily uint32) *Barriers {
+	return &Barriers{family: queueFamily}
+}
+
+// Image adds the use of levels and layers of img, keeping their contents.
+func (b *Barriers) Image(img *Image, r ImageRange, state ResourceState) {
+	b.image(img, r, func(s *syncState) (barrierInfo, bool, error) {
+		return s.transition(state, b.family, s.layout == vk.ImageLayoutUndefined)
+	})
+}
+
+// DiscardImage adds the use of levels and layers of img, whose contents are not needed,
+// e.g. render targets about to be cleared. Taking them over from another queue family
+// needs no release, but the work of the other queue must be waited for with a semaphore.
+func (b *Barriers) DiscardImage(img *Image, r ImageRange, state ResourceState) {
+	b.image(img, r, func(s *syncState) (barrierInfo, bool, error) {
+		return s.transition(state, b.family, true)
+	})
+}
+
+// ReleaseImage hands levels and layers of img over to another queue family, which
+// acquires them when using them in state, layout included.
+func (b *Barriers) ReleaseImage(img *Image, r ImageRange, dstFamily uint32, state ResourceState) {
+	if dstFamily == b.family {
+		b.Image(img, r, state)
+		return
+	}
+	b.image(img, r, func(s *syncState) (barrierInfo, bool, error) {
+		info, err := s.release(state, b.family, dstFamily)
+		return info, err == nil, err
+	})
+}
+
+// image adds the barriers of every subresource in r, merged over levels and layers.
+func (b *Barriers) image(img *Image, r ImageRange, transition func(s *syncState) (barrierInfo, bool, error)) {
+	if r.BaseLevel >= img.MipLevels || r.BaseLayer >= img.Layers {
+		b.fail(fmt.Errorf("Barriers: level %d layer %d out of %d levels and %d layers", r.BaseLevel, r.BaseLayer, img.MipLevels, img.Layers))
+		return
+	}
+	if r.Levels == 0 {
+		r.Levels = img.MipLevels - r.BaseLevel
+	}
+	if r.Layers == 0 {
+		r.Layers = img.Layers - r.BaseLayer
+	}
+	// group starts the barriers of the previous layer, extended when this layer needs the same
+	group := len(b.images)
+	for layer := r.BaseLayer; layer < r.BaseLayer+r.Layers; layer++ {
+		var runs []imageBarrier
+		for level := r.BaseLevel; level < r.BaseLevel+r.Levels; level++ {
+			info, needed, err := transition(img.state(level, layer))
+			if err != nil {
+				b.fail(fmt.Errorf("Barriers: level %d layer %d %w", level, layer, err))
+				return
+			}
+			if !needed {
+				continue
+			}
+			if n := len(runs) - 1; n >= 0 && runs[n].info == info && runs[n].r.BaseLevel+runs[n].r.Levels == level {
+				runs[n].r.Levels++
+				continue
+			}
+			runs = append(runs, imageBarrier{img: img, info: info, r: ImageRange{BaseLevel: level, Levels: 1, BaseLayer: layer, Layers: 1}})
+		}
+		if prev := b.images[group:]; layer > r.BaseLayer && sameLevels(prev, runs) {
+			for i := range prev {
+				prev[i].r.Layers++
+			}
+			continue
+		}
+		group = len(b.images)
+		b.images = append(b.images, runs...)
+	}
+}
+
+func sameLevels(a, b []imageBarrier) bool {
+	if len(a) != len(b) || len(a) == 0 {
+		return false
+	}
+	for i := range a {
+		if a[i].info != b[i].info || a[i].r.BaseLevel != b[i].r.BaseLevel || a[i].r.Levels != b[i].r.Levels {
+			return false
+		}
+	}
+	return true
+}
+
+// Buffer adds the use of the whole buf, keeping its contents.
+func (b *Barriers) Buffer(buf *Buffer, state ResourceState) {
+	b.buffer(buf, state, false)
+}
+
+// DiscardBuffer adds the use of the whole buf, whose contents are not needed. Unlike
+// Buffer it takes over a buffer owned by another queue family without a release, the
+// work of the other queue must be waited for with a semaphore.
+func (b *Barriers) DiscardBuffer(buf *Buffer, state ResourceState) {
+	b.buffer(buf, state, true)
+}
+
+func (b *Barriers) buffer(buf *Buffer, state ResourceState, discard bool) {
+	state.Layout = vk.ImageLayoutUndefined
+	info, needed, err := buf.state.transition(state, b.family, discard)
+	if err != nil {
+		b.fail(fmt.Errorf("Barriers: buffer %w", err))
+		return
+	}
+	if needed {
+		b.buffers = append(b.buffers, bufferBarrier{buf: buf, info: info})
+	}
+}
+
+// ReleaseBuffer hands buf over to another queue family, which acquires it when using it.
+func (b *Barriers) ReleaseBuffer(buf *Buffer, dstFamily uint32) {
+	if dstFamily == b.family {
+		return
+	}
+	info, err := buf.state.release(ResourceState{}, b.family, dstFamily)
+	if err != nil {
+		b.fail(fmt.Errorf("Barriers: buffer %w", err))
+		return
+	}
+	b.buffers = append(b.buffers, bufferBarrier{buf: buf, info: info})
+}
+
+func (b *Barriers) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Record records the collected barriers into cmd, nothing when none are needed, and
+// starts collecting anew. It returns the first error met while collecting, e.g. a use on
+// another queue family than the owner without a release.
+func (b *Barriers) Record(cmd vk.CommandBuffer) error {
+	err := b.err
+	images, buffers := b.images, b.buffers
+	b.images, b.buffers, b.err = nil, nil, nil
+	if err != nil {
+		return err
+	}
+	if len(images)+len(buffers) == 0 {
+		return nil
+	}
+
+	var srcStages, dstStages vk.PipelineStageFlags
+	imageBarriers := make([]vk.ImageMemoryBarrier, len(images))
+	for i, ib := range images {
+		srcStages |= ib.info.srcStages
+		dstStages |= ib.info.dstStages
+		imageBarriers[i] = vk.ImageMemoryBarrier{
+			SType:               vk.StructureTypeImageMemoryBarrier,
+			SrcAccessMask:       ib.info.srcAccess,
+			DstAccessMask:       ib.info.dstAccess,
+			OldLayout:           ib.info.oldLayout,
+			NewLayout:           ib.info.newLayout,
+			SrcQueueFamilyIndex: ib.info.srcFamily,
+			DstQueueFamilyIndex: ib.info.dstFamily,
+			Image:               ib.img.Handle,
+			SubresourceRange:    ib.img.subresourceRange(ib.r.BaseLevel, ib.r.Levels, ib.r.BaseLayer, ib.r.Layers),
+		}
+	}
+	bufferBarriers := make([]vk.BufferMemoryBarrier, len(buffers))
+	for i, bb := range buffers {
+		srcStages |= bb.info.srcStages
+		dstStages |= bb.info.dstStages
+		bufferBarriers[i] = vk.BufferMemoryBarrier{
+			SType:               vk.StructureTypeBufferMemoryBarrier,
+			SrcAccessMask:       bb.info.srcAccess,
+			DstAccessMask:       bb.info.dstAccess,
+			SrcQueueFamilyIndex: bb.info.srcFamily,
+			DstQueueFamilyIndex: bb.info.dstFamily,
+			Buffer:              bb.buf.Handle,
+			Size:                vk.DeviceSize(vk.WholeSize),
+		}
+	}
+	if srcStages == 0 {
+		srcStages = vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit)
+	}
+	if dstStages == 0 {
+		dstStages = vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit)
+	}
+	vk.CmdPipelineBarrier(cmd, srcStages, dstStages, 0,
+		0, nil, uint32(len(bufferBarriers)), bufferBarriers, uint32(len(imageBarriers)), imageBarriers)
+	return nil
+}
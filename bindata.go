@@ -1,6 +1,8 @@
 // Code generated by go-bindata.
 // sources:
 // shaders/.DS_Store
+// shaders/equirect-comp.spv
+// shaders/equirect.comp
 // shaders/tri-frag.spv
 // shaders/tri-vert.spv
 // shaders/tri.frag
@@ -92,6 +94,46 @@ func shadersDs_store() (*asset, error) {
 	return a, nil
 }
 
+var _shadersEquirectCompSpv = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6d\x95\x49\x6f\x93\x31\x10\x86\x9d\x2f\x4d\xba\xa6\x2d\xe9\x9a\x2e\x49\x48\x29\x90\xee\x94\x36\x2d\x74\x07\x4a\x58\xc2\xd2\x96\xa5\xb4\x80\x84\xe0\x00\x07\xe0\x00\x47\x0e\xa0\x0a\x89\x13\x12\x7f\x81\x0b\x67\x7e\x01\x12\x7f\x0a\x8a\x84\xc4\xcc\x7c\x8f\x2b\x2b\x22\x92\xe5\xef\x7d\x66\x3c\x1e\xdb\x63\x27\x19\x8d\x34\x3a\x97\x70\xfa\x7b\xec\xe2\xdf\x31\x17\x19\xd1\x7e\x56\xfa\x56\x97\x36\x5d\xad\xed\xd4\xa6\xde\xbc\x7d\x36\x35\x37\x3f\xa3\x7e\xed\x2e\x69\xfe\x6a\xeb\x10\x9f\x94\xf4\x91\xb4\x97\x4f\x5e\xbc\x52\xae\xd6\x4e\xe1\x91\xc5\x72\xae\x89\x96\x30\x5b\xd2\xf8\x4f\x11\x55\xd7\x60\xbe\xad\xd2\x86\x5c\xac\x1b\xa4\x2f\x91\x8f\xd7\xc7\x03\x9d\xaa\xb3\xa7\xb0\x5b\x9e\x12\x4d\x75\x4e\x5a\x97\xcc\x92\x36\x5b\xd2\xc9\x42\xed\xbb\x57\xbe\x35\x8f\xa2\xb4\x1e\x19\xdb\xcc\x77\x02\xdd\x82\xd6\x5f\xb7\x8c\xd7\xbc\xfa\x84\xb7\x91\x7f\x84\xce\xa0\x93\xe8\x76\x74\x03\xba\x43\xfa\xe6\xc0\xbf\x13\xed\xfd\x75\x4f\x5a\xd0\xfd\xa2\xb3\xd2\x67\xd0\xe3\xe4\xd1\x45\xce\x43\xa2\xbb\xa5\xcf\xc2\x8a\xa2\x7b\xa4\x6f\xb4\x1c\x63\xdd\x8b\xce\xa2\xfb\x58\x93\xce\xb3\x84\x4e\xc2\x72\x92\x49\x7f\x70\x1e\xe1\xcf\xeb\x41\xf1\xce\x59\x6e\x71\xbc\x01\x78\x8e\x78\x03\xac\xd5\x11\x6f\xb0\x2e\x9e\xef\x23\x9a\xc6\x18\x3a\x8a\x1d\xc7\x50\x9d\x82\xe9\x9a\x75\xfc\x70\x9d\xce\x9b\x7a\xbf\xe6\x75\x21\xd6\x3f\xbc\xe6\xac\x8e\xec\xd4\xc9\xba\xd7\x5a\x27\x07\x87\xa5\x55\xaf\x47\x4c\x7f\x5d\x9d\x90\x99\xf5\x4c\x4f\x10\x43\x9b\x67\xa3\xcc\x9b\x37\x96\xb6\x73\x39\x89\x1e\xa6\x79\x7e\x8a\x9c\xea\xf9\x69\x74\xbe\x8e\x97\xd1\x85\x3a\x3e\x16\xc4\x08\xe7\x1d\x0f\x78\x01\x9e\xb5\x3e\xb6\x95\xc9\xcd\xf3\x49\x62\x95\xc9\xcd\xf3\x29\xfc\xc6\xc8\xcd\xf3\x69\xb8\x8f\xe5\xf9\x0c\xbc\xcc\x18\xcf\xcf\x10\xb7\xcc\x98\x09\x39\x7b\xad\xc1\x59\x72\x9a\x64\xae\x69\x62\xa8\x7f\x45\xf6\x35\x4d\x1d\x38\xea\xf4\xb7\xa8\xb3\x56\x07\x29\xab\xe5\x39\xb8\xc6\x59\xe1\x7e\xcc\x53\xb3\xef\xb8\x3f\x15\x98\xda\xb5\x86\x16\xa8\x9f\xe7\xd8\x17\x61\x5b\x42\xf5\xae\x9d\x63\x8c\x0b\xd8\x79\x58\x22\x60\x4b\xb0\x28\x60\xcb\xc4\x0b\xc7\xae\xc0\x74\xec\x77\x61\xfa\x36\xac\x32\xcf\x72\xc0\xd6\x98\x47\xfd\xbf\xc1\xd6\xf1\x55\xdb\x2f\x59\xd5\x06\xb1\xff\x48\xee\x6a\xbb\x20\x6d\x83\x7d\xd1\xef\x5b\xb2\x1b\xfa\x86\x5c\x24\xb7\x4a\x70\xaf\x5e\xf3\x1e\x5d\xc2\xee\x7d\x37\xc9\x6f\xf1\x3f\xbe\x97\xb1\x7f\xa0\xc6\xab\x8c\xd7\xfa\xff\x04\xbb\x02\x57\xdf\xcf\xb0\xab\x70\xbd\x57\x07\xb0\x6b\xf0\x51\xf6\x46\xef\xd5\x75\xb8\x0b\x58\x0d\xa6\x79\xdc\xa6\x9e\x6f\xe0\x5b\xa3\xce\x37\xc4\x57\xdf\xae\x9b\xd4\xc0\x12\xe7\x9b\xb5\x75\xc5\xfc\x8b\xf8\x64\x2c\x46\xcc\x34\x46\x1b\xf1\xb6\x88\xbf\x89\xdd\xcf\xbd\x8d\x2d\xcc\x67\x27\xf0\xf7\xec\x0e\x2c\xb2\x98\x8d\xc6\xee\x1e\xbd\x93\xb1\x7d\xdb\x6c\x4d\x66\xbb\x87\x6d\x9c\x78\x05\xd6\xa1\xf9\xa8\xfd\x7e\xf0\xee\xaa\xef\x47\xe6\xd9\x25\x6e\x89\x33\x50\xf6\x00\x5e\x0c\xfc\xf6\x88\x31\x62\xeb\x89\xf7\x7b\x1f\xdf\x3d\xf6\x46\xf3\x7a\xc8\xfb\xbb\x2b\x39\xeb\x7f\xcf\x23\xd8\x3e\x6b\xd1\xf7\xe2\xa9\x78\x2c\x50\x3b\x6a\x3f\x14\x8b\xaf\x31\xed\xff\x4a\xa6\x8b\xd2\xfe\x01\xd3\xbf\x11\x8d\x08\x08\x00\x00")
+
+func shadersEquirectCompSpvBytes() ([]byte, error) {
+	return bindataRead(
+		_shadersEquirectCompSpv,
+		"shaders/equirect-comp.spv",
+	)
+}
+
+func shadersEquirectCompSpv() (*asset, error) {
+	bytes, err := shadersEquirectCompSpvBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "shaders/equirect-comp.spv", size: 2056, mode: os.FileMode(420), modTime: time.Unix(1792359375, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _shadersEquirectComp = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x85\x53\xdb\x8a\xdb\x30\x10\x7d\xf7\x57\x0c\x14\x16\xb9\x91\x1d\x3b\x97\x25\x21\xdd\x87\xd2\x40\x59\xe8\x5b\x5f\xf6\x42\x08\x8a\xad\x64\x05\xb2\x94\xca\x72\x1a\xa7\xec\xbf\x77\x46\x4e\xb2\xd9\x6d\xbb\x35\x06\x8d\xc7\x67\xce\x1c\x1d\x69\x3e\xec\xa4\xab\x95\x35\x30\x1a\x67\x51\xbf\x0f\x5f\xac\xc1\x8c\xaf\x41\x18\x90\x3f\x1a\xe5\x64\xe1\x85\xd9\x34\x5a\x38\xd8\x0a\x63\x9d\xa8\x04\x28\xe3\x2d\xf8\x27\x09\xb5\xda\xc3\x5a\x14\xb2\x06\xbb\x06\x01\x45\xb3\x92\x50\x89\x2d\x27\x26\x6b\x24\x02\x77\xb6\x10\x9e\xf8\xb7\xd2\x81\x97\x7b\xa9\xf9\xb1\x42\x99\x40\x71\x80\x52\x55\xd2\x04\x0d\x48\x42\xa9\x52\xd5\x5b\xe1\x8b\xa7\x34\xd2\xa2\xb5\x8d\x07\xa6\x91\x45\x2f\x6b\x75\x90\xcb\x3d\xdc\xc0\x84\xc3\x45\xa6\xfd\x23\x73\xc0\x4c\x1e\x63\x87\xd9\x99\xa1\x96\x1e\x93\x19\x87\x95\x32\xa5\x32\x1b\xfa\x88\xa1\x31\x6a\x6d\x5d\x05\xb5\xa8\xb6\x5a\xba\xc1\xfc\xbc\xe7\x77\x2b\x73\x0e\x6e\xb3\x12\xf9\xf5\xfa\x85\xe2\xa7\x53\x5e\x5a\xa3\x5b\x50\x95\xd8\xc8\xc1\xfc\xb3\x73\xa2\x0d\x96\xcc\x22\xf2\x83\x76\x56\x58\xdd\x54\xa6\x26\x8f\x80\x35\x1c\x76\x9c\x74\x06\xef\xc8\x14\x40\x5b\x05\x6e\x9f\x04\xa0\x1f\x17\x4e\xf5\xee\x20\xb9\x83\xde\x3d\x24\xf7\xd0\x7b\x80\xe4\x01\xac\x2b\xa5\x8b\x0a\x6b\x6a\x8f\x74\x7e\xd8\x61\x1f\xaf\x17\xa8\x8f\xbe\x1f\x17\x2c\x02\x7c\x28\x66\xa8\x1e\xdf\x04\x75\x9f\x56\x5c\xa0\x5b\xb2\x98\xbf\x05\xbe\xc1\x25\x7f\x01\x1e\x53\x1d\xf0\xa5\x24\xff\x0f\xec\x95\x84\x7f\x02\x4f\x8d\x8f\xd4\x97\xb8\xe4\x1d\x60\x92\xc7\x51\x8c\x66\xef\xac\x2a\x11\xad\x0c\x8b\xe1\x57\x28\x55\x3b\x59\x0c\x01\xb3\x37\x5d\xc8\x36\x7a\xf9\x55\xdb\x95\xd0\xb7\xe7\x1b\x7a\x3b\xc7\xda\x13\x78\x00\x74\x91\x08\x4e\x87\xf9\x1d\x63\x46\x27\x19\xa7\xfb\xf6\x08\x5a\x03\x53\x65\xba\x87\x4f\x01\x89\xc1\xd5\x15\x36\x48\xdb\x53\xa2\x3d\xf5\xa6\x27\x30\x36\x3b\xe4\x63\x14\x86\x4a\x04\xf4\x20\x4b\xc7\x31\xf4\xc3\x7f\x46\x65\x31\x7c\x84\x41\x9a\x41\x02\x79\x9a\xcd\x2e\xeb\x87\x74\x2f\x90\x00\x47\xb0\x12\x9a\x04\x75\x07\x8e\x54\x87\x05\x56\x85\x6d\x35\x74\xa1\xd2\x2c\x8e\x67\xaf\x5b\xd7\x74\x85\x43\x13\x81\xd3\xcc\x90\x29\x3d\x70\x22\x4c\xf7\xd4\x31\x4b\xf3\xf1\x34\x1f\x8f\xa6\xa3\x4e\x12\x07\x51\xd8\x9a\x15\x1a\xc7\x22\x80\x5b\x32\x37\xcd\x8e\xe4\xa1\x62\x98\x4f\x86\xd9\x74\x32\xb9\x68\xd5\x79\xe5\xad\xeb\xcc\xe2\xe8\x07\xa7\x99\xf7\x8d\x93\xdf\x6c\xc9\x4e\xb3\xc5\x51\x0f\x1e\xd8\x8b\xce\xe7\xe8\x39\xfa\x0d\x93\xe2\x45\x74\x89\x04\x00\x00")
+
+func shadersEquirectCompBytes() ([]byte, error) {
+	return bindataRead(
+		_shadersEquirectComp,
+		"shaders/equirect.comp",
+	)
+}
+
+func shadersEquirectComp() (*asset, error) {
+	bytes, err := shadersEquirectCompBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "shaders/equirect.comp", size: 1161, mode: os.FileMode(420), modTime: time.Unix(1792359280, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _shadersTriFragSpv = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x54\x51\x5b\x4a\xc3\x50\x10\x9d\x26\x26\x6d\x8c\x5a\x45\xd0\x3f\xa9\xf8\xa9\x94\x22\x55\x04\xd1\xa2\x82\xfe\x14\x04\x5d\xc0\xe5\xda\x5e\x62\xb5\x26\x35\x8f\x7f\x97\xe0\x36\x5c\x95\xdb\xf0\x43\xc1\x33\x93\x09\x68\x2f\xd3\xb9\x67\xe6\xe4\xcc\x99\xc4\xf7\xf6\xda\x44\x2d\x9c\x0e\x75\xa9\xfe\x6d\x90\x07\x4c\x14\x53\x28\xf9\x66\x7c\x3f\xee\x17\xe5\xb4\x3f\x3c\x1a\x70\x7f\x8d\x7c\xe1\x71\xaf\x0b\xce\x12\x32\xc7\x8b\x9d\xa5\x5c\x8f\x10\xeb\xe0\x70\x0d\xe2\xb8\xf9\x50\x24\x7a\x6f\x31\x2f\x82\x9e\xb9\xb8\xbb\x34\x85\x5b\xd8\xdc\x96\xce\x14\x8f\x76\xea\x72\x93\x3d\x3c\xb9\x49\x59\xfc\xe7\xa0\x35\x4b\x13\x33\xb7\x69\x52\xd9\xc4\x99\xe1\xe1\x60\x61\x27\xcf\x14\x80\xf5\x77\x66\x80\xc3\x73\xab\xeb\xdc\x26\x57\xd9\x3c\xcb\xe1\x5b\x94\x88\x76\x74\xaf\x4d\xb8\x60\x1f\xbb\xe2\x88\xe4\xbe\x85\x5b\x88\xdc\x43\x6c\x83\xcf\x7e\x43\xdd\xa7\x87\xff\x8e\xf8\xaf\xf7\x38\x55\x1c\x69\x6d\x1f\x98\xb9\xcb\xdc\xfb\xbc\x1d\x35\x38\xd6\x79\x0d\x5e\x41\x7c\x7f\xbc\x9e\x35\x78\x55\xba\x6f\xa3\x03\xa8\xb6\xe5\x7d\xd6\x1a\xb1\x72\xb9\x7f\x8c\x7d\x3c\xf5\x41\x3a\xef\x0b\x95\x00\xf9\x1c\x28\xd2\xe7\x7e\xf0\x15\x4e\x10\xbf\x01\x00\x00\xff\xff\xbb\x64\x7d\x87\xc8\x01\x00\x00")
 
 func shadersTriFragSpvBytes() ([]byte, error) {
@@ -224,11 +266,13 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"shaders/.DS_Store":    shadersDs_store,
-	"shaders/tri-frag.spv": shadersTriFragSpv,
-	"shaders/tri-vert.spv": shadersTriVertSpv,
-	"shaders/tri.frag":     shadersTriFrag,
-	"shaders/tri.vert":     shadersTriVert,
+	"shaders/.DS_Store":         shadersDs_store,
+	"shaders/equirect-comp.spv": shadersEquirectCompSpv,
+	"shaders/equirect.comp":     shadersEquirectComp,
+	"shaders/tri-frag.spv":      shadersTriFragSpv,
+	"shaders/tri-vert.spv":      shadersTriVertSpv,
+	"shaders/tri.frag":          shadersTriFrag,
+	"shaders/tri.vert":          shadersTriVert,
 }
 
 // AssetDir returns the file names below a certain
@@ -275,11 +319,13 @@ type bintree struct {
 
 var _bintree = &bintree{nil, map[string]*bintree{
 	"shaders": &bintree{nil, map[string]*bintree{
-		".DS_Store":    &bintree{shadersDs_store, map[string]*bintree{}},
-		"tri-frag.spv": &bintree{shadersTriFragSpv, map[string]*bintree{}},
-		"tri-vert.spv": &bintree{shadersTriVertSpv, map[string]*bintree{}},
-		"tri.frag":     &bintree{shadersTriFrag, map[string]*bintree{}},
-		"tri.vert":     &bintree{shadersTriVert, map[string]*bintree{}},
+		".DS_Store":         &bintree{shadersDs_store, map[string]*bintree{}},
+		"equirect-comp.spv": &bintree{shadersEquirectCompSpv, map[string]*bintree{}},
+		"equirect.comp":     &bintree{shadersEquirectComp, map[string]*bintree{}},
+		"tri-frag.spv":      &bintree{shadersTriFragSpv, map[string]*bintree{}},
+		"tri-vert.spv":      &bintree{shadersTriVertSpv, map[string]*bintree{}},
+		"tri.frag":          &bintree{shadersTriFrag, map[string]*bintree{}},
+		"tri.vert":          &bintree{shadersTriVert, map[string]*bintree{}},
 	}},
 }}
 
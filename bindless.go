@@ -0,0 +1,416 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// BindlessKind is a kind of resource of the bindless table, its value is the binding
+// number of the array holding them.
+type BindlessKind uint32
+
+const (
+	BindlessSampledImage BindlessKind = iota
+	BindlessStorageImage
+	BindlessStorageBuffer
+	BindlessSampler
+	bindlessKinds
+)
+
+var bindlessTypes = [bindlessKinds]vk.DescriptorType{
+	BindlessSampledImage:  vk.DescriptorTypeSampledImage,
+	BindlessStorageImage:  vk.DescriptorTypeStorageImage,
+	BindlessStorageBuffer: vk.DescriptorTypeStorageBuffer,
+	BindlessSampler:       vk.DescriptorTypeSampler,
+}
+
+var bindlessNames = [bindlessKinds]string{"sampled image", "storage image", "storage buffer", "sampler"}
+
+// BindlessConfig sets the array sizes of the bindless table, zero picks the defaults.
+type BindlessConfig struct {
+	SampledImages  uint32
+	StorageImages  uint32
+	StorageBuffers uint32
+	Samplers       uint32
+}
+
+// DefaultBindlessConfig is well below the update-after-bind limits of devices with
+// descriptor indexing, which are at least 500000 descriptors per stage.
+var DefaultBindlessConfig = BindlessConfig{
+	SampledImages:  16384,
+	StorageImages:  1024,
+	StorageBuffers: 4096,
+	Samplers:       64,
+}
+
+type bindlessSlots struct {
+	capacity uint32
+	next     uint32
+	free     []uint32
+	// live marks the slots below next holding a resource
+	live []bool
+}
+
+// BindlessTable is one large descriptor set holding arrays of sampled images, storage
+// images, storage buffers and samplers, bound once for all draws. Resources are added to
+// free slots and shaders find them by the uint32 handles, e.g. passed in push constants:
+//
+//	layout(set = 0, binding = 0) uniform texture2D textures[];
+//	layout(set = 0, binding = 3) uniform sampler samplers[];
+//	texture(sampler2D(textures[nonuniformEXT(handle)], samplers[0]), uv)
+//
+// With DeviceFeatures.DescriptorIndexing the arrays are partially bound and updated after
+// bind, so resources are added and freed while frames using the set are in flight. Without
+// it the arrays are clamped to the Vulkan 1.0 per stage and per set limits, empty slots hold
+// placeholder resources and Add and Free must not run while a command buffer using the set
+// is pending. Either way a handle must not be freed before the GPU is done with it, see
+// DeletionQueue.
+type BindlessTable struct {
+	mu       sync.Mutex
+	device   vk.Device
+	indexing bool
+	layout   vk.DescriptorSetLayout
+	pool     vk.DescriptorPool
+	set      vk.DescriptorSet
+	slots    [bindlessKinds]bindlessSlots
+
+	// placeholders fill empty slots when the arrays cannot be partially bound
+	placeholderTexture *Image
+	placeholderStorage *Image
+	placeholderBuffer  *Buffer
+	placeholderSampler vk.Sampler
+}
+
+// NewBindlessTable creates the table. The uploader creates the placeholders when the
+// device lacks descriptor indexing, it may be nil otherwise.
+func NewBindlessTable(ctx context.Context, v *Vulkan, u *Uploader, config BindlessConfig) (*BindlessTable, error) {
+	t := &BindlessTable{
+		device:   v.Device,
+		indexing: v.Features.DescriptorIndexing,
+	}
+	sizes := [bindlessKinds]uint32{config.SampledImages, config.StorageImages, config.StorageBuffers, config.Samplers}
+	defaults := [bindlessKinds]uint32{DefaultBindlessConfig.SampledImages, DefaultBindlessConfig.StorageImages,
+		DefaultBindlessConfig.StorageBuffers, DefaultBindlessConfig.Samplers}
+	limits := v.Properties.Limits
+	stageLimits := [bindlessKinds]uint32{limits.MaxPerStageDescriptorSampledImages, limits.MaxPerStageDescriptorStorageImages,
+		limits.MaxPerStageDescriptorStorageBuffers, limits.MaxPerStageDescriptorSamplers}
+	setLimits := [bindlessKinds]uint32{limits.MaxDescriptorSetSampledImages, limits.MaxDescriptorSetStorageImages,
+		limits.MaxDescriptorSetStorageBuffers, limits.MaxDescriptorSetSamplers}
+	var total uint64
+	for kind := range bindlessKinds {
+		size := sizes[kind]
+		if size == 0 {
+			size = defaults[kind]
+		}
+		if !t.indexing {
+			size = min(size, stageLimits[kind], setLimits[kind])
+		}
+		t.slots[kind].capacity = size
+		total += uint64(size)
+	}
+	if !t.indexing && total > uint64(limits.MaxPerStageResources) {
+		// every array is visible to all stages, so together they count against each stage
+		for kind := range bindlessKinds {
+			slots := &t.slots[kind]
+			slots.capacity = max(uint32(uint64(slots.capacity)*uint64(limits.MaxPerStageResources)/total), 1)
+		}
+	}
+	if !t.indexing && u == nil {
+		return nil, fmt.Errorf("NewBindlessTable: descriptor indexing is not supported, an uploader is needed for the placeholders")
+	}
+
+	// Phase 1: vk.CreateDescriptorSetLayout
+	//			partially bound and update-after-bind with descriptor indexing
+
+	setLayoutBindings := make([]vk.DescriptorSetLayoutBinding, bindlessKinds)
+	bindingFlags := make([]vk.DescriptorBindingFlags, bindlessKinds)
+	poolSizes := make([]vk.DescriptorPoolSize, bindlessKinds)
+	for kind := range bindlessKinds {
+		setLayoutBindings[kind] = vk.DescriptorSetLayoutBinding{
+			Binding:         uint32(kind),
+			DescriptorType:  bindlessTypes[kind],
+			DescriptorCount: t.slots[kind].capacity,
+			StageFlags:      vk.ShaderStageFlags(vk.ShaderStageAll),
+		}
+		bindingFlags[kind] = vk.DescriptorBindingFlags(vk.DescriptorBindingPartiallyBoundBit |
+			vk.DescriptorBindingUpdateAfterBindBit | vk.DescriptorBindingUpdateUnusedWhilePendingBit)
+		poolSizes[kind] = vk.DescriptorPoolSize{
+			Type:            bindlessTypes[kind],
+			DescriptorCount: t.slots[kind].capacity,
+		}
+	}
+	setLayoutCreateInfo := vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: uint32(len(setLayoutBindings)),
+		PBindings:    setLayoutBindings,
+	}
+	var flagsCreateInfo vk.DescriptorSetLayoutBindingFlagsCreateInfo
+	if t.indexing {
+		flagsCreateInfo = vk.DescriptorSetLayoutBindingFlagsCreateInfo{
+			SType:         vk.StructureTypeDescriptorSetLayoutBindingFlagsCreateInfo,
+			BindingCount:  uint32(len(bindingFlags)),
+			PBindingFlags: bindingFlags,
+		}
+		ref, _ := flagsCreateInfo.PassRef()
+		setLayoutCreateInfo.PNext = unsafe.Pointer(ref)
+		setLayoutCreateInfo.Flags = vk.DescriptorSetLayoutCreateFlags(vk.DescriptorSetLayoutCreateUpdateAfterBindPoolBit)
+	}
+	err := vk.Error(vk.CreateDescriptorSetLayout(t.device, &setLayoutCreateInfo, nil, &t.layout))
+	flagsCreateInfo.Free()
+	if err != nil {
+		err = fmt.Errorf("vk.CreateDescriptorSetLayout failed with %s", err)
+		return nil, err
+	}
+
+	// Phase 2: vk.CreateDescriptorPool
+	//			vk.AllocateDescriptorSets
+
+	poolCreateInfo := vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       1,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+	if t.indexing {
+		poolCreateInfo.Flags = vk.DescriptorPoolCreateFlags(vk.DescriptorPoolCreateUpdateAfterBindBit)
+	}
+	err = vk.Error(vk.CreateDescriptorPool(t.device, &poolCreateInfo, nil, &t.pool))
+	if err != nil {
+		t.Destroy()
+		err = fmt.Errorf("vk.CreateDescriptorPool failed with %s", err)
+		return nil, err
+	}
+	setAllocateInfo := vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     t.pool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{t.layout},
+	}
+	sets := make([]vk.DescriptorSet, 1)
+	err = vk.Error(vk.AllocateDescriptorSets(t.device, &setAllocateInfo, &sets[0]))
+	if err != nil {
+		t.Destroy()
+		err = fmt.Errorf("vk.AllocateDescriptorSets failed with %s", err)
+		return nil, err
+	}
+	t.set = sets[0]
+
+	// Phase 3: placeholders in every slot, without descriptor indexing
+
+	if !t.indexing {
+		if err = t.createPlaceholders(ctx, v, u); err != nil {
+			t.Destroy()
+			return nil, err
+		}
+		for kind := range bindlessKinds {
+			t.writePlaceholders(kind, 0, t.slots[kind].capacity)
+		}
+	}
+	return t, nil
+}
+
+func (t *BindlessTable) createPlaceholders(ctx context.Context, v *Vulkan, u *Uploader) error {
+	var err error
+	t.placeholderTexture, err = u.CreateTexture(ctx, image.NewNRGBA(image.Rect(0, 0, 1, 1)), TextureOptions{})
+	if err != nil {
+		return err
+	}
+	t.placeholderStorage, err = v.Allocator.CreateImage(ImageCreateInfo{
+		Format: vk.FormatR8g8b8a8Unorm,
+		Width:  1,
+		Height: 1,
+		Usage:  vk.ImageUsageFlags(vk.ImageUsageStorageBit),
+	})
+	if err != nil {
+		return err
+	}
+	t.placeholderBuffer, err = v.Allocator.CreateBuffer(16, vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit), MemoryGPUOnly)
+	if err != nil {
+		return err
+	}
+	t.placeholderSampler, err = v.Samplers.Get(DefaultSamplerDesc())
+	if err != nil {
+		return err
+	}
+
+	// the storage placeholder waits in the general layout
+	storage := t.placeholderStorage
+	u.mu.Lock()
+	if err = u.begin(ctx); err != nil {
+		u.mu.Unlock()
+		return err
+	}
+	family := u.graphics.Family()
+	u.graphicsWork = append(u.graphicsWork, func(cmd vk.CommandBuffer) error {
+		barriers := NewBarriers(family)
+		barriers.DiscardImage(storage, ImageRange{}, ResourceState{
+			Stages: shaderStages,
+			Access: vk.AccessFlags(vk.AccessShaderReadBit | vk.AccessShaderWriteBit),
+			Layout: vk.ImageLayoutGeneral,
+		})
+		return barriers.Record(cmd)
+	})
+	u.mu.Unlock()
+	return u.Flush(ctx)
+}
+
+// writePlaceholders writes count placeholders of kind from slot first.
+func (t *BindlessTable) writePlaceholders(kind BindlessKind, first, count uint32) {
+	write := vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          t.set,
+		DstBinding:      uint32(kind),
+		DstArrayElement: first,
+		DescriptorCount: count,
+		DescriptorType:  bindlessTypes[kind],
+	}
+	switch kind {
+	case BindlessStorageBuffer:
+		write.PBufferInfo = make([]vk.DescriptorBufferInfo, count)
+		for i := range write.PBufferInfo {
+			write.PBufferInfo[i] = vk.DescriptorBufferInfo{Buffer: t.placeholderBuffer.Handle, Range: vk.DeviceSize(vk.WholeSize)}
+		}
+	default:
+		info := vk.DescriptorImageInfo{ImageView: t.placeholderTexture.View, ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal}
+		switch kind {
+		case BindlessStorageImage:
+			info = vk.DescriptorImageInfo{ImageView: t.placeholderStorage.View, ImageLayout: vk.ImageLayoutGeneral}
+		case BindlessSampler:
+			info = vk.DescriptorImageInfo{Sampler: t.placeholderSampler}
+		}
+		write.PImageInfo = make([]vk.DescriptorImageInfo, count)
+		for i := range write.PImageInfo {
+			write.PImageInfo[i] = info
+		}
+	}
+	vk.UpdateDescriptorSets(t.device, 1, []vk.WriteDescriptorSet{write}, 0, nil)
+}
+
+// Indexing reports whether the table relies on descriptor indexing, see BindlessTable.
+func (t *BindlessTable) Indexing() bool {
+	return t.indexing
+}
+
+// Layout returns the layout of the set, for pipeline layouts.
+func (t *BindlessTable) Layout() vk.DescriptorSetLayout {
+	return t.layout
+}
+
+// Set returns the descriptor set.
+func (t *BindlessTable) Set() vk.DescriptorSet {
+	return t.set
+}
+
+// Capacity returns the number of slots of kind.
+func (t *BindlessTable) Capacity(kind BindlessKind) uint32 {
+	return t.slots[kind].capacity
+}
+
+// Bind binds the table as set number of the pipeline layout.
+func (t *BindlessTable) Bind(cmd vk.CommandBuffer, bindPoint vk.PipelineBindPoint, layout vk.PipelineLayout, set uint32) {
+	vk.CmdBindDescriptorSets(cmd, bindPoint, layout, set, 1, []vk.DescriptorSet{t.set}, 0, nil)
+}
+
+// AddSampledImage adds a view in vk.ImageLayoutShaderReadOnlyOptimal and returns its handle.
+func (t *BindlessTable) AddSampledImage(view vk.ImageView) (uint32, error) {
+	return t.add(BindlessSampledImage, func(w *DescriptorWriter, slot uint32) {
+		w.ImageAt(uint32(BindlessSampledImage), slot, vk.DescriptorTypeSampledImage, view, vk.NullSampler, vk.ImageLayoutShaderReadOnlyOptimal)
+	})
+}
+
+// AddTexture adds the view of img, see AddSampledImage.
+func (t *BindlessTable) AddTexture(img *Image) (uint32, error) {
+	return t.AddSampledImage(img.View)
+}
+
+// AddStorageImage adds a view in vk.ImageLayoutGeneral and returns its handle.
+func (t *BindlessTable) AddStorageImage(view vk.ImageView) (uint32, error) {
+	return t.add(BindlessStorageImage, func(w *DescriptorWriter, slot uint32) {
+		w.ImageAt(uint32(BindlessStorageImage), slot, vk.DescriptorTypeStorageImage, view, vk.NullSampler, vk.ImageLayoutGeneral)
+	})
+}
+
+// AddStorageBuffer adds a range of buf and returns its handle. vk.WholeSize reaches the end of buf.
+func (t *BindlessTable) AddStorageBuffer(buf *Buffer, offset, size vk.DeviceSize) (uint32, error) {
+	if buf.Usage&vk.BufferUsageFlags(vk.BufferUsageStorageBufferBit) == 0 {
+		return 0, fmt.Errorf("BindlessTable.AddStorageBuffer: buffer was not created with vk.BufferUsageStorageBufferBit")
+	}
+	return t.add(BindlessStorageBuffer, func(w *DescriptorWriter, slot uint32) {
+		w.BufferAt(uint32(BindlessStorageBuffer), slot, vk.DescriptorTypeStorageBuffer, buf, offset, size)
+	})
+}
+
+// AddSampler adds a sampler, e.g. from the SamplerCache, and returns its handle.
+func (t *BindlessTable) AddSampler(sampler vk.Sampler) (uint32, error) {
+	return t.add(BindlessSampler, func(w *DescriptorWriter, slot uint32) {
+		w.ImageAt(uint32(BindlessSampler), slot, vk.DescriptorTypeSampler, vk.NullImageView, sampler, vk.ImageLayoutUndefined)
+	})
+}
+
+// add takes a free slot of kind, most recently freed first, and writes it.
+func (t *BindlessTable) add(kind BindlessKind, write func(w *DescriptorWriter, slot uint32)) (uint32, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slots := &t.slots[kind]
+	var slot uint32
+	switch n := len(slots.free); {
+	case n > 0:
+		slot = slots.free[n-1]
+		slots.free = slots.free[:n-1]
+	case slots.next < slots.capacity:
+		slot = slots.next
+		slots.next++
+		slots.live = append(slots.live, false)
+	default:
+		return 0, fmt.Errorf("BindlessTable: all %d %s slots are used", slots.capacity, bindlessNames[kind])
+	}
+	slots.live[slot] = true
+	w := NewDescriptorWriter()
+	write(w, slot)
+	w.Update(t.device, t.set)
+	return slot, nil
+}
+
+// Free returns the slot of handle. Shaders must no longer reach it, the slot is reused
+// by the next resource of its kind. Handles which are not in use are rejected.
+func (t *BindlessTable) Free(kind BindlessKind, handle uint32) error {
+	if kind >= bindlessKinds {
+		return fmt.Errorf("BindlessTable.Free: unknown kind %d", kind)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slots := &t.slots[kind]
+	if handle >= slots.next || !slots.live[handle] {
+		return fmt.Errorf("BindlessTable.Free: %s handle %d is not in use", bindlessNames[kind], handle)
+	}
+	if !t.indexing {
+		t.writePlaceholders(kind, handle, 1)
+	}
+	slots.live[handle] = false
+	slots.free = append(slots.free, handle)
+	return nil
+}
+
+// Destroy destroys the set together with the placeholders.
+func (t *BindlessTable) Destroy() {
+	if t == nil {
+		return
+	}
+	if t.pool != vk.NullDescriptorPool {
+		vk.DestroyDescriptorPool(t.device, t.pool, nil)
+		t.pool = vk.NullDescriptorPool
+	}
+	if t.layout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(t.device, t.layout, nil)
+		t.layout = vk.NullDescriptorSetLayout
+	}
+	t.placeholderTexture.Destroy()
+	t.placeholderStorage.Destroy()
+	t.placeholderBuffer.Destroy()
+	t.placeholderTexture, t.placeholderStorage, t.placeholderBuffer = nil, nil, nil
+}
@@ -0,0 +1,180 @@
+package asch
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// defaultBudgetFraction is the part of a heap assumed available to the application
+// when the driver does not report a budget, following VMA.
+const defaultBudgetFraction = 0.8
+
+// budgetRefreshInterval is the number of allocations after which the budget reported by
+// VK_EXT_memory_budget is read again, following VMA.
+const budgetRefreshInterval = 30
+
+// defaultBudgetThreshold is the usage, as a part of the budget, that triggers a warning.
+const defaultBudgetThreshold = 0.9
+
+// HeapBudget is the memory usage of one heap against the memory the application may use.
+type HeapBudget struct {
+	Heap uint32
+	Size vk.DeviceSize
+	// Budget is the memory the application can use before allocations start failing
+	// or the driver starts paging.
+	Budget vk.DeviceSize
+	// Usage is the memory the application allocated from the heap.
+	Usage vk.DeviceSize
+	// Estimated is set when Budget is a fraction of the heap size rather than the number
+	// reported by VK_EXT_memory_budget.
+	Estimated bool
+}
+
+// Fraction returns Usage as a part of Budget.
+func (b HeapBudget) Fraction() float64 {
+	if b.Budget == 0 {
+		return 0
+	}
+	return float64(b.Usage) / float64(b.Budget)
+}
+
+func (b HeapBudget) String() string {
+	return fmt.Sprintf("heap %d: %d of %d bytes (%.0f%%)", b.Heap, b.Usage, b.Budget, 100*b.Fraction())
+}
+
+// BudgetFunc is called when the usage of a heap crosses the threshold of its budget.
+type BudgetFunc func(HeapBudget)
+
+// budgetTracker counts the device memory allocated per heap and reports heaps
+// crossing the threshold. It has its own lock, so it can be read while the
+// allocator lock is held.
+type budgetTracker struct {
+	mu        sync.Mutex
+	heaps     []HeapBudget
+	threshold float64
+	callback  BudgetFunc
+	over      []bool
+	// extension tells VK_EXT_memory_budget is supported by the device
+	extension bool
+	// query reads the driver budget once the extension is enabled, nil before
+	query        *memoryBudgetQuery
+	sinceRefresh int
+}
+
+func (t *budgetTracker) init(gpu vk.PhysicalDevice, memProperties vk.PhysicalDeviceMemoryProperties) {
+	t.threshold = defaultBudgetThreshold
+	t.extension = slices.Contains(getDeviceExtensions(gpu), vk.ExtMemoryBudgetExtensionName)
+	t.heaps = make([]HeapBudget, memProperties.MemoryHeapCount)
+	t.over = make([]bool, memProperties.MemoryHeapCount)
+	for i := range t.heaps {
+		size := memProperties.MemoryHeaps[i].Size
+		t.heaps[i] = HeapBudget{
+			Heap:      uint32(i),
+			Size:      size,
+			Budget:    vk.DeviceSize(float64(size) * defaultBudgetFraction),
+			Estimated: true,
+		}
+	}
+}
+
+func (t *budgetTracker) heap(heap uint32) HeapBudget {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.heaps[heap]
+}
+
+// refresh reads the driver budget of every heap, t.mu must be held.
+func (t *budgetTracker) refresh() {
+	if t.query == nil {
+		return
+	}
+	t.sinceRefresh = 0
+	budget, _ := t.query.heaps()
+	for i := range min(len(budget), len(t.heaps)) {
+		t.heaps[i].Budget = budget[i]
+		t.heaps[i].Estimated = false
+	}
+}
+
+func (t *budgetTracker) allocated(heap uint32, size vk.DeviceSize) {
+	t.mu.Lock()
+	if t.sinceRefresh++; t.sinceRefresh >= budgetRefreshInterval {
+		t.refresh()
+	}
+	b := &t.heaps[heap]
+	b.Usage += size
+	crossed := !t.over[heap] && b.Fraction() >= t.threshold
+	if crossed {
+		t.over[heap] = true
+	}
+	callback, budget := t.callback, *b
+	t.mu.Unlock()
+
+	if !crossed {
+		return
+	}
+	if callback == nil {
+		slog.Warn(fmt.Sprintf("memory budget threshold crossed on %s", budget))
+		return
+	}
+	callback(budget)
+}
+
+func (t *budgetTracker) freed(heap uint32, size vk.DeviceSize) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.heaps[heap]
+	b.Usage -= min(size, b.Usage)
+	if b.Fraction() < t.threshold {
+		t.over[heap] = false
+	}
+}
+
+// Budget returns the usage of every heap against its budget.
+func (a *Allocator) Budget() []HeapBudget {
+	a.budget.mu.Lock()
+	defer a.budget.mu.Unlock()
+	a.budget.refresh()
+	return slices.Clone(a.budget.heaps)
+}
+
+// BudgetExtension reports whether the device supports VK_EXT_memory_budget.
+func (a *Allocator) BudgetExtension() bool {
+	return a.budget.extension
+}
+
+// EnableMemoryBudget switches the budgets to the ones the driver reports, once the device
+// was created with VK_EXT_memory_budget on a Vulkan 1.1 instance. It reports whether the
+// driver budget is used; the estimate stays otherwise.
+func (a *Allocator) EnableMemoryBudget(instance vk.Instance) bool {
+	if !a.budget.extension {
+		return false
+	}
+	query := newMemoryBudgetQuery(instance, a.gpu)
+	if query == nil {
+		return false
+	}
+	a.budget.mu.Lock()
+	defer a.budget.mu.Unlock()
+	a.budget.query = query
+	a.budget.refresh()
+	return true
+}
+
+// SetBudgetThreshold sets the part of its budget a heap may use before callback is called,
+// once per crossing. A nil callback logs a warning, which is the default at 0.9.
+// The callback runs on the allocating goroutine, possibly while the allocator is locked,
+// so it must not allocate or free memory itself; signal an eviction elsewhere instead.
+func (a *Allocator) SetBudgetThreshold(threshold float64, callback BudgetFunc) {
+	a.budget.mu.Lock()
+	defer a.budget.mu.Unlock()
+	a.budget.threshold = threshold
+	a.budget.callback = callback
+	for i := range a.budget.heaps {
+		a.budget.over[i] = a.budget.heaps[i].Fraction() >= threshold
+	}
+}
@@ -1,106 +1,229 @@
 package asch
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"unsafe"
 
 	vk "github.com/tomas-mraz/vulkan"
 	"github.com/xlab/linmath"
 )
 
-type VulkanBufferInfo struct {
-	device        vk.Device
-	vertexBuffers []vk.Buffer
-	deviceMemory  vk.DeviceMemory
+// Buffer owns a vk.Buffer together with the memory bound to it.
+type Buffer struct {
+	device     vk.Device
+	Handle     vk.Buffer
+	Allocation *Allocation
+	Size       vk.DeviceSize
+	Usage      vk.BufferUsageFlags
+	Intent     MemoryIntent
+	address    DeviceAddress
+	state      syncState
+}
+
+// CreateBuffer creates a buffer for any combination of vertex, index, uniform, storage,
+// indirect and transfer usages, with memory chosen according to the intent.
+func (a *Allocator) CreateBuffer(size vk.DeviceSize, usage vk.BufferUsageFlags, intent MemoryIntent) (*Buffer, error) {
+	return a.CreateBufferWith(size, usage, AllocationCreateInfo{Intent: intent})
 }
 
-func NewBuffer(device vk.Device, gpu vk.PhysicalDevice) (VulkanBufferInfo, error) {
+// CreateBufferWith is CreateBuffer with full control over the allocation.
+func (a *Allocator) CreateBufferWith(size vk.DeviceSize, usage vk.BufferUsageFlags, info AllocationCreateInfo) (*Buffer, error) {
+	if size == 0 {
+		return nil, fmt.Errorf("CreateBuffer: size must not be zero")
+	}
+	if usage&vk.BufferUsageFlags(vk.BufferUsageShaderDeviceAddressBit) != 0 && !a.DeviceAddress() {
+		return nil, fmt.Errorf("CreateBuffer: device address usage needs the bufferDeviceAddress feature")
+	}
 
 	// Phase 1: vk.CreateBuffer
-	//			create the triangle vertex buffer
 
-	vertexData := linmath.ArrayFloat32([]float32{
-		-1, -1, 0,
-		1, -1, 0,
-		0, 1, 0,
-	})
-	queueFamilyIdx := []uint32{0}
 	bufferCreateInfo := vk.BufferCreateInfo{
-		SType:                 vk.StructureTypeBufferCreateInfo,
-		Size:                  vk.DeviceSize(vertexData.Sizeof()),
-		Usage:                 vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit),
-		SharingMode:           vk.SharingModeExclusive,
-		QueueFamilyIndexCount: 1,
-		PQueueFamilyIndices:   queueFamilyIdx,
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        size,
+		Usage:       usage,
+		SharingMode: vk.SharingModeExclusive,
 	}
-	buffer := VulkanBufferInfo{
-		vertexBuffers: make([]vk.Buffer, 1),
+	buffer := &Buffer{
+		device: a.device,
+		Size:   size,
+		Usage:  usage,
+		Intent: info.Intent,
+		state:  newSyncState(),
 	}
-	err := vk.Error(vk.CreateBuffer(device, &bufferCreateInfo, nil, &buffer.vertexBuffers[0]))
+	err := vk.Error(vk.CreateBuffer(a.device, &bufferCreateInfo, nil, &buffer.Handle))
 	if err != nil {
 		err = fmt.Errorf("vk.CreateBuffer failed with %s", err)
-		return buffer, err
+		return nil, err
 	}
 
-	// Phase 2: vk.GetBufferMemoryRequirements
-	//			vk.FindMemoryTypeIndex
-	// 			assign a proper memory type for that buffer
+	// Phase 2: Allocator.AllocateForBuffer
+	// 			sub-allocate memory of a proper type and bind it
 
-	var memReq vk.MemoryRequirements
-	vk.GetBufferMemoryRequirements(device, buffer.DefaultVertexBuffer(), &memReq)
-	memReq.Deref()
-	allocInfo := vk.MemoryAllocateInfo{
-		SType:           vk.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  memReq.Size,
-		MemoryTypeIndex: 0, // see below
+	buffer.Allocation, err = a.AllocateForBuffer(buffer.Handle, info)
+	if err != nil {
+		buffer.Destroy()
+		return nil, err
 	}
-	allocInfo.MemoryTypeIndex, _ = vk.FindMemoryTypeIndex(gpu, memReq.MemoryTypeBits,
-		vk.MemoryPropertyHostVisibleBit)
+	return buffer, nil
+}
 
-	// Phase 3: vk.AllocateMemory
-	//			vk.MapMemory
-	//			vk.MemCopyFloat32
-	//			vk.UnmapMemory
-	// 			allocate and map memory for that buffer
+// ErrNoDeviceAddress is returned by GetDeviceAddress when the device does not provide
+// vkGetBufferDeviceAddress, i.e. the bufferDeviceAddress feature was not enabled.
+var ErrNoDeviceAddress = errors.New("buffer device address is not available")
+
+// GetDeviceAddress returns the address shaders reach the buffer at. The buffer must have
+// been created with vk.BufferUsageShaderDeviceAddressBit.
+func (b *Buffer) GetDeviceAddress() (DeviceAddress, error) {
+	if b.Usage&vk.BufferUsageFlags(vk.BufferUsageShaderDeviceAddressBit) == 0 {
+		return 0, fmt.Errorf("Buffer.GetDeviceAddress: buffer was not created with vk.BufferUsageShaderDeviceAddressBit")
+	}
+	if b.address == 0 {
+		b.address = getBufferDeviceAddress(b.device, b.Handle)
+		if b.address == 0 {
+			return 0, ErrNoDeviceAddress
+		}
+	}
+	return b.address, nil
+}
 
-	var deviceMemory vk.DeviceMemory
-	err = vk.Error(vk.AllocateMemory(device, &allocInfo, nil, &deviceMemory))
+// HostVisible reports whether the buffer memory can be mapped.
+func (b *Buffer) HostVisible() bool {
+	return b.Allocation.Flags&vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit) != 0
+}
+
+// Map maps the buffer and returns it as a byte slice. The mapping is kept
+// until Unmap, so repeated calls are cheap. Writes and reads through it need
+// Flush and Invalidate unless the memory is coherent.
+func (b *Buffer) Map() ([]byte, error) {
+	if !b.HostVisible() {
+		return nil, fmt.Errorf("Buffer.Map: %s memory is not host visible", b.Intent)
+	}
+	mem, err := b.Allocation.Map()
 	if err != nil {
-		err = fmt.Errorf("vk.AllocateMemory failed with %s", err)
-		return buffer, err
+		return nil, err
 	}
-	var data unsafe.Pointer
-	vk.MapMemory(device, deviceMemory, 0, vk.DeviceSize(vertexData.Sizeof()), 0, &data)
-	n := vk.Memcopy(data, vertexData.Data())
-	if n != vertexData.Sizeof() {
-		log.Println("[WARN] failed to copy vertex buffer data")
+	return mem[:b.Size], nil
+}
+
+func (b *Buffer) Unmap() {
+	b.Allocation.Unmap()
+}
+
+// Upload copies data into the buffer at offset. The buffer must be host visible,
+// a mapping made by Map is reused, otherwise the memory is mapped only for the copy.
+func (b *Buffer) Upload(offset vk.DeviceSize, data []byte) error {
+	if offset+vk.DeviceSize(len(data)) > b.Size {
+		return fmt.Errorf("Buffer.Upload: %d bytes at offset %d overflow buffer of %d bytes", len(data), offset, b.Size)
 	}
-	vk.UnmapMemory(device, deviceMemory)
-	buffer.deviceMemory = deviceMemory
+	err := b.Allocation.access(func(mem []byte) error {
+		copy(mem[offset:], data)
+		return b.Allocation.mappedRangeLocked("vk.FlushMappedMemoryRanges", offset, vk.DeviceSize(len(data)), vk.FlushMappedMemoryRanges)
+	})
+	if err != nil {
+		return fmt.Errorf("Buffer.Upload: %w", err)
+	}
+	return nil
+}
 
-	// Phase 4: vk.BindBufferMemory
-	//			copy vertex data and bind buffer
+// Read copies len(dst) bytes from offset of a host visible buffer into dst,
+// invalidating the range first so device writes are seen.
+func (b *Buffer) Read(offset vk.DeviceSize, dst []byte) error {
+	if offset+vk.DeviceSize(len(dst)) > b.Size {
+		return fmt.Errorf("Buffer.Read: %d bytes at offset %d overflow buffer of %d bytes", len(dst), offset, b.Size)
+	}
+	err := b.Allocation.access(func(mem []byte) error {
+		err := b.Allocation.mappedRangeLocked("vk.InvalidateMappedMemoryRanges", offset, vk.DeviceSize(len(dst)), vk.InvalidateMappedMemoryRanges)
+		if err == nil {
+			copy(dst, mem[offset:])
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Buffer.Read: %w", err)
+	}
+	return nil
+}
+
+// Flush makes host writes through Map visible to the device, see Allocation.Flush.
+func (b *Buffer) Flush(offset, size vk.DeviceSize) error {
+	return b.Allocation.Flush(offset, size)
+}
+
+// Invalidate makes device writes visible through Map, see Allocation.Invalidate.
+func (b *Buffer) Invalidate(offset, size vk.DeviceSize) error {
+	return b.Allocation.Invalidate(offset, size)
+}
+
+// Destroy destroys the buffer and frees its memory.
+func (b *Buffer) Destroy() {
+	if b == nil {
+		return
+	}
+	if b.Handle != vk.NullBuffer {
+		vk.DestroyBuffer(b.device, b.Handle, nil)
+		b.Handle = vk.NullBuffer
+	}
+	if b.Allocation != nil {
+		b.Allocation.Free()
+		b.Allocation = nil
+	}
+}
+
+type VulkanBufferInfo struct {
+	device        vk.Device
+	vertexBuffers []vk.Buffer
+	vertexCount   uint32
+	buffers       []*Buffer
+}
+
+// TriangleVertex is the vertex of the demo triangle.
+type TriangleVertex struct {
+	Position linmath.Vec3 `vk:"location=0"`
+}
+
+// NewBuffer creates the triangle vertex buffer of the demo in device local memory.
+func NewBuffer(ctx context.Context, uploader *Uploader) (VulkanBufferInfo, error) {
 
-	err = vk.Error(vk.BindBufferMemory(device, buffer.DefaultVertexBuffer(), deviceMemory, 0))
+	// Phase 1: NewVertexBuffer
+	//			stage the triangle vertices into a device local buffer
+
+	vertices := []TriangleVertex{
+		{Position: linmath.Vec3{-1, -1, 0}},
+		{Position: linmath.Vec3{1, -1, 0}},
+		{Position: linmath.Vec3{0, 1, 0}},
+	}
+	buffer := VulkanBufferInfo{
+		device: uploader.device,
+	}
+	vertexBuffer, err := NewVertexBuffer(ctx, uploader, vertices)
 	if err != nil {
-		err = fmt.Errorf("vk.BindBufferMemory failed with %s", err)
 		return buffer, err
 	}
-	buffer.device = device
-	return buffer, err
+
+	// Phase 2: Uploader.Flush
+	//			wait for the copy before the buffer is drawn from
+
+	err = uploader.Flush(ctx)
+	if err != nil {
+		vertexBuffer.Destroy()
+		return buffer, err
+	}
+	buffer.buffers = []*Buffer{vertexBuffer.Buffer}
+	buffer.vertexBuffers = []vk.Buffer{vertexBuffer.Handle}
+	buffer.vertexCount = uint32(vertexBuffer.Count)
+	return buffer, nil
 }
 
+// Destroy destroys the buffers together with their memory.
 func (buf *VulkanBufferInfo) Destroy() {
-	for i := range buf.vertexBuffers {
-		vk.DestroyBuffer(buf.device, buf.vertexBuffers[i], nil)
+	for i := range buf.buffers {
+		buf.buffers[i].Destroy()
 	}
+	buf.buffers = nil
+	buf.vertexBuffers = nil
 }
 
 func (buf *VulkanBufferInfo) DefaultVertexBuffer() vk.Buffer {
 	return buf.vertexBuffers[0]
 }
-
-func (buf *VulkanBufferInfo) getDeviceMemory() vk.DeviceMemory {
-	return buf.deviceMemory
-}
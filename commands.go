@@ -0,0 +1,246 @@
+package asch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// CommandPoolSet holds one command pool per worker for every frame in flight.
+// Vulkan command pools are externally synchronized, so each goroutine records
+// only into buffers allocated from its own pool. Buffers are allocated once and
+// reused after the whole pool is reset at the start of a frame.
+type CommandPoolSet struct {
+	device      vk.Device
+	queueFamily uint32
+	frames      [][]commandPool // [frame][worker]
+}
+
+type commandPool struct {
+	pool          vk.CommandPool
+	primary       []vk.CommandBuffer
+	secondary     []vk.CommandBuffer
+	nextPrimary   int
+	nextSecondary int
+}
+
+// Inheritance describes the render pass state secondary command buffers continue.
+// Set RenderPass for classic render passes, or ColorFormats/DepthFormat/StencilFormat
+// for dynamic rendering. The zero value records secondaries outside any render pass.
+type Inheritance struct {
+	RenderPass  vk.RenderPass
+	Subpass     uint32
+	Framebuffer vk.Framebuffer
+
+	ColorFormats  []vk.Format
+	DepthFormat   vk.Format
+	StencilFormat vk.Format
+	Samples       vk.SampleCountFlagBits
+}
+
+func (inh Inheritance) insideRenderPass() bool {
+	return inh.RenderPass != vk.NullRenderPass || inh.dynamicRendering()
+}
+
+func (inh Inheritance) dynamicRendering() bool {
+	return inh.RenderPass == vk.NullRenderPass &&
+		(len(inh.ColorFormats) > 0 || inh.DepthFormat != vk.FormatUndefined || inh.StencilFormat != vk.FormatUndefined)
+}
+
+// RecordFunc records commands into a secondary command buffer that is already begun.
+type RecordFunc func(cmd vk.CommandBuffer) error
+
+func NewCommandPoolSet(device vk.Device, queueFamilyIndex uint32, framesInFlight, workers int) (CommandPoolSet, error) {
+	set := CommandPoolSet{
+		device:      device,
+		queueFamily: queueFamilyIndex,
+	}
+	if framesInFlight < 1 || workers < 1 {
+		err := fmt.Errorf("NewCommandPoolSet: need at least one frame and one worker, got %d and %d", framesInFlight, workers)
+		return set, err
+	}
+	cmdPoolCreateInfo := vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateTransientBit),
+		QueueFamilyIndex: queueFamilyIndex,
+	}
+	set.frames = make([][]commandPool, framesInFlight)
+	for f := range set.frames {
+		set.frames[f] = make([]commandPool, workers)
+		for w := range set.frames[f] {
+			err := vk.Error(vk.CreateCommandPool(device, &cmdPoolCreateInfo, nil, &set.frames[f][w].pool))
+			if err != nil {
+				set.Destroy()
+				err = fmt.Errorf("vk.CreateCommandPool failed with %s", err)
+				return set, err
+			}
+		}
+	}
+	return set, nil
+}
+
+func (s *CommandPoolSet) FramesInFlight() int {
+	return len(s.frames)
+}
+
+func (s *CommandPoolSet) Workers() int {
+	if len(s.frames) == 0 {
+		return 0
+	}
+	return len(s.frames[0])
+}
+
+// Reset resets every worker pool of the frame, making all of its command buffers
+// available again. Call it once the GPU has finished with the frame.
+func (s *CommandPoolSet) Reset(frame int) error {
+	for w := range s.frames[frame] {
+		p := &s.frames[frame][w]
+		err := vk.Error(vk.ResetCommandPool(s.device, p.pool, 0))
+		if err != nil {
+			err = fmt.Errorf("vk.ResetCommandPool failed with %s", err)
+			return err
+		}
+		p.nextPrimary = 0
+		p.nextSecondary = 0
+	}
+	return nil
+}
+
+// Primary returns an unused primary command buffer from the worker pool of the frame.
+func (s *CommandPoolSet) Primary(frame, worker int) (vk.CommandBuffer, error) {
+	p := &s.frames[frame][worker]
+	return p.next(s.device, vk.CommandBufferLevelPrimary, &p.primary, &p.nextPrimary)
+}
+
+// Secondary returns an unused secondary command buffer from the worker pool of the frame.
+func (s *CommandPoolSet) Secondary(frame, worker int) (vk.CommandBuffer, error) {
+	p := &s.frames[frame][worker]
+	return p.next(s.device, vk.CommandBufferLevelSecondary, &p.secondary, &p.nextSecondary)
+}
+
+func (p *commandPool) next(device vk.Device, level vk.CommandBufferLevel, buffers *[]vk.CommandBuffer, next *int) (vk.CommandBuffer, error) {
+	if *next == len(*buffers) {
+		cmd := make([]vk.CommandBuffer, 1)
+		cmdBufferAllocateInfo := vk.CommandBufferAllocateInfo{
+			SType:              vk.StructureTypeCommandBufferAllocateInfo,
+			CommandPool:        p.pool,
+			Level:              level,
+			CommandBufferCount: 1,
+		}
+		err := vk.Error(vk.AllocateCommandBuffers(device, &cmdBufferAllocateInfo, cmd))
+		if err != nil {
+			err = fmt.Errorf("vk.AllocateCommandBuffers failed with %s", err)
+			return nil, err
+		}
+		*buffers = append(*buffers, cmd[0])
+	}
+	cmd := (*buffers)[*next]
+	*next++
+	return cmd, nil
+}
+
+// BeginSecondary takes a secondary command buffer from the worker pool and begins it
+// with inheritance info for the given render pass or dynamic rendering state.
+func (s *CommandPoolSet) BeginSecondary(frame, worker int, inh Inheritance) (vk.CommandBuffer, error) {
+	cmd, err := s.Secondary(frame, worker)
+	if err != nil {
+		return nil, err
+	}
+	inheritanceInfo := vk.CommandBufferInheritanceInfo{
+		SType:       vk.StructureTypeCommandBufferInheritanceInfo,
+		RenderPass:  inh.RenderPass,
+		Subpass:     inh.Subpass,
+		Framebuffer: inh.Framebuffer,
+	}
+	if inh.dynamicRendering() {
+		samples := inh.Samples
+		if samples == 0 {
+			samples = vk.SampleCount1Bit
+		}
+		renderingInfo := vk.CommandBufferInheritanceRenderingInfo{
+			SType:                   vk.StructureTypeCommandBufferInheritanceRenderingInfo,
+			ColorAttachmentCount:    uint32(len(inh.ColorFormats)),
+			PColorAttachmentFormats: inh.ColorFormats,
+			DepthAttachmentFormat:   inh.DepthFormat,
+			StencilAttachmentFormat: inh.StencilFormat,
+			RasterizationSamples:    samples,
+		}
+		ref, _ := renderingInfo.PassRef()
+		defer renderingInfo.Free()
+		inheritanceInfo.PNext = unsafe.Pointer(ref)
+	}
+	cmdBufferBeginInfo := vk.CommandBufferBeginInfo{
+		SType:            vk.StructureTypeCommandBufferBeginInfo,
+		Flags:            vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+		PInheritanceInfo: []vk.CommandBufferInheritanceInfo{inheritanceInfo},
+	}
+	if inh.insideRenderPass() {
+		cmdBufferBeginInfo.Flags |= vk.CommandBufferUsageFlags(vk.CommandBufferUsageRenderPassContinueBit)
+	}
+	err = vk.Error(vk.BeginCommandBuffer(cmd, &cmdBufferBeginInfo))
+	if err != nil {
+		err = fmt.Errorf("vk.BeginCommandBuffer failed with %s", err)
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// RecordParallel fans the tasks out over one goroutine per worker. Every task gets
+// its own secondary command buffer, begun with the inheritance info and ended after
+// the task returns. The buffers are returned in task order, ready for ExecuteSecondary.
+func (s *CommandPoolSet) RecordParallel(frame int, inh Inheritance, tasks []RecordFunc) ([]vk.CommandBuffer, error) {
+	cmds := make([]vk.CommandBuffer, len(tasks))
+	errs := make([]error, len(tasks))
+	workers := min(s.Workers(), len(tasks))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := worker; i < len(tasks); i += workers {
+				cmd, err := s.BeginSecondary(frame, worker, inh)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				if err = tasks[i](cmd); err != nil {
+					errs[i] = fmt.Errorf("record task %d: %w", i, err)
+				}
+				if err = vk.Error(vk.EndCommandBuffer(cmd)); err != nil && errs[i] == nil {
+					errs[i] = fmt.Errorf("vk.EndCommandBuffer failed with %s", err)
+				}
+				cmds[i] = cmd
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cmds, nil
+}
+
+// ExecuteSecondary records the secondary command buffers into the primary one. The render
+// pass must have been begun with vk.SubpassContentsSecondaryCommandBuffers.
+func ExecuteSecondary(primary vk.CommandBuffer, secondaries []vk.CommandBuffer) {
+	if len(secondaries) == 0 {
+		return
+	}
+	vk.CmdExecuteCommands(primary, uint32(len(secondaries)), secondaries)
+}
+
+func (s *CommandPoolSet) Destroy() {
+	for f := range s.frames {
+		for w := range s.frames[f] {
+			if s.frames[f][w].pool != vk.NullCommandPool {
+				// destroying the pool frees all of its command buffers
+				vk.DestroyCommandPool(s.device, s.frames[f][w].pool, nil)
+			}
+		}
+	}
+	s.frames = nil
+}
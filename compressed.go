@@ -0,0 +1,144 @@
+package asch
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// decompressFormat returns the format BC1 to BC5 blocks are decoded into on the CPU.
+func decompressFormat(format vk.Format) (vk.Format, bool) {
+	switch format {
+	case vk.FormatBc1RgbUnormBlock, vk.FormatBc1RgbaUnormBlock, vk.FormatBc2UnormBlock, vk.FormatBc3UnormBlock:
+		return vk.FormatR8g8b8a8Unorm, true
+	case vk.FormatBc1RgbSrgbBlock, vk.FormatBc1RgbaSrgbBlock, vk.FormatBc2SrgbBlock, vk.FormatBc3SrgbBlock:
+		return vk.FormatR8g8b8a8Srgb, true
+	case vk.FormatBc4UnormBlock:
+		return vk.FormatR8Unorm, true
+	case vk.FormatBc5UnormBlock:
+		return vk.FormatR8g8Unorm, true
+	}
+	return vk.FormatUndefined, false
+}
+
+// decompressBlocks decodes the BC1 to BC5 blocks of a width x height x depth image into
+// the texels of decompressFormat.
+func decompressBlocks(format vk.Format, src []byte, width, height, depth uint32) ([]byte, error) {
+	target, ok := decompressFormat(format)
+	if !ok {
+		return nil, fmt.Errorf("decompressBlocks: format %d cannot be decoded on the CPU", format)
+	}
+	channels := 4
+	switch target {
+	case vk.FormatR8Unorm:
+		channels = 1
+	case vk.FormatR8g8Unorm:
+		channels = 2
+	}
+	size := int(formatTable[format].Size)
+	blocksX, blocksY := int(width+3)/4, int(height+3)/4
+	if len(src) != blocksX*blocksY*int(depth)*size {
+		return nil, fmt.Errorf("decompressBlocks: %d bytes do not hold %dx%dx%d texels", len(src), width, height, depth)
+	}
+
+	w, h := int(width), int(height)
+	dst := make([]byte, w*h*int(depth)*channels)
+	var texels [16][4]uint8
+	for z := 0; z < int(depth); z++ {
+		for by := 0; by < blocksY; by++ {
+			for bx := 0; bx < blocksX; bx++ {
+				block := src[((z*blocksY+by)*blocksX+bx)*size:]
+				decodeBlock(format, block, &texels)
+				for i, texel := range texels {
+					x, y := bx*4+i%4, by*4+i/4
+					if x < w && y < h {
+						copy(dst[((z*h+y)*w+x)*channels:], texel[:channels])
+					}
+				}
+			}
+		}
+	}
+	return dst, nil
+}
+
+// decodeBlock decodes the 4x4 texels of a block in row order.
+func decodeBlock(format vk.Format, block []byte, texels *[16][4]uint8) {
+	switch format {
+	case vk.FormatBc1RgbUnormBlock, vk.FormatBc1RgbSrgbBlock:
+		decodeColorBlock(block, texels, false, false)
+	case vk.FormatBc1RgbaUnormBlock, vk.FormatBc1RgbaSrgbBlock:
+		decodeColorBlock(block, texels, false, true)
+	case vk.FormatBc2UnormBlock, vk.FormatBc2SrgbBlock:
+		decodeColorBlock(block[8:], texels, true, false)
+		alpha := binary.LittleEndian.Uint64(block)
+		for i := range texels {
+			texels[i][3] = uint8(alpha>>(4*i)&0xF) * 17
+		}
+	case vk.FormatBc3UnormBlock, vk.FormatBc3SrgbBlock:
+		decodeColorBlock(block[8:], texels, true, false)
+		decodeAlphaBlock(block, texels, 3)
+	case vk.FormatBc4UnormBlock:
+		decodeAlphaBlock(block, texels, 0)
+	case vk.FormatBc5UnormBlock:
+		decodeAlphaBlock(block, texels, 0)
+		decodeAlphaBlock(block[8:], texels, 1)
+	}
+}
+
+// decodeColorBlock decodes the two RGB565 endpoints and 2 bit indices of BC1, which BC2
+// and BC3 always read in four color mode. In three color mode index 3 is black, transparent
+// with punchThrough.
+func decodeColorBlock(block []byte, texels *[16][4]uint8, fourColors, punchThrough bool) {
+	c0, c1 := binary.LittleEndian.Uint16(block), binary.LittleEndian.Uint16(block[2:])
+	var palette [4][4]int
+	palette[0], palette[1] = expand565(c0), expand565(c1)
+	for c := 0; c < 3; c++ {
+		if fourColors || c0 > c1 {
+			palette[2][c] = (2*palette[0][c] + palette[1][c] + 1) / 3
+			palette[3][c] = (palette[0][c] + 2*palette[1][c] + 1) / 3
+		} else {
+			palette[2][c] = (palette[0][c] + palette[1][c]) / 2
+		}
+	}
+	palette[2][3] = 255
+	palette[3][3] = 255
+	if !fourColors && c0 <= c1 && punchThrough {
+		palette[3][3] = 0
+	}
+	indices := binary.LittleEndian.Uint32(block[4:])
+	for i := range texels {
+		p := palette[indices>>(2*i)&3]
+		texels[i] = [4]uint8{uint8(p[0]), uint8(p[1]), uint8(p[2]), uint8(p[3])}
+	}
+}
+
+func expand565(c uint16) [4]int {
+	r, g, b := int(c>>11&31), int(c>>5&63), int(c&31)
+	return [4]int{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, 255}
+}
+
+// decodeAlphaBlock decodes the two endpoints and 3 bit indices of a BC3 alpha or BC4 block
+// into the channel of the texels.
+func decodeAlphaBlock(block []byte, texels *[16][4]uint8, channel int) {
+	a0, a1 := int(block[0]), int(block[1])
+	var palette [8]int
+	palette[0], palette[1] = a0, a1
+	if a0 > a1 {
+		for i := 1; i < 7; i++ {
+			palette[i+1] = ((7-i)*a0 + i*a1 + 3) / 7
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			palette[i+1] = ((5-i)*a0 + i*a1 + 2) / 5
+		}
+		palette[6], palette[7] = 0, 255
+	}
+	var indices uint64
+	for i := 0; i < 6; i++ {
+		indices |= uint64(block[2+i]) << (8 * i)
+	}
+	for i := range texels {
+		texels[i][channel] = uint8(palette[indices>>(3*i)&7])
+	}
+}
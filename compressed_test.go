@@ -0,0 +1,137 @@
+package asch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// colorBlock returns a BC1 block of two RGB565 endpoints with every texel at index.
+func colorBlock(c0, c1 uint16, index uint32) []byte {
+	block := make([]byte, 8)
+	binary.LittleEndian.PutUint16(block, c0)
+	binary.LittleEndian.PutUint16(block[2:], c1)
+	var indices uint32
+	for i := 0; i < 16; i++ {
+		indices |= index << (2 * i)
+	}
+	binary.LittleEndian.PutUint32(block[4:], indices)
+	return block
+}
+
+// alphaBlock returns a BC4 block of two endpoints with every texel at index.
+func alphaBlock(a0, a1 uint8, index uint64) []byte {
+	block := []byte{a0, a1, 0, 0, 0, 0, 0, 0}
+	var indices uint64
+	for i := 0; i < 16; i++ {
+		indices |= index << (3 * i)
+	}
+	for i := 0; i < 6; i++ {
+		block[2+i] = byte(indices >> (8 * i))
+	}
+	return block
+}
+
+const (
+	red565  = 0xF800
+	blue565 = 0x001F
+)
+
+func TestDecodeBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		format vk.Format
+		block  []byte
+		want   [4]uint8
+	}{
+		{"BC1 endpoint 0", vk.FormatBc1RgbaUnormBlock, colorBlock(red565, blue565, 0), [4]uint8{255, 0, 0, 255}},
+		{"BC1 endpoint 1", vk.FormatBc1RgbaUnormBlock, colorBlock(red565, blue565, 1), [4]uint8{0, 0, 255, 255}},
+		{"BC1 four colors", vk.FormatBc1RgbaUnormBlock, colorBlock(red565, blue565, 2), [4]uint8{170, 0, 85, 255}},
+		{"BC1 three colors", vk.FormatBc1RgbaUnormBlock, colorBlock(blue565, red565, 2), [4]uint8{127, 0, 127, 255}},
+		{"BC1 punch through", vk.FormatBc1RgbaUnormBlock, colorBlock(blue565, red565, 3), [4]uint8{0, 0, 0, 0}},
+		{"BC1 RGB black", vk.FormatBc1RgbUnormBlock, colorBlock(blue565, red565, 3), [4]uint8{0, 0, 0, 255}},
+		{"BC2", vk.FormatBc2UnormBlock, append(bytes.Repeat([]byte{0x88}, 8), colorBlock(blue565, red565, 2)...),
+			[4]uint8{85, 0, 170, 136}},
+		{"BC3", vk.FormatBc3UnormBlock, append(alphaBlock(255, 0, 2), colorBlock(red565, blue565, 1)...),
+			[4]uint8{0, 0, 255, 219}},
+		{"BC4 six values", vk.FormatBc4UnormBlock, alphaBlock(255, 0, 2), [4]uint8{219}},
+		{"BC4 four values", vk.FormatBc4UnormBlock, alphaBlock(0, 255, 2), [4]uint8{51}},
+		{"BC4 zero", vk.FormatBc4UnormBlock, alphaBlock(0, 255, 6), [4]uint8{0}},
+		{"BC4 one", vk.FormatBc4UnormBlock, alphaBlock(0, 255, 7), [4]uint8{255}},
+		{"BC5", vk.FormatBc5UnormBlock, append(alphaBlock(255, 0, 0), alphaBlock(255, 0, 1)...), [4]uint8{255, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var texels [16][4]uint8
+			decodeBlock(tt.format, tt.block, &texels)
+			for i, texel := range texels {
+				if texel != tt.want {
+					t.Fatalf("texel %d = %v, want %v", i, texel, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecompressBlocks(t *testing.T) {
+	// 6x2 texels are two blocks wide, the texels past the extent are dropped
+	src := append(colorBlock(red565, blue565, 0), colorBlock(red565, blue565, 1)...)
+	dst, err := decompressBlocks(vk.FormatBc1RgbaSrgbBlock, src, 6, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dst) != 6*2*4 {
+		t.Fatalf("decompressBlocks returned %d bytes, want %d", len(dst), 6*2*4)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 6; x++ {
+			want := []byte{255, 0, 0, 255}
+			if x >= 4 {
+				want = []byte{0, 0, 255, 255}
+			}
+			if texel := dst[(y*6+x)*4:][:4]; !bytes.Equal(texel, want) {
+				t.Errorf("texel %d,%d = %v, want %v", x, y, texel, want)
+			}
+		}
+	}
+
+	dst, err = decompressBlocks(vk.FormatBc4UnormBlock, alphaBlock(255, 0, 0), 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst, []byte{255}) {
+		t.Errorf("BC4 texel = %v, want [255]", dst)
+	}
+}
+
+func TestDecompressBlocksErrors(t *testing.T) {
+	if _, err := decompressBlocks(vk.FormatBc1RgbaUnormBlock, make([]byte, 8), 8, 4, 1); err == nil {
+		t.Errorf("decompressBlocks accepted too few blocks")
+	}
+	if _, err := decompressBlocks(vk.FormatBc7UnormBlock, make([]byte, 16), 4, 4, 1); err == nil {
+		t.Errorf("decompressBlocks accepted BC7")
+	}
+}
+
+func TestDecompressFormat(t *testing.T) {
+	tests := []struct {
+		format vk.Format
+		want   vk.Format
+		ok     bool
+	}{
+		{vk.FormatBc1RgbUnormBlock, vk.FormatR8g8b8a8Unorm, true},
+		{vk.FormatBc3SrgbBlock, vk.FormatR8g8b8a8Srgb, true},
+		{vk.FormatBc4UnormBlock, vk.FormatR8Unorm, true},
+		{vk.FormatBc5UnormBlock, vk.FormatR8g8Unorm, true},
+		{vk.FormatBc4SnormBlock, vk.FormatUndefined, false},
+		{vk.FormatBc6hUfloatBlock, vk.FormatUndefined, false},
+	}
+	for _, tt := range tests {
+		got, ok := decompressFormat(tt.format)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("decompressFormat(%d) = %d, %t, want %d, %t", tt.format, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// Cube map faces in the order of their array layers.
+const (
+	CubeFacePositiveX = iota
+	CubeFaceNegativeX
+	CubeFacePositiveY
+	CubeFaceNegativeY
+	CubeFacePositiveZ
+	CubeFaceNegativeZ
+)
+
+// CubeLayer returns the array layer of a face of a cube in a cube map array.
+func CubeLayer(cube, face uint32) uint32 {
+	return cube*6 + face
+}
+
+// UploadImage uploads src into level 0 of a layer or face of dst, converted to the image
+// format like CreateTexture does. srgb tells src holds sRGB encoded color.
+func (u *Uploader) UploadImage(ctx context.Context, dst *Image, layer uint32, src image.Image, srgb bool) error {
+	bounds := src.Bounds()
+	if uint32(bounds.Dx()) != dst.Extent.Width || uint32(bounds.Dy()) != dst.Extent.Height {
+		return fmt.Errorf("UploadImage: image of %dx%d does not match the %dx%d extent", bounds.Dx(), bounds.Dy(), dst.Extent.Width, dst.Extent.Height)
+	}
+	data, err := encodePixels(src, dst.Format, srgb)
+	if err != nil {
+		return err
+	}
+	return u.UploadImageData(ctx, dst, 0, layer, data)
+}
+
+// CreateCubemap creates a sampled cube map from six square images of the same size, given
+// in the order of the CubeFace constants. The options are those of CreateTexture.
+func (u *Uploader) CreateCubemap(ctx context.Context, faces [6]image.Image, opts TextureOptions) (*Image, error) {
+	size := faces[0].Bounds().Size()
+	for face, src := range faces {
+		if src.Bounds().Size() != size || size.X != size.Y {
+			return nil, fmt.Errorf("CreateCubemap: face %d of %v, faces must be squares of the same size", face, src.Bounds().Size())
+		}
+	}
+	format := opts.Format
+	if format == vk.FormatUndefined {
+		var err error
+		if format, err = u.sampledTextureFormat(faces[0], opts.SRGB); err != nil {
+			return nil, fmt.Errorf("CreateCubemap: %w", err)
+		}
+	}
+	info := ImageCreateInfo{
+		Format: format,
+		Width:  uint32(size.X),
+		Height: uint32(size.Y),
+		Layers: 6,
+		Cube:   true,
+		Usage:  opts.Usage | vk.ImageUsageFlags(vk.ImageUsageSampledBit|vk.ImageUsageTransferDstBit),
+	}
+	if opts.Mipmaps {
+		info.MipLevels = MipLevelsAuto
+		info.Usage |= vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit)
+	}
+	img, err := u.allocator.CreateImage(info)
+	if err != nil {
+		return nil, err
+	}
+	bases := make([][]byte, 6)
+	for face, src := range faces {
+		if bases[face], err = encodePixels(src, format, opts.SRGB); err != nil {
+			img.Destroy()
+			return nil, err
+		}
+		if err = u.UploadImageData(ctx, img, 0, uint32(face), bases[face]); err != nil {
+			img.Destroy()
+			return nil, err
+		}
+	}
+	if err = u.generateMipmaps(ctx, img, bases); err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	return img, nil
+}
+
+// equirectFormat is the storage image format written by shaders/equirect.comp.
+const equirectFormat = vk.FormatR16g16b16a16Sfloat
+
+// CreateCubemapFromEquirect converts src, an equirectangular panorama made by CreateTexture
+// or LoadTexture, into a cube map with faces of size x size texels in
+// vk.FormatR16g16b16a16Sfloat. The conversion runs in a compute shader on the graphics
+// queue, the top row of the panorama becoming +Y. Zero size picks a quarter of the panorama
+// width. The uploader is flushed before returning, so src may be destroyed afterwards.
+// opts.Usage and opts.Mipmaps apply, the other options are ignored.
+func (u *Uploader) CreateCubemapFromEquirect(ctx context.Context, src *Image, size uint32, opts TextureOptions) (*Image, error) {
+	if size == 0 {
+		size = max(src.Extent.Width/4, 1)
+	}
+	if src.Usage&vk.ImageUsageFlags(vk.ImageUsageSampledBit) == 0 {
+		return nil, fmt.Errorf("CreateCubemapFromEquirect: panorama was not created with vk.ImageUsageSampledBit")
+	}
+	features := vk.FormatFeatureFlags(vk.FormatFeatureStorageImageBit | vk.FormatFeatureSampledImageBit)
+	if !u.allocator.FormatSupported(equirectFormat, features) {
+		return nil, fmt.Errorf("CreateCubemapFromEquirect: storage images of format %d are not supported", equirectFormat)
+	}
+	if opts.Mipmaps && !u.allocator.CanBlitMipmaps(equirectFormat) {
+		// the CPU fallback of generateMipmaps needs level 0 on the host
+		return nil, fmt.Errorf("CreateCubemapFromEquirect: format %d cannot be blitted into mipmaps", equirectFormat)
+	}
+
+	// Phase 1: Allocator.CreateImage
+	//			with a 2D array view of level 0 for the shader to write
+
+	info := ImageCreateInfo{
+		Format: equirectFormat,
+		Width:  size,
+		Height: size,
+		Layers: 6,
+		Cube:   true,
+		Usage:  opts.Usage | vk.ImageUsageFlags(vk.ImageUsageSampledBit|vk.ImageUsageStorageBit),
+	}
+	if opts.Mipmaps {
+		info.MipLevels = MipLevelsAuto
+		info.Usage |= vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit | vk.ImageUsageTransferDstBit)
+	}
+	img, err := u.allocator.CreateImage(info)
+	if err != nil {
+		return nil, err
+	}
+	conv := equirectConverter{device: u.device}
+	defer conv.destroy()
+	conv.storageView, err = img.newView(ImageViewInfo{Type: vk.ImageViewType2dArray, Levels: 1})
+	if err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	sampler, err := u.samplers.Get(SamplerDesc{
+		MagFilter: vk.FilterLinear,
+		MinFilter: vk.FilterLinear,
+		AddressU:  vk.SamplerAddressModeRepeat,
+		AddressV:  vk.SamplerAddressModeClampToEdge,
+		AddressW:  vk.SamplerAddressModeClampToEdge,
+	})
+	if err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	if err = conv.init(src.View, sampler); err != nil {
+		img.Destroy()
+		return nil, err
+	}
+
+	// Phase 2: vk.CmdDispatch
+	//			recorded on the graphics queue once src is acquired, level 0 in the general
+	//			layout while written
+
+	u.mu.Lock()
+	if err = u.begin(ctx); err != nil {
+		u.mu.Unlock()
+		img.Destroy()
+		return nil, err
+	}
+	family := u.graphics.Family()
+	u.graphicsWork = append(u.graphicsWork, func(cmd vk.CommandBuffer) error {
+		return conv.record(cmd, family, src, img, size)
+	})
+	u.mu.Unlock()
+	if opts.Mipmaps {
+		if err = u.generateMipmaps(ctx, img, nil); err != nil {
+			// the queued dispatch uses img and the converter, run it before they go
+			u.Flush(context.Background())
+			img.Destroy()
+			return nil, err
+		}
+	}
+
+	// Phase 3: Uploader.Flush
+	//			the converter objects can go once the GPU is done with them
+
+	if err = u.Flush(ctx); err != nil {
+		u.mu.Lock()
+		u.wait(context.Background())
+		u.mu.Unlock()
+		img.Destroy()
+		return nil, err
+	}
+	return img, nil
+}
+
+// equirectConverter holds the compute pipeline of shaders/equirect.comp.
+type equirectConverter struct {
+	device      vk.Device
+	storageView vk.ImageView
+	setLayout   vk.DescriptorSetLayout
+	pool        vk.DescriptorPool
+	set         vk.DescriptorSet
+	layout      vk.PipelineLayout
+	module      vk.ShaderModule
+	pipeline    vk.Pipeline
+}
+
+func (c *equirectConverter) init(src vk.ImageView, sampler vk.Sampler) error {
+
+	// Phase 1: vk.CreateDescriptorSetLayout
+	//			vk.CreateDescriptorPool
+	//			vk.AllocateDescriptorSets
+
+	setLayoutBindings := []vk.DescriptorSetLayoutBinding{{
+		Binding:         0,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+		StageFlags:      vk.ShaderStageFlags(vk.ShaderStageComputeBit),
+	}, {
+		Binding:         1,
+		DescriptorType:  vk.DescriptorTypeStorageImage,
+		DescriptorCount: 1,
+		StageFlags:      vk.ShaderStageFlags(vk.ShaderStageComputeBit),
+	}}
+	setLayoutCreateInfo := vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: uint32(len(setLayoutBindings)),
+		PBindings:    setLayoutBindings,
+	}
+	err := vk.Error(vk.CreateDescriptorSetLayout(c.device, &setLayoutCreateInfo, nil, &c.setLayout))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateDescriptorSetLayout failed with %s", err)
+		return err
+	}
+	poolSizes := []vk.DescriptorPoolSize{{
+		Type:            vk.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: 1,
+	}, {
+		Type:            vk.DescriptorTypeStorageImage,
+		DescriptorCount: 1,
+	}}
+	poolCreateInfo := vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       1,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+	err = vk.Error(vk.CreateDescriptorPool(c.device, &poolCreateInfo, nil, &c.pool))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateDescriptorPool failed with %s", err)
+		return err
+	}
+	setAllocateInfo := vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     c.pool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{c.setLayout},
+	}
+	err = vk.Error(vk.AllocateDescriptorSets(c.device, &setAllocateInfo, &c.set))
+	if err != nil {
+		err = fmt.Errorf("vk.AllocateDescriptorSets failed with %s", err)
+		return err
+	}
+
+	// Phase 2: vk.UpdateDescriptorSets
+
+	writes := []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          c.set,
+		DstBinding:      0,
+		DescriptorCount: 1,
+		DescriptorType:  vk.DescriptorTypeCombinedImageSampler,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			Sampler:     sampler,
+			ImageView:   src,
+			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+		}},
+	}, {
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          c.set,
+		DstBinding:      1,
+		DescriptorCount: 1,
+		DescriptorType:  vk.DescriptorTypeStorageImage,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			ImageView:   c.storageView,
+			ImageLayout: vk.ImageLayoutGeneral,
+		}},
+	}}
+	vk.UpdateDescriptorSets(c.device, uint32(len(writes)), writes, 0, nil)
+
+	// Phase 3: vk.CreatePipelineLayout
+	//			vk.CreateComputePipelines
+
+	pipelineLayoutCreateInfo := vk.PipelineLayoutCreateInfo{
+		SType:          vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount: 1,
+		PSetLayouts:    []vk.DescriptorSetLayout{c.setLayout},
+	}
+	err = vk.Error(vk.CreatePipelineLayout(c.device, &pipelineLayoutCreateInfo, nil, &c.layout))
+	if err != nil {
+		err = fmt.Errorf("vk.CreatePipelineLayout failed with %s", err)
+		return err
+	}
+	c.module, err = LoadShader(c.device, "shaders/equirect-comp.spv")
+	if err != nil {
+		return err
+	}
+	pipelineCreateInfos := []vk.ComputePipelineCreateInfo{{
+		SType: vk.StructureTypeComputePipelineCreateInfo,
+		Stage: vk.PipelineShaderStageCreateInfo{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageComputeBit,
+			Module: c.module,
+			PName:  "main\x00",
+		},
+		Layout: c.layout,
+	}}
+	pipelines := make([]vk.Pipeline, 1)
+	err = vk.Error(vk.CreateComputePipelines(c.device, vk.NullPipelineCache, 1, pipelineCreateInfos, nil, pipelines))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateComputePipelines failed with %s", err)
+		return err
+	}
+	c.pipeline = pipelines[0]
+	return nil
+}
+
+// record writes level 0 of every face and leaves it shader readable.
+func (c *equirectConverter) record(cmd vk.CommandBuffer, family uint32, src, img *Image, size uint32) error {
+	barriers := NewBarriers(family)
+	barriers.Image(src, ImageRange{}, StateComputeShaderRead)
+	barriers.DiscardImage(img, ImageRange{Levels: 1}, StateComputeShaderWrite)
+	if err := barriers.Record(cmd); err != nil {
+		return fmt.Errorf("CreateCubemapFromEquirect: %w", err)
+	}
+	vk.CmdBindPipeline(cmd, vk.PipelineBindPointCompute, c.pipeline)
+	vk.CmdBindDescriptorSets(cmd, vk.PipelineBindPointCompute, c.layout, 0, 1, []vk.DescriptorSet{c.set}, 0, nil)
+	groups := (size + 7) / 8
+	vk.CmdDispatch(cmd, groups, groups, 6)
+	barriers.Image(img, ImageRange{Levels: 1}, StateShaderRead)
+	if err := barriers.Record(cmd); err != nil {
+		return fmt.Errorf("CreateCubemapFromEquirect: %w", err)
+	}
+	return nil
+}
+
+func (c *equirectConverter) destroy() {
+	if c.pipeline != vk.NullPipeline {
+		vk.DestroyPipeline(c.device, c.pipeline, nil)
+	}
+	if c.module != vk.NullShaderModule {
+		vk.DestroyShaderModule(c.device, c.module, nil)
+	}
+	if c.layout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(c.device, c.layout, nil)
+	}
+	if c.pool != vk.NullDescriptorPool {
+		vk.DestroyDescriptorPool(c.device, c.pool, nil)
+	}
+	if c.setLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(c.device, c.setLayout, nil)
+	}
+	if c.storageView != vk.NullImageView {
+		vk.DestroyImageView(c.device, c.storageView, nil)
+	}
+}
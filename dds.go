@@ -0,0 +1,201 @@
+package asch
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+const (
+	ddsMagic      = "DDS "
+	ddsHeaderSize = 4 + 124
+	ddsDX10Size   = 20
+
+	ddsFlagMipMapCount = 0x20000
+	ddsFlagDepth       = 0x800000
+
+	ddsPixelAlphaPixels = 0x1
+	ddsPixelFourCC      = 0x4
+	ddsPixelRGB         = 0x40
+	ddsPixelLuminance   = 0x20000
+
+	ddsCaps2Cubemap  = 0x200
+	ddsCaps2AllFaces = 0xFC00
+	ddsCaps2Volume   = 0x200000
+
+	ddsDX10Texture1D = 2
+	ddsDX10Texture3D = 4
+	ddsDX10MiscCube  = 0x4
+)
+
+// dxgiFormats maps the DXGI_FORMAT of DX10 headers.
+var dxgiFormats = map[uint32]vk.Format{
+	2:  vk.FormatR32g32b32a32Sfloat,
+	10: vk.FormatR16g16b16a16Sfloat,
+	11: vk.FormatR16g16b16a16Unorm,
+	16: vk.FormatR32g32Sfloat,
+	24: vk.FormatA2b10g10r10UnormPack32,
+	26: vk.FormatB10g11r11UfloatPack32,
+	28: vk.FormatR8g8b8a8Unorm,
+	29: vk.FormatR8g8b8a8Srgb,
+	34: vk.FormatR16g16Sfloat,
+	41: vk.FormatR32Sfloat,
+	49: vk.FormatR8g8Unorm,
+	54: vk.FormatR16Sfloat,
+	56: vk.FormatR16Unorm,
+	61: vk.FormatR8Unorm,
+	67: vk.FormatE5b9g9r9UfloatPack32,
+	71: vk.FormatBc1RgbaUnormBlock,
+	72: vk.FormatBc1RgbaSrgbBlock,
+	74: vk.FormatBc2UnormBlock,
+	75: vk.FormatBc2SrgbBlock,
+	77: vk.FormatBc3UnormBlock,
+	78: vk.FormatBc3SrgbBlock,
+	80: vk.FormatBc4UnormBlock,
+	81: vk.FormatBc4SnormBlock,
+	83: vk.FormatBc5UnormBlock,
+	84: vk.FormatBc5SnormBlock,
+	87: vk.FormatB8g8r8a8Unorm,
+	91: vk.FormatB8g8r8a8Srgb,
+	95: vk.FormatBc6hUfloatBlock,
+	96: vk.FormatBc6hSfloatBlock,
+	98: vk.FormatBc7UnormBlock,
+	99: vk.FormatBc7SrgbBlock,
+}
+
+// fourCCFormats maps the FourCC codes of headers without DX10 extension.
+// D3DFMT values stored as FourCC are numbers.
+var fourCCFormats = map[string]vk.Format{
+	"DXT1": vk.FormatBc1RgbaUnormBlock,
+	"DXT2": vk.FormatBc2UnormBlock,
+	"DXT3": vk.FormatBc2UnormBlock,
+	"DXT4": vk.FormatBc3UnormBlock,
+	"DXT5": vk.FormatBc3UnormBlock,
+	"ATI1": vk.FormatBc4UnormBlock,
+	"BC4U": vk.FormatBc4UnormBlock,
+	"BC4S": vk.FormatBc4SnormBlock,
+	"ATI2": vk.FormatBc5UnormBlock,
+	"BC5U": vk.FormatBc5UnormBlock,
+	"BC5S": vk.FormatBc5SnormBlock,
+
+	"\x24\x00\x00\x00": vk.FormatR16g16b16a16Unorm,
+	"\x6F\x00\x00\x00": vk.FormatR16Sfloat,
+	"\x70\x00\x00\x00": vk.FormatR16g16Sfloat,
+	"\x71\x00\x00\x00": vk.FormatR16g16b16a16Sfloat,
+	"\x72\x00\x00\x00": vk.FormatR32Sfloat,
+	"\x73\x00\x00\x00": vk.FormatR32g32Sfloat,
+	"\x74\x00\x00\x00": vk.FormatR32g32b32a32Sfloat,
+}
+
+// DecodeDDS decodes a DDS file, with or without the DX10 header extension.
+// Legacy headers do not record sRGB, see TextureOptions.SRGB.
+func DecodeDDS(data []byte) (*TextureData, error) {
+	if len(data) < ddsHeaderSize || string(data[:4]) != ddsMagic {
+		return nil, fmt.Errorf("DecodeDDS: not a DDS file")
+	}
+	le := binary.LittleEndian
+	header := data[4:]
+	flags := le.Uint32(header[4:])
+	td := &TextureData{
+		Height: max(le.Uint32(header[8:]), 1),
+		Width:  le.Uint32(header[12:]),
+		Depth:  1,
+		Layers: 1,
+		Faces:  1,
+	}
+	if td.Width == 0 {
+		return nil, fmt.Errorf("DecodeDDS: texture is empty")
+	}
+	levels := uint32(1)
+	if flags&ddsFlagMipMapCount != 0 {
+		levels = max(le.Uint32(header[24:]), 1)
+	}
+	caps2 := le.Uint32(header[108:])
+	pixelFlags := le.Uint32(header[76:])
+	fourCC := string(header[80:84])
+	offset := ddsHeaderSize
+
+	// Phase 1: format and dimensions from the DX10 extension or the legacy pixel format
+
+	var ok bool
+	switch {
+	case pixelFlags&ddsPixelFourCC != 0 && fourCC == "DX10":
+		if len(data) < ddsHeaderSize+ddsDX10Size {
+			return nil, fmt.Errorf("DecodeDDS: DX10 header is truncated")
+		}
+		dx10 := data[ddsHeaderSize:]
+		offset += ddsDX10Size
+		dxgi := le.Uint32(dx10)
+		if td.Format, ok = dxgiFormats[dxgi]; !ok {
+			return nil, fmt.Errorf("DecodeDDS: DXGI format %d is not supported", dxgi)
+		}
+		switch le.Uint32(dx10[4:]) {
+		case ddsDX10Texture1D:
+			return nil, fmt.Errorf("DecodeDDS: 1D textures are not supported")
+		case ddsDX10Texture3D:
+			td.Depth = max(le.Uint32(header[20:]), 1)
+		}
+		td.Layers = max(le.Uint32(dx10[12:]), 1)
+		if le.Uint32(dx10[8:])&ddsDX10MiscCube != 0 {
+			td.Faces = 6
+		}
+	case pixelFlags&ddsPixelFourCC != 0:
+		if td.Format, ok = fourCCFormats[fourCC]; !ok {
+			return nil, fmt.Errorf("DecodeDDS: FourCC %q is not supported", fourCC)
+		}
+	case pixelFlags&ddsPixelRGB != 0 && le.Uint32(header[84:]) == 32:
+		r, b, a := le.Uint32(header[88:]), le.Uint32(header[96:]), le.Uint32(header[100:])
+		switch {
+		case r == 0xFF && b == 0xFF0000 && (a == 0xFF000000 || pixelFlags&ddsPixelAlphaPixels == 0):
+			td.Format = vk.FormatR8g8b8a8Unorm
+		case r == 0xFF0000 && b == 0xFF && (a == 0xFF000000 || pixelFlags&ddsPixelAlphaPixels == 0):
+			td.Format = vk.FormatB8g8r8a8Unorm
+		default:
+			return nil, fmt.Errorf("DecodeDDS: 32 bit pixel masks %#x %#x %#x are not supported", r, b, a)
+		}
+	case pixelFlags&ddsPixelLuminance != 0 && le.Uint32(header[84:]) == 8:
+		td.Format = vk.FormatR8Unorm
+	default:
+		return nil, fmt.Errorf("DecodeDDS: pixel format %#x is not supported", pixelFlags)
+	}
+	if fourCC != "DX10" {
+		if caps2&ddsCaps2Cubemap != 0 {
+			if caps2&ddsCaps2AllFaces != ddsCaps2AllFaces {
+				return nil, fmt.Errorf("DecodeDDS: cube maps missing faces are not supported")
+			}
+			td.Faces = 6
+		}
+		if flags&ddsFlagDepth != 0 && caps2&ddsCaps2Volume != 0 {
+			td.Depth = max(le.Uint32(header[20:]), 1)
+		}
+	}
+	if levels > MipLevelsFor(td.Width, max(td.Height, td.Depth)) {
+		return nil, fmt.Errorf("DecodeDDS: %d mip levels exceed the %dx%dx%d extent", levels, td.Width, td.Height, td.Depth)
+	}
+
+	if uint64(td.Layers)*uint64(td.Faces) > uint64(len(data)) {
+		return nil, fmt.Errorf("DecodeDDS: %d layers exceed the file", td.Layers)
+	}
+
+	// Phase 2: images follow each other layer by layer and face by face, each with all its mips
+
+	format := formatTable[td.Format]
+	images := td.Layers * td.Faces
+	td.Levels = make([][][]byte, levels)
+	for level := range td.Levels {
+		td.Levels[level] = make([][]byte, images)
+	}
+	for image := range images {
+		for level := range levels {
+			w, h, d := max(td.Width>>level, 1), max(td.Height>>level, 1), max(td.Depth>>level, 1)
+			size := uint64((w+format.BlockWidth-1)/format.BlockWidth) * uint64((h+format.BlockHeight-1)/format.BlockHeight) * uint64(d) * uint64(format.Size)
+			if uint64(len(data)-offset) < size {
+				return nil, fmt.Errorf("DecodeDDS: level %d of image %d is truncated", level, image)
+			}
+			td.Levels[level][image] = data[offset : offset+int(size)]
+			offset += int(size)
+		}
+	}
+	return td, nil
+}
@@ -0,0 +1,90 @@
+package asch
+
+import (
+	"sync"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// DeletionQueue defers the destruction of resources until the GPU has finished with them.
+// Every entry is queued with the point that last used the resource: a frame number or
+// a Timeline value. Collect releases everything up to the point the GPU has completed.
+type DeletionQueue struct {
+	mu      sync.Mutex
+	entries []deletion
+}
+
+type deletion struct {
+	point   uint64
+	destroy func()
+}
+
+func NewDeletionQueue() *DeletionQueue {
+	return &DeletionQueue{}
+}
+
+// Push queues destroy to run once the GPU has passed point.
+func (q *DeletionQueue) Push(point uint64, destroy func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries = append(q.entries, deletion{point: point, destroy: destroy})
+}
+
+// PushBuffer queues a buffer together with its memory.
+func (q *DeletionQueue) PushBuffer(point uint64, buffer *Buffer) {
+	q.Push(point, buffer.Destroy)
+}
+
+// PushImage queues an image together with its view and memory.
+func (q *DeletionQueue) PushImage(point uint64, img *Image) {
+	q.Push(point, img.Destroy)
+}
+
+// PushPipeline queues a pipeline, the layout is left alone as pipelines often share it.
+func (q *DeletionQueue) PushPipeline(point uint64, device vk.Device, pipeline vk.Pipeline) {
+	q.Push(point, func() {
+		vk.DestroyPipeline(device, pipeline, nil)
+	})
+}
+
+// Collect destroys, in queueing order, every resource whose point is at or below completed
+// and returns how many were released.
+func (q *DeletionQueue) Collect(completed uint64) int {
+	q.mu.Lock()
+	var ready []deletion
+	kept := q.entries[:0]
+	for _, e := range q.entries {
+		if e.point <= completed {
+			ready = append(ready, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	clear(q.entries[len(kept):])
+	q.entries = kept
+	q.mu.Unlock()
+
+	// destroy outside the lock, a destroy func may queue further deletions
+	for _, e := range ready {
+		e.destroy()
+	}
+	return len(ready)
+}
+
+// CollectTimeline releases everything the timeline has passed.
+func (q *DeletionQueue) CollectTimeline(t *Timeline) int {
+	return q.Collect(t.GetValue())
+}
+
+// Flush destroys everything regardless of its point. The device must be idle.
+func (q *DeletionQueue) Flush() {
+	for q.Len() > 0 {
+		q.Collect(^uint64(0))
+	}
+}
+
+func (q *DeletionQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
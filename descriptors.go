@@ -0,0 +1,516 @@
+package asch
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// DescriptorBinding is one binding of a descriptor set layout.
+type DescriptorBinding struct {
+	Binding uint32
+	Type    vk.DescriptorType
+	// Count is the array size, zero means 1.
+	Count  uint32
+	Stages vk.ShaderStageFlags
+}
+
+// DescriptorSetLayoutBuilder collects the bindings of a descriptor set layout.
+type DescriptorSetLayoutBuilder struct {
+	bindings []DescriptorBinding
+}
+
+// NewDescriptorSetLayoutBuilder returns an empty builder.
+func NewDescriptorSetLayoutBuilder() *DescriptorSetLayoutBuilder {
+	return &DescriptorSetLayoutBuilder{}
+}
+
+// Add adds a binding of count descriptors.
+func (b *DescriptorSetLayoutBuilder) Add(binding uint32, descriptorType vk.DescriptorType, count uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	b.bindings = append(b.bindings, DescriptorBinding{Binding: binding, Type: descriptorType, Count: count, Stages: stages})
+	return b
+}
+
+// UniformBuffer adds a uniform buffer binding.
+func (b *DescriptorSetLayoutBuilder) UniformBuffer(binding uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	return b.Add(binding, vk.DescriptorTypeUniformBuffer, 1, stages)
+}
+
+// StorageBuffer adds a storage buffer binding.
+func (b *DescriptorSetLayoutBuilder) StorageBuffer(binding uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	return b.Add(binding, vk.DescriptorTypeStorageBuffer, 1, stages)
+}
+
+// Texture adds a combined image sampler binding.
+func (b *DescriptorSetLayoutBuilder) Texture(binding uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	return b.Add(binding, vk.DescriptorTypeCombinedImageSampler, 1, stages)
+}
+
+// SampledImage adds a sampled image binding, to be used with a separate sampler.
+func (b *DescriptorSetLayoutBuilder) SampledImage(binding uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	return b.Add(binding, vk.DescriptorTypeSampledImage, 1, stages)
+}
+
+// Sampler adds a sampler binding.
+func (b *DescriptorSetLayoutBuilder) Sampler(binding uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	return b.Add(binding, vk.DescriptorTypeSampler, 1, stages)
+}
+
+// StorageImage adds a storage image binding.
+func (b *DescriptorSetLayoutBuilder) StorageImage(binding uint32, stages vk.ShaderStageFlags) *DescriptorSetLayoutBuilder {
+	return b.Add(binding, vk.DescriptorTypeStorageImage, 1, stages)
+}
+
+// Bindings returns the bindings added so far.
+func (b *DescriptorSetLayoutBuilder) Bindings() []DescriptorBinding {
+	return b.bindings
+}
+
+// Build returns the layout of the bindings from the cache.
+func (b *DescriptorSetLayoutBuilder) Build(cache *DescriptorLayoutCache) (vk.DescriptorSetLayout, error) {
+	return cache.Get(b.bindings...)
+}
+
+// DescriptorLayoutCache deduplicates descriptor set layouts by their bindings, so equal
+// descriptions share a layout and the sets allocated from them are compatible.
+type DescriptorLayoutCache struct {
+	mu       sync.Mutex
+	device   vk.Device
+	layouts  map[string]vk.DescriptorSetLayout
+	bindings map[vk.DescriptorSetLayout][]DescriptorBinding
+}
+
+func NewDescriptorLayoutCache(device vk.Device) *DescriptorLayoutCache {
+	return &DescriptorLayoutCache{
+		device:   device,
+		layouts:  make(map[string]vk.DescriptorSetLayout),
+		bindings: make(map[vk.DescriptorSetLayout][]DescriptorBinding),
+	}
+}
+
+// Get returns the layout of the bindings, in any order, creating it on first use.
+func (c *DescriptorLayoutCache) Get(bindings ...DescriptorBinding) (vk.DescriptorSetLayout, error) {
+	bindings = slices.Clone(bindings)
+	for i := range bindings {
+		bindings[i].Count = max(bindings[i].Count, 1)
+	}
+	slices.SortFunc(bindings, func(a, b DescriptorBinding) int {
+		return cmp.Compare(a.Binding, b.Binding)
+	})
+	for i := 1; i < len(bindings); i++ {
+		if bindings[i].Binding == bindings[i-1].Binding {
+			return vk.NullDescriptorSetLayout, fmt.Errorf("DescriptorLayoutCache.Get: binding %d is used twice", bindings[i].Binding)
+		}
+	}
+	key := fmt.Sprint(bindings)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if layout, ok := c.layouts[key]; ok {
+		return layout, nil
+	}
+
+	// Phase 1: vk.CreateDescriptorSetLayout
+
+	setLayoutBindings := make([]vk.DescriptorSetLayoutBinding, len(bindings))
+	for i, binding := range bindings {
+		setLayoutBindings[i] = vk.DescriptorSetLayoutBinding{
+			Binding:         binding.Binding,
+			DescriptorType:  binding.Type,
+			DescriptorCount: binding.Count,
+			StageFlags:      binding.Stages,
+		}
+	}
+	setLayoutCreateInfo := vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: uint32(len(setLayoutBindings)),
+		PBindings:    setLayoutBindings,
+	}
+	var layout vk.DescriptorSetLayout
+	err := vk.Error(vk.CreateDescriptorSetLayout(c.device, &setLayoutCreateInfo, nil, &layout))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateDescriptorSetLayout failed with %s", err)
+		return vk.NullDescriptorSetLayout, err
+	}
+	c.layouts[key] = layout
+	c.bindings[layout] = bindings
+	return layout, nil
+}
+
+// bindingsOf returns the bindings of a layout created by the cache.
+func (c *DescriptorLayoutCache) bindingsOf(layout vk.DescriptorSetLayout) ([]DescriptorBinding, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bindings, ok := c.bindings[layout]
+	return bindings, ok
+}
+
+// Len returns the number of layouts created.
+func (c *DescriptorLayoutCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.layouts)
+}
+
+// Destroy destroys all layouts.
+func (c *DescriptorLayoutCache) Destroy() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, layout := range c.layouts {
+		vk.DestroyDescriptorSetLayout(c.device, layout, nil)
+		delete(c.layouts, key)
+		delete(c.bindings, layout)
+	}
+}
+
+// DefaultDescriptorPoolSizes are the descriptors per set of the pools, when none are given.
+var DefaultDescriptorPoolSizes = []vk.DescriptorPoolSize{
+	{Type: vk.DescriptorTypeUniformBuffer, DescriptorCount: 2},
+	{Type: vk.DescriptorTypeUniformBufferDynamic, DescriptorCount: 1},
+	{Type: vk.DescriptorTypeStorageBuffer, DescriptorCount: 2},
+	{Type: vk.DescriptorTypeCombinedImageSampler, DescriptorCount: 4},
+	{Type: vk.DescriptorTypeSampledImage, DescriptorCount: 2},
+	{Type: vk.DescriptorTypeSampler, DescriptorCount: 1},
+	{Type: vk.DescriptorTypeStorageImage, DescriptorCount: 1},
+}
+
+// maxSetsPerPool caps the growth of the pools.
+const maxSetsPerPool = 4096
+
+// DescriptorAllocator allocates descriptor sets from pools it creates as they run out.
+// Each new pool holds twice as many sets as the previous one. Sets are not freed one by
+// one, Reset returns all of them at once.
+//
+// The descriptors per set grow to hold a set of every layout from the layout cache
+// allocated so far. Sets of other layouts must fit the sizes given.
+type DescriptorAllocator struct {
+	mu          sync.Mutex
+	device      vk.Device
+	layouts     *DescriptorLayoutCache
+	sizes       []vk.DescriptorPoolSize
+	setsPerPool uint32
+
+	current descriptorPool
+	// full pools ran out, ready pools were reset and are reused before new ones
+	full  []descriptorPool
+	ready []descriptorPool
+}
+
+// descriptorPool is a pool together with the descriptors per set it was created for.
+type descriptorPool struct {
+	handle vk.DescriptorPool
+	sizes  []vk.DescriptorPoolSize
+}
+
+// NewDescriptorAllocator creates an allocator for sets of the layouts of the cache, whose
+// first pool holds setsPerPool sets. sizes are the descriptors of each type per set,
+// DefaultDescriptorPoolSizes when empty.
+func NewDescriptorAllocator(layouts *DescriptorLayoutCache, setsPerPool uint32, sizes []vk.DescriptorPoolSize) *DescriptorAllocator {
+	if len(sizes) == 0 {
+		sizes = DefaultDescriptorPoolSizes
+	}
+	return &DescriptorAllocator{
+		device:      layouts.device,
+		layouts:     layouts,
+		sizes:       slices.Clone(sizes),
+		setsPerPool: min(max(setsPerPool, 1), maxSetsPerPool),
+	}
+}
+
+// Allocate allocates a set of the layout, moving on to another pool when the current one
+// answers with vk.ErrorOutOfPoolMemory or vk.ErrorFragmentedPool. It fails when a new
+// pool cannot hold the set either.
+func (a *DescriptorAllocator) Allocate(layout vk.DescriptorSetLayout) (vk.DescriptorSet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if bindings, ok := a.layouts.bindingsOf(layout); ok {
+		a.fit(bindings)
+	}
+	for {
+		created := false
+		if a.current.handle == vk.NullDescriptorPool {
+			var err error
+			if created, err = a.nextPool(); err != nil {
+				return vk.NullDescriptorSet, err
+			}
+		}
+		setAllocateInfo := vk.DescriptorSetAllocateInfo{
+			SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+			DescriptorPool:     a.current.handle,
+			DescriptorSetCount: 1,
+			PSetLayouts:        []vk.DescriptorSetLayout{layout},
+		}
+		sets := make([]vk.DescriptorSet, 1)
+		ret := vk.AllocateDescriptorSets(a.device, &setAllocateInfo, &sets[0])
+		if (ret == vk.ErrorOutOfPoolMemory || ret == vk.ErrorFragmentedPool) && !created {
+			a.full = append(a.full, a.current)
+			a.current = descriptorPool{}
+			continue
+		}
+		if err := vk.Error(ret); err != nil {
+			err = fmt.Errorf("vk.AllocateDescriptorSets failed with %s", err)
+			return vk.NullDescriptorSet, err
+		}
+		return sets[0], nil
+	}
+}
+
+// fit grows the descriptors per set to hold a set of the bindings, a.mu must be held.
+// Pools created with smaller sizes take no further sets.
+func (a *DescriptorAllocator) fit(bindings []DescriptorBinding) {
+	grown := false
+	for _, binding := range bindings {
+		var need uint32
+		for _, b := range bindings {
+			if b.Type == binding.Type {
+				need += b.Count
+			}
+		}
+		i := slices.IndexFunc(a.sizes, func(size vk.DescriptorPoolSize) bool {
+			return size.Type == binding.Type
+		})
+		if i < 0 {
+			a.sizes = append(a.sizes, vk.DescriptorPoolSize{Type: binding.Type})
+			i = len(a.sizes) - 1
+		}
+		if a.sizes[i].DescriptorCount < need {
+			a.sizes[i].DescriptorCount = need
+			grown = true
+		}
+	}
+	if !grown {
+		return
+	}
+	if a.current.handle != vk.NullDescriptorPool {
+		a.full = append(a.full, a.current)
+		a.current = descriptorPool{}
+	}
+	for _, pool := range a.ready {
+		vk.DestroyDescriptorPool(a.device, pool.handle, nil)
+	}
+	a.ready = nil
+}
+
+// undersized reports pools created with fewer descriptors per set than a.sizes.
+func (a *DescriptorAllocator) undersized(pool descriptorPool) bool {
+	for _, size := range a.sizes {
+		i := slices.IndexFunc(pool.sizes, func(s vk.DescriptorPoolSize) bool {
+			return s.Type == size.Type
+		})
+		if i < 0 && size.DescriptorCount > 0 || i >= 0 && pool.sizes[i].DescriptorCount < size.DescriptorCount {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPool makes a reset pool or a new one current and reports a new one, a.mu must be held.
+func (a *DescriptorAllocator) nextPool() (bool, error) {
+	if n := len(a.ready); n > 0 {
+		a.current = a.ready[n-1]
+		a.ready = a.ready[:n-1]
+		return false, nil
+	}
+
+	// Phase 1: vk.CreateDescriptorPool
+
+	poolSizes := make([]vk.DescriptorPoolSize, len(a.sizes))
+	for i, size := range a.sizes {
+		poolSizes[i] = vk.DescriptorPoolSize{Type: size.Type, DescriptorCount: size.DescriptorCount * a.setsPerPool}
+	}
+	poolCreateInfo := vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       a.setsPerPool,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+	var pool vk.DescriptorPool
+	err := vk.Error(vk.CreateDescriptorPool(a.device, &poolCreateInfo, nil, &pool))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateDescriptorPool failed with %s", err)
+		return false, err
+	}
+	a.current = descriptorPool{handle: pool, sizes: slices.Clone(a.sizes)}
+	a.setsPerPool = min(a.setsPerPool*2, maxSetsPerPool)
+	return true, nil
+}
+
+// Reset returns every set allocated so far to the pools, the GPU must be done with them.
+// Pools created before the descriptors per set grew are destroyed instead.
+func (a *DescriptorAllocator) Reset() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pools := a.full
+	if a.current.handle != vk.NullDescriptorPool {
+		pools = append(pools, a.current)
+	}
+	a.full = nil
+	a.current = descriptorPool{}
+	for i, pool := range pools {
+		if a.undersized(pool) {
+			vk.DestroyDescriptorPool(a.device, pool.handle, nil)
+			continue
+		}
+		err := vk.Error(vk.ResetDescriptorPool(a.device, pool.handle, 0))
+		if err != nil {
+			// the pools not reset yet keep their sets until Destroy
+			a.full = append(a.full, pools[i:]...)
+			err = fmt.Errorf("vk.ResetDescriptorPool failed with %s", err)
+			return err
+		}
+		a.ready = append(a.ready, pool)
+	}
+	return nil
+}
+
+// Destroy destroys the pools together with their sets.
+func (a *DescriptorAllocator) Destroy() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pools := append(a.full, a.ready...)
+	if a.current.handle != vk.NullDescriptorPool {
+		pools = append(pools, a.current)
+	}
+	for _, pool := range pools {
+		vk.DestroyDescriptorPool(a.device, pool.handle, nil)
+	}
+	a.full, a.ready, a.current = nil, nil, descriptorPool{}
+}
+
+// FrameDescriptors keeps a DescriptorAllocator per frame in flight for sets written every
+// frame, the allocator of a frame is reset when the frame comes around again.
+type FrameDescriptors struct {
+	frames  []*DescriptorAllocator
+	current *DescriptorAllocator
+}
+
+// NewFrameDescriptors creates the allocators of framesInFlight frames, see NewDescriptorAllocator.
+func NewFrameDescriptors(layouts *DescriptorLayoutCache, framesInFlight int, setsPerPool uint32, sizes []vk.DescriptorPoolSize) *FrameDescriptors {
+	f := &FrameDescriptors{frames: make([]*DescriptorAllocator, framesInFlight)}
+	for i := range f.frames {
+		f.frames[i] = NewDescriptorAllocator(layouts, setsPerPool, sizes)
+	}
+	f.current = f.frames[0]
+	return f
+}
+
+// BeginFrame resets the allocator of frame, whose sets the GPU must have finished reading,
+// e.g. VulkanRenderInfo.Frame after DrawFrame waited for the previous use.
+func (f *FrameDescriptors) BeginFrame(frame uint64) error {
+	f.current = f.frames[frame%uint64(len(f.frames))]
+	return f.current.Reset()
+}
+
+// Allocate allocates a set of the layout valid until the frame comes around again.
+func (f *FrameDescriptors) Allocate(layout vk.DescriptorSetLayout) (vk.DescriptorSet, error) {
+	return f.current.Allocate(layout)
+}
+
+// Destroy destroys the allocators of all frames.
+func (f *FrameDescriptors) Destroy() {
+	if f == nil {
+		return
+	}
+	for _, a := range f.frames {
+		a.Destroy()
+	}
+	f.frames = nil
+}
+
+// DescriptorWriter collects descriptor writes and applies them to sets with Update.
+type DescriptorWriter struct {
+	writes []vk.WriteDescriptorSet
+}
+
+// NewDescriptorWriter returns an empty writer.
+func NewDescriptorWriter() *DescriptorWriter {
+	return &DescriptorWriter{}
+}
+
+// BufferAt writes a buffer range into element of binding. vk.WholeSize reaches the end of buf.
+func (w *DescriptorWriter) BufferAt(binding, element uint32, descriptorType vk.DescriptorType, buf *Buffer, offset, size vk.DeviceSize) *DescriptorWriter {
+	w.writes = append(w.writes, vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstBinding:      binding,
+		DstArrayElement: element,
+		DescriptorCount: 1,
+		DescriptorType:  descriptorType,
+		PBufferInfo: []vk.DescriptorBufferInfo{{
+			Buffer: buf.Handle,
+			Offset: offset,
+			Range:  size,
+		}},
+	})
+	return w
+}
+
+// ImageAt writes an image view, a sampler or both into element of binding.
+func (w *DescriptorWriter) ImageAt(binding, element uint32, descriptorType vk.DescriptorType, view vk.ImageView, sampler vk.Sampler, layout vk.ImageLayout) *DescriptorWriter {
+	w.writes = append(w.writes, vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstBinding:      binding,
+		DstArrayElement: element,
+		DescriptorCount: 1,
+		DescriptorType:  descriptorType,
+		PImageInfo: []vk.DescriptorImageInfo{{
+			Sampler:     sampler,
+			ImageView:   view,
+			ImageLayout: layout,
+		}},
+	})
+	return w
+}
+
+// UniformBuffer writes the whole buf as a uniform buffer.
+func (w *DescriptorWriter) UniformBuffer(binding uint32, buf *Buffer) *DescriptorWriter {
+	return w.BufferAt(binding, 0, vk.DescriptorTypeUniformBuffer, buf, 0, vk.DeviceSize(vk.WholeSize))
+}
+
+// StorageBuffer writes the whole buf as a storage buffer.
+func (w *DescriptorWriter) StorageBuffer(binding uint32, buf *Buffer) *DescriptorWriter {
+	return w.BufferAt(binding, 0, vk.DescriptorTypeStorageBuffer, buf, 0, vk.DeviceSize(vk.WholeSize))
+}
+
+// Texture writes the view of img with sampler as a combined image sampler, in
+// vk.ImageLayoutShaderReadOnlyOptimal.
+func (w *DescriptorWriter) Texture(binding uint32, img *Image, sampler vk.Sampler) *DescriptorWriter {
+	return w.ImageAt(binding, 0, vk.DescriptorTypeCombinedImageSampler, img.View, sampler, vk.ImageLayoutShaderReadOnlyOptimal)
+}
+
+// SampledImage writes the view of img as a sampled image, in vk.ImageLayoutShaderReadOnlyOptimal.
+func (w *DescriptorWriter) SampledImage(binding uint32, img *Image) *DescriptorWriter {
+	return w.ImageAt(binding, 0, vk.DescriptorTypeSampledImage, img.View, vk.NullSampler, vk.ImageLayoutShaderReadOnlyOptimal)
+}
+
+// Sampler writes a sampler.
+func (w *DescriptorWriter) Sampler(binding uint32, sampler vk.Sampler) *DescriptorWriter {
+	return w.ImageAt(binding, 0, vk.DescriptorTypeSampler, vk.NullImageView, sampler, vk.ImageLayoutUndefined)
+}
+
+// StorageImage writes view as a storage image, in vk.ImageLayoutGeneral.
+func (w *DescriptorWriter) StorageImage(binding uint32, view vk.ImageView) *DescriptorWriter {
+	return w.ImageAt(binding, 0, vk.DescriptorTypeStorageImage, view, vk.NullSampler, vk.ImageLayoutGeneral)
+}
+
+// Update applies the collected writes to set. The writes are kept, so they can be
+// applied to more sets, until Clear.
+func (w *DescriptorWriter) Update(device vk.Device, set vk.DescriptorSet) {
+	if len(w.writes) == 0 {
+		return
+	}
+	for i := range w.writes {
+		w.writes[i].DstSet = set
+	}
+	vk.UpdateDescriptorSets(device, uint32(len(w.writes)), w.writes, 0, nil)
+}
+
+// Clear drops the collected writes.
+func (w *DescriptorWriter) Clear() {
+	w.writes = w.writes[:0]
+}
@@ -0,0 +1,56 @@
+package asch
+
+/*
+#include <stdint.h>
+#include <stddef.h>
+
+// The bindings are generated from Vulkan 1.0 headers, so the few declarations needed for
+// vkGetBufferDeviceAddress are spelled out here. vgo_vkGetDeviceProcAddr is the entry point
+// the bindings load in vk.InitInstance.
+
+typedef void (*asch_PFN_vkVoidFunction)(void);
+typedef asch_PFN_vkVoidFunction (*asch_PFN_vkGetDeviceProcAddr)(void* device, const char* name);
+
+extern asch_PFN_vkGetDeviceProcAddr vgo_vkGetDeviceProcAddr;
+
+typedef struct {
+	int32_t     sType;
+	const void* pNext;
+	uint64_t    buffer;
+} asch_VkBufferDeviceAddressInfo;
+
+typedef uint64_t (*asch_PFN_vkGetBufferDeviceAddress)(void* device, const asch_VkBufferDeviceAddressInfo* info);
+
+#define ASCH_STRUCTURE_TYPE_BUFFER_DEVICE_ADDRESS_INFO 1000244001
+
+static uint64_t asch_getBufferDeviceAddress(void* device, uint64_t buffer) {
+	static const char* names[] = {"vkGetBufferDeviceAddress", "vkGetBufferDeviceAddressKHR", "vkGetBufferDeviceAddressEXT"};
+	asch_PFN_vkGetBufferDeviceAddress fn = NULL;
+	if (vgo_vkGetDeviceProcAddr == NULL) {
+		return 0;
+	}
+	for (size_t i = 0; i < sizeof(names) / sizeof(names[0]) && fn == NULL; i++) {
+		fn = (asch_PFN_vkGetBufferDeviceAddress)vgo_vkGetDeviceProcAddr(device, names[i]);
+	}
+	if (fn == NULL) {
+		return 0;
+	}
+	asch_VkBufferDeviceAddressInfo info = {ASCH_STRUCTURE_TYPE_BUFFER_DEVICE_ADDRESS_INFO, NULL, buffer};
+	return fn(device, &info);
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// getBufferDeviceAddress calls vkGetBufferDeviceAddress, or one of its extension aliases,
+// loaded through vkGetDeviceProcAddr. It returns 0 when the device has no entry point.
+func getBufferDeviceAddress(device vk.Device, buffer vk.Buffer) DeviceAddress {
+	// vk.Buffer is a pointer on 64-bit and a uint64 on 32-bit targets, 8 bytes either way.
+	handle := *(*C.uint64_t)(unsafe.Pointer(&buffer))
+	return DeviceAddress(C.asch_getBufferDeviceAddress(unsafe.Pointer(device), handle))
+}
@@ -0,0 +1,152 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// Draw is one draw call together with the buffers it reads. It is indexed when Index is set.
+type Draw struct {
+	// VertexBuffers are bound from binding 0, per-instance buffers included.
+	VertexBuffers []vk.Buffer
+	// VertexBufferOffsets are optional, one per vertex buffer.
+	VertexBufferOffsets []vk.DeviceSize
+	Index               *IndexBuffer
+
+	// First is the first vertex, or the first index of an indexed draw.
+	First uint32
+	// Count is the number of vertices or indices.
+	Count uint32
+	// VertexOffset is added to every index of an indexed draw.
+	VertexOffset  int32
+	FirstInstance uint32
+	// InstanceCount of zero draws a single instance.
+	InstanceCount uint32
+}
+
+// Record binds the buffers and records the draw into cmd.
+func (d *Draw) Record(cmd vk.CommandBuffer) {
+	if len(d.VertexBuffers) > 0 {
+		offsets := d.VertexBufferOffsets
+		if offsets == nil {
+			offsets = make([]vk.DeviceSize, len(d.VertexBuffers))
+		}
+		vk.CmdBindVertexBuffers(cmd, 0, uint32(len(d.VertexBuffers)), d.VertexBuffers, offsets)
+	}
+	if d.Index != nil {
+		d.Index.Bind(cmd)
+	}
+	d.recordDraw(cmd)
+}
+
+func (d *Draw) recordDraw(cmd vk.CommandBuffer) {
+	instances := max(d.InstanceCount, 1)
+	if d.Index != nil {
+		vk.CmdDrawIndexed(cmd, d.Count, instances, d.First, d.VertexOffset, d.FirstInstance)
+	} else {
+		vk.CmdDraw(cmd, d.Count, instances, d.First, d.FirstInstance)
+	}
+}
+
+// Submesh is a range of a Mesh drawn on its own, e.g. with another material.
+type Submesh struct {
+	Name string
+	// First and Count are indices of an indexed mesh, vertices otherwise.
+	First        uint32
+	Count        uint32
+	VertexOffset int32
+}
+
+// Mesh bundles the vertex and index buffers of an object with the ranges drawn from them,
+// so all the submeshes share one set of bindings.
+type Mesh struct {
+	Vertices    *Buffer
+	VertexCount int
+	Index       *IndexBuffer
+	Submeshes   []Submesh
+}
+
+// NewMesh uploads the vertices and the indices, which may be nil for a non-indexed mesh.
+// Without submeshes the whole mesh is one submesh. The copies complete with the next
+// Uploader.Flush.
+func NewMesh[V any, I uint16 | uint32 | int](ctx context.Context, uploader *Uploader, vertices []V, indices []I, submeshes ...Submesh) (*Mesh, error) {
+	vb, err := NewVertexBuffer(ctx, uploader, vertices)
+	if err != nil {
+		return nil, err
+	}
+	mesh := &Mesh{
+		Vertices:    vb.Buffer,
+		VertexCount: vb.Count,
+		Submeshes:   submeshes,
+	}
+	count := len(vertices)
+	if len(indices) > 0 {
+		mesh.Index, err = NewIndexBuffer(ctx, uploader, indices)
+		if err != nil {
+			mesh.Destroy()
+			return nil, err
+		}
+		count = len(indices)
+	}
+	if len(mesh.Submeshes) == 0 {
+		mesh.Submeshes = []Submesh{{Count: uint32(count)}}
+	}
+	for _, s := range mesh.Submeshes {
+		if int(s.First)+int(s.Count) > count {
+			mesh.Destroy()
+			return nil, fmt.Errorf("NewMesh: submesh %q [%d, %d) out of %d", s.Name, s.First, s.First+s.Count, count)
+		}
+	}
+	return mesh, nil
+}
+
+// Bind binds the mesh buffers, the vertices at binding 0 and the per-instance
+// buffers at the bindings after it.
+func (m *Mesh) Bind(cmd vk.CommandBuffer, instances ...*Buffer) {
+	buffers := make([]vk.Buffer, 0, 1+len(instances))
+	buffers = append(buffers, m.Vertices.Handle)
+	for _, b := range instances {
+		buffers = append(buffers, b.Handle)
+	}
+	vk.CmdBindVertexBuffers(cmd, 0, uint32(len(buffers)), buffers, make([]vk.DeviceSize, len(buffers)))
+	if m.Index != nil {
+		m.Index.Bind(cmd)
+	}
+}
+
+// Submesh returns the draw of a submesh, the mesh must already be bound.
+func (m *Mesh) Submesh(i int, instanceCount, firstInstance uint32) Draw {
+	s := m.Submeshes[i]
+	return Draw{
+		Index:         m.Index,
+		First:         s.First,
+		Count:         s.Count,
+		VertexOffset:  s.VertexOffset,
+		FirstInstance: firstInstance,
+		InstanceCount: instanceCount,
+	}
+}
+
+// DrawSubmesh records the draw of a bound submesh.
+func (m *Mesh) DrawSubmesh(cmd vk.CommandBuffer, i int, instanceCount, firstInstance uint32) {
+	d := m.Submesh(i, instanceCount, firstInstance)
+	d.recordDraw(cmd)
+}
+
+// Draw binds the mesh and draws all its submeshes.
+func (m *Mesh) Draw(cmd vk.CommandBuffer, instanceCount uint32, instances ...*Buffer) {
+	m.Bind(cmd, instances...)
+	for i := range m.Submeshes {
+		m.DrawSubmesh(cmd, i, instanceCount, 0)
+	}
+}
+
+// Destroy destroys the buffers of the mesh.
+func (m *Mesh) Destroy() {
+	m.Vertices.Destroy()
+	if m.Index != nil {
+		m.Index.Destroy()
+	}
+}
@@ -0,0 +1,130 @@
+package asch
+
+import (
+	"fmt"
+	"log/slog"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// DeviceFeatures lists the optional features which were negotiated at device creation.
+type DeviceFeatures struct {
+	// ApiVersion is the Vulkan version usable on the device,
+	// the lower of the instance and the device versions.
+	ApiVersion uint32
+
+	// SamplerAnisotropy is a Vulkan 1.0 feature, enabled whenever supported.
+	SamplerAnisotropy bool
+
+	TimelineSemaphore   bool
+	BufferDeviceAddress bool
+	// DescriptorIndexing covers non-uniform indexing, partially bound and update-after-bind
+	// arrays of sampled images, storage images and storage buffers, see BindlessTable.
+	DescriptorIndexing bool
+}
+
+// optionalFeature is a Vulkan 1.2 feature enabled when the device accepts it.
+type optionalFeature struct {
+	name   string
+	enable func(f *vk.PhysicalDeviceVulkan12Features)
+	record func(f *DeviceFeatures)
+}
+
+var optionalFeatures = []optionalFeature{
+	{
+		name:   "timelineSemaphore",
+		enable: func(f *vk.PhysicalDeviceVulkan12Features) { f.TimelineSemaphore = vk.True },
+		record: func(f *DeviceFeatures) { f.TimelineSemaphore = true },
+	},
+	{
+		name:   "bufferDeviceAddress",
+		enable: func(f *vk.PhysicalDeviceVulkan12Features) { f.BufferDeviceAddress = vk.True },
+		record: func(f *DeviceFeatures) { f.BufferDeviceAddress = true },
+	},
+	{
+		name: "descriptorIndexing",
+		enable: func(f *vk.PhysicalDeviceVulkan12Features) {
+			f.DescriptorIndexing = vk.True
+			f.RuntimeDescriptorArray = vk.True
+			f.ShaderSampledImageArrayNonUniformIndexing = vk.True
+			f.ShaderStorageImageArrayNonUniformIndexing = vk.True
+			f.ShaderStorageBufferArrayNonUniformIndexing = vk.True
+			f.DescriptorBindingSampledImageUpdateAfterBind = vk.True
+			f.DescriptorBindingStorageImageUpdateAfterBind = vk.True
+			f.DescriptorBindingStorageBufferUpdateAfterBind = vk.True
+			f.DescriptorBindingUpdateUnusedWhilePending = vk.True
+			f.DescriptorBindingPartiallyBound = vk.True
+		},
+		record: func(f *DeviceFeatures) { f.DescriptorIndexing = true },
+	},
+}
+
+// createDevice creates the logical device with as many optional features as possible.
+// The bindings cannot query vkGetPhysicalDeviceFeatures2, so the features are negotiated:
+// when the driver answers with vk.ErrorFeatureNotPresent, each feature is probed on its own
+// and only the ones the device accepts are kept.
+func createDevice(gpu vk.PhysicalDevice, createInfo vk.DeviceCreateInfo, apiVersion uint32) (vk.Device, DeviceFeatures, error) {
+	features := DeviceFeatures{ApiVersion: apiVersion}
+
+	var supported vk.PhysicalDeviceFeatures
+	vk.GetPhysicalDeviceFeatures(gpu, &supported)
+	supported.Deref()
+	if supported.SamplerAnisotropy == vk.True {
+		createInfo.PEnabledFeatures = []vk.PhysicalDeviceFeatures{{SamplerAnisotropy: vk.True}}
+		features.SamplerAnisotropy = true
+	}
+
+	wanted := optionalFeatures
+	if apiVersion < vk.MakeVersion(1, 2, 0) {
+		wanted = nil
+	}
+
+	// Phase 1: all optional features at once, the common case
+
+	device, ret := createDeviceWith(gpu, createInfo, wanted)
+	if ret == vk.ErrorFeatureNotPresent && len(wanted) > 0 {
+		// Phase 2: probe every feature on top of the accepted ones,
+		// 			so one unsupported feature does not drop the others
+
+		var accepted []optionalFeature
+		for _, f := range wanted {
+			probe, ret := createDeviceWith(gpu, createInfo, append(accepted[:len(accepted):len(accepted)], f))
+			if ret == vk.ErrorFeatureNotPresent {
+				slog.Debug(fmt.Sprintf("device feature %s not present, continuing without it", f.name))
+				continue
+			}
+			if err := vk.Error(ret); err != nil {
+				return nil, features, err
+			}
+			vk.DestroyDevice(probe, nil)
+			accepted = append(accepted, f)
+		}
+		wanted = accepted
+		device, ret = createDeviceWith(gpu, createInfo, wanted)
+	}
+	if err := vk.Error(ret); err != nil {
+		return nil, features, err
+	}
+	for _, f := range wanted {
+		f.record(&features)
+	}
+	return device, features, nil
+}
+
+// createDeviceWith creates the logical device with the optional features chained in.
+func createDeviceWith(gpu vk.PhysicalDevice, createInfo vk.DeviceCreateInfo, wanted []optionalFeature) (vk.Device, vk.Result) {
+	var vulkan12 vk.PhysicalDeviceVulkan12Features
+	if len(wanted) > 0 {
+		vulkan12.SType = vk.StructureTypePhysicalDeviceVulkan12Features
+		for _, f := range wanted {
+			f.enable(&vulkan12)
+		}
+		ref, _ := vulkan12.PassRef()
+		defer vulkan12.Free()
+		createInfo.PNext = unsafe.Pointer(ref)
+	}
+	var device vk.Device
+	ret := vk.CreateDevice(gpu, &createInfo, nil, &device)
+	return device, ret
+}
@@ -0,0 +1,369 @@
+package asch
+
+import (
+	"fmt"
+	"strings"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// NumericFormat is how the components of a format are interpreted.
+type NumericFormat int
+
+const (
+	NumericUnorm NumericFormat = iota
+	NumericSnorm
+	NumericUscaled
+	NumericSscaled
+	NumericUint
+	NumericSint
+	NumericUfloat
+	NumericSfloat
+	NumericSrgb
+)
+
+// Compression is the family of a block compressed format.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionBC
+	CompressionETC2
+	CompressionEAC
+	CompressionASTC
+)
+
+// FormatInfo describes a vk.Format.
+type FormatInfo struct {
+	// Name is the Vulkan name in lower case without the prefix, e.g. "r8g8b8a8_srgb".
+	Name string
+	// Size is the bytes of a texel, or of a block of BlockWidth x BlockHeight texels.
+	Size        uint32
+	BlockWidth  uint32
+	BlockHeight uint32
+	Components  uint32
+	// Bits are the bits of the components in the order of the name, zero for compressed
+	// formats and without padding or shared exponents.
+	Bits        [4]uint8
+	Numeric     NumericFormat
+	Aspect      vk.ImageAspectFlags
+	Compression Compression
+}
+
+// IsDepth reports formats with a depth aspect.
+func (f FormatInfo) IsDepth() bool {
+	return f.Aspect&vk.ImageAspectFlags(vk.ImageAspectDepthBit) != 0
+}
+
+// IsStencil reports formats with a stencil aspect.
+func (f FormatInfo) IsStencil() bool {
+	return f.Aspect&vk.ImageAspectFlags(vk.ImageAspectStencilBit) != 0
+}
+
+func (f FormatInfo) IsCompressed() bool {
+	return f.Compression != CompressionNone
+}
+
+func (f FormatInfo) IsSRGB() bool {
+	return f.Numeric == NumericSrgb
+}
+
+const (
+	aspectColor        = vk.ImageAspectFlags(vk.ImageAspectColorBit)
+	aspectDepth        = vk.ImageAspectFlags(vk.ImageAspectDepthBit)
+	aspectStencil      = vk.ImageAspectFlags(vk.ImageAspectStencilBit)
+	aspectDepthStencil = aspectDepth | aspectStencil
+)
+
+// formatTable holds the formats of Vulkan 1.0 and the ASTC HDR formats.
+// Columns: name, size, block width, block height, components, bits, numeric, aspect, compression.
+var formatTable = map[vk.Format]FormatInfo{
+	vk.FormatR4g4UnormPack8:           {"r4g4_unorm_pack8", 1, 1, 1, 2, [4]uint8{4, 4}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR4g4b4a4UnormPack16:      {"r4g4b4a4_unorm_pack16", 2, 1, 1, 4, [4]uint8{4, 4, 4, 4}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatB4g4r4a4UnormPack16:      {"b4g4r4a4_unorm_pack16", 2, 1, 1, 4, [4]uint8{4, 4, 4, 4}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR5g6b5UnormPack16:        {"r5g6b5_unorm_pack16", 2, 1, 1, 3, [4]uint8{5, 6, 5}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatB5g6r5UnormPack16:        {"b5g6r5_unorm_pack16", 2, 1, 1, 3, [4]uint8{5, 6, 5}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR5g5b5a1UnormPack16:      {"r5g5b5a1_unorm_pack16", 2, 1, 1, 4, [4]uint8{5, 5, 5, 1}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatB5g5r5a1UnormPack16:      {"b5g5r5a1_unorm_pack16", 2, 1, 1, 4, [4]uint8{5, 5, 5, 1}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatA1r5g5b5UnormPack16:      {"a1r5g5b5_unorm_pack16", 2, 1, 1, 4, [4]uint8{1, 5, 5, 5}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR8Unorm:                  {"r8_unorm", 1, 1, 1, 1, [4]uint8{8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR8Snorm:                  {"r8_snorm", 1, 1, 1, 1, [4]uint8{8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR8Uscaled:                {"r8_uscaled", 1, 1, 1, 1, [4]uint8{8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR8Sscaled:                {"r8_sscaled", 1, 1, 1, 1, [4]uint8{8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR8Uint:                   {"r8_uint", 1, 1, 1, 1, [4]uint8{8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR8Sint:                   {"r8_sint", 1, 1, 1, 1, [4]uint8{8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR8Srgb:                   {"r8_srgb", 1, 1, 1, 1, [4]uint8{8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatR8g8Unorm:                {"r8g8_unorm", 2, 1, 1, 2, [4]uint8{8, 8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR8g8Snorm:                {"r8g8_snorm", 2, 1, 1, 2, [4]uint8{8, 8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR8g8Uscaled:              {"r8g8_uscaled", 2, 1, 1, 2, [4]uint8{8, 8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR8g8Sscaled:              {"r8g8_sscaled", 2, 1, 1, 2, [4]uint8{8, 8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR8g8Uint:                 {"r8g8_uint", 2, 1, 1, 2, [4]uint8{8, 8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR8g8Sint:                 {"r8g8_sint", 2, 1, 1, 2, [4]uint8{8, 8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR8g8Srgb:                 {"r8g8_srgb", 2, 1, 1, 2, [4]uint8{8, 8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Unorm:              {"r8g8b8_unorm", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Snorm:              {"r8g8b8_snorm", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Uscaled:            {"r8g8b8_uscaled", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Sscaled:            {"r8g8b8_sscaled", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Uint:               {"r8g8b8_uint", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Sint:               {"r8g8b8_sint", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR8g8b8Srgb:               {"r8g8b8_srgb", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Unorm:              {"b8g8r8_unorm", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Snorm:              {"b8g8r8_snorm", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Uscaled:            {"b8g8r8_uscaled", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Sscaled:            {"b8g8r8_sscaled", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Uint:               {"b8g8r8_uint", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Sint:               {"b8g8r8_sint", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatB8g8r8Srgb:               {"b8g8r8_srgb", 3, 1, 1, 3, [4]uint8{8, 8, 8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Unorm:            {"r8g8b8a8_unorm", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Snorm:            {"r8g8b8a8_snorm", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Uscaled:          {"r8g8b8a8_uscaled", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Sscaled:          {"r8g8b8a8_sscaled", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Uint:             {"r8g8b8a8_uint", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Sint:             {"r8g8b8a8_sint", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR8g8b8a8Srgb:             {"r8g8b8a8_srgb", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Unorm:            {"b8g8r8a8_unorm", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Snorm:            {"b8g8r8a8_snorm", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Uscaled:          {"b8g8r8a8_uscaled", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Sscaled:          {"b8g8r8a8_sscaled", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Uint:             {"b8g8r8a8_uint", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Sint:             {"b8g8r8a8_sint", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatB8g8r8a8Srgb:             {"b8g8r8a8_srgb", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8UnormPack32:      {"a8b8g8r8_unorm_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8SnormPack32:      {"a8b8g8r8_snorm_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8UscaledPack32:    {"a8b8g8r8_uscaled_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8SscaledPack32:    {"a8b8g8r8_sscaled_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8UintPack32:       {"a8b8g8r8_uint_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8SintPack32:       {"a8b8g8r8_sint_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatA8b8g8r8SrgbPack32:       {"a8b8g8r8_srgb_pack32", 4, 1, 1, 4, [4]uint8{8, 8, 8, 8}, NumericSrgb, aspectColor, CompressionNone},
+	vk.FormatA2r10g10b10UnormPack32:   {"a2r10g10b10_unorm_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatA2r10g10b10SnormPack32:   {"a2r10g10b10_snorm_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatA2r10g10b10UscaledPack32: {"a2r10g10b10_uscaled_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatA2r10g10b10SscaledPack32: {"a2r10g10b10_sscaled_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatA2r10g10b10UintPack32:    {"a2r10g10b10_uint_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatA2r10g10b10SintPack32:    {"a2r10g10b10_sint_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatA2b10g10r10UnormPack32:   {"a2b10g10r10_unorm_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatA2b10g10r10SnormPack32:   {"a2b10g10r10_snorm_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatA2b10g10r10UscaledPack32: {"a2b10g10r10_uscaled_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatA2b10g10r10SscaledPack32: {"a2b10g10r10_sscaled_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatA2b10g10r10UintPack32:    {"a2b10g10r10_uint_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatA2b10g10r10SintPack32:    {"a2b10g10r10_sint_pack32", 4, 1, 1, 4, [4]uint8{2, 10, 10, 10}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR16Unorm:                 {"r16_unorm", 2, 1, 1, 1, [4]uint8{16}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR16Snorm:                 {"r16_snorm", 2, 1, 1, 1, [4]uint8{16}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR16Uscaled:               {"r16_uscaled", 2, 1, 1, 1, [4]uint8{16}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR16Sscaled:               {"r16_sscaled", 2, 1, 1, 1, [4]uint8{16}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR16Uint:                  {"r16_uint", 2, 1, 1, 1, [4]uint8{16}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR16Sint:                  {"r16_sint", 2, 1, 1, 1, [4]uint8{16}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR16Sfloat:                {"r16_sfloat", 2, 1, 1, 1, [4]uint8{16}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR16g16Unorm:              {"r16g16_unorm", 4, 1, 1, 2, [4]uint8{16, 16}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR16g16Snorm:              {"r16g16_snorm", 4, 1, 1, 2, [4]uint8{16, 16}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR16g16Uscaled:            {"r16g16_uscaled", 4, 1, 1, 2, [4]uint8{16, 16}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR16g16Sscaled:            {"r16g16_sscaled", 4, 1, 1, 2, [4]uint8{16, 16}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR16g16Uint:               {"r16g16_uint", 4, 1, 1, 2, [4]uint8{16, 16}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR16g16Sint:               {"r16g16_sint", 4, 1, 1, 2, [4]uint8{16, 16}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR16g16Sfloat:             {"r16g16_sfloat", 4, 1, 1, 2, [4]uint8{16, 16}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Unorm:           {"r16g16b16_unorm", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Snorm:           {"r16g16b16_snorm", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Uscaled:         {"r16g16b16_uscaled", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Sscaled:         {"r16g16b16_sscaled", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Uint:            {"r16g16b16_uint", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Sint:            {"r16g16b16_sint", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR16g16b16Sfloat:          {"r16g16b16_sfloat", 6, 1, 1, 3, [4]uint8{16, 16, 16}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Unorm:        {"r16g16b16a16_unorm", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericUnorm, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Snorm:        {"r16g16b16a16_snorm", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericSnorm, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Uscaled:      {"r16g16b16a16_uscaled", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericUscaled, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Sscaled:      {"r16g16b16a16_sscaled", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericSscaled, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Uint:         {"r16g16b16a16_uint", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Sint:         {"r16g16b16a16_sint", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR16g16b16a16Sfloat:       {"r16g16b16a16_sfloat", 8, 1, 1, 4, [4]uint8{16, 16, 16, 16}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR32Uint:                  {"r32_uint", 4, 1, 1, 1, [4]uint8{32}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR32Sint:                  {"r32_sint", 4, 1, 1, 1, [4]uint8{32}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR32Sfloat:                {"r32_sfloat", 4, 1, 1, 1, [4]uint8{32}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR32g32Uint:               {"r32g32_uint", 8, 1, 1, 2, [4]uint8{32, 32}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR32g32Sint:               {"r32g32_sint", 8, 1, 1, 2, [4]uint8{32, 32}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR32g32Sfloat:             {"r32g32_sfloat", 8, 1, 1, 2, [4]uint8{32, 32}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR32g32b32Uint:            {"r32g32b32_uint", 12, 1, 1, 3, [4]uint8{32, 32, 32}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR32g32b32Sint:            {"r32g32b32_sint", 12, 1, 1, 3, [4]uint8{32, 32, 32}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR32g32b32Sfloat:          {"r32g32b32_sfloat", 12, 1, 1, 3, [4]uint8{32, 32, 32}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR32g32b32a32Uint:         {"r32g32b32a32_uint", 16, 1, 1, 4, [4]uint8{32, 32, 32, 32}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR32g32b32a32Sint:         {"r32g32b32a32_sint", 16, 1, 1, 4, [4]uint8{32, 32, 32, 32}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR32g32b32a32Sfloat:       {"r32g32b32a32_sfloat", 16, 1, 1, 4, [4]uint8{32, 32, 32, 32}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR64Uint:                  {"r64_uint", 8, 1, 1, 1, [4]uint8{64}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR64Sint:                  {"r64_sint", 8, 1, 1, 1, [4]uint8{64}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR64Sfloat:                {"r64_sfloat", 8, 1, 1, 1, [4]uint8{64}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR64g64Uint:               {"r64g64_uint", 16, 1, 1, 2, [4]uint8{64, 64}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR64g64Sint:               {"r64g64_sint", 16, 1, 1, 2, [4]uint8{64, 64}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR64g64Sfloat:             {"r64g64_sfloat", 16, 1, 1, 2, [4]uint8{64, 64}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR64g64b64Uint:            {"r64g64b64_uint", 24, 1, 1, 3, [4]uint8{64, 64, 64}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR64g64b64Sint:            {"r64g64b64_sint", 24, 1, 1, 3, [4]uint8{64, 64, 64}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR64g64b64Sfloat:          {"r64g64b64_sfloat", 24, 1, 1, 3, [4]uint8{64, 64, 64}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatR64g64b64a64Uint:         {"r64g64b64a64_uint", 32, 1, 1, 4, [4]uint8{64, 64, 64, 64}, NumericUint, aspectColor, CompressionNone},
+	vk.FormatR64g64b64a64Sint:         {"r64g64b64a64_sint", 32, 1, 1, 4, [4]uint8{64, 64, 64, 64}, NumericSint, aspectColor, CompressionNone},
+	vk.FormatR64g64b64a64Sfloat:       {"r64g64b64a64_sfloat", 32, 1, 1, 4, [4]uint8{64, 64, 64, 64}, NumericSfloat, aspectColor, CompressionNone},
+	vk.FormatB10g11r11UfloatPack32:    {"b10g11r11_ufloat_pack32", 4, 1, 1, 3, [4]uint8{10, 11, 11}, NumericUfloat, aspectColor, CompressionNone},
+	vk.FormatE5b9g9r9UfloatPack32:     {"e5b9g9r9_ufloat_pack32", 4, 1, 1, 3, [4]uint8{9, 9, 9}, NumericUfloat, aspectColor, CompressionNone},
+	vk.FormatD16Unorm:                 {"d16_unorm", 2, 1, 1, 1, [4]uint8{16}, NumericUnorm, aspectDepth, CompressionNone},
+	vk.FormatX8D24UnormPack32:         {"x8_d24_unorm_pack32", 4, 1, 1, 1, [4]uint8{24}, NumericUnorm, aspectDepth, CompressionNone},
+	vk.FormatD32Sfloat:                {"d32_sfloat", 4, 1, 1, 1, [4]uint8{32}, NumericSfloat, aspectDepth, CompressionNone},
+	vk.FormatS8Uint:                   {"s8_uint", 1, 1, 1, 1, [4]uint8{8}, NumericUint, aspectStencil, CompressionNone},
+	vk.FormatD16UnormS8Uint:           {"d16_unorm_s8_uint", 3, 1, 1, 2, [4]uint8{16, 8}, NumericUnorm, aspectDepthStencil, CompressionNone},
+	vk.FormatD24UnormS8Uint:           {"d24_unorm_s8_uint", 4, 1, 1, 2, [4]uint8{24, 8}, NumericUnorm, aspectDepthStencil, CompressionNone},
+	vk.FormatD32SfloatS8Uint:          {"d32_sfloat_s8_uint", 5, 1, 1, 2, [4]uint8{32, 8}, NumericSfloat, aspectDepthStencil, CompressionNone},
+	vk.FormatBc1RgbUnormBlock:         {"bc1_rgb_unorm_block", 8, 4, 4, 3, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc1RgbSrgbBlock:          {"bc1_rgb_srgb_block", 8, 4, 4, 3, [4]uint8{}, NumericSrgb, aspectColor, CompressionBC},
+	vk.FormatBc1RgbaUnormBlock:        {"bc1_rgba_unorm_block", 8, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc1RgbaSrgbBlock:         {"bc1_rgba_srgb_block", 8, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionBC},
+	vk.FormatBc2UnormBlock:            {"bc2_unorm_block", 16, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc2SrgbBlock:             {"bc2_srgb_block", 16, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionBC},
+	vk.FormatBc3UnormBlock:            {"bc3_unorm_block", 16, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc3SrgbBlock:             {"bc3_srgb_block", 16, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionBC},
+	vk.FormatBc4UnormBlock:            {"bc4_unorm_block", 8, 4, 4, 1, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc4SnormBlock:            {"bc4_snorm_block", 8, 4, 4, 1, [4]uint8{}, NumericSnorm, aspectColor, CompressionBC},
+	vk.FormatBc5UnormBlock:            {"bc5_unorm_block", 16, 4, 4, 2, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc5SnormBlock:            {"bc5_snorm_block", 16, 4, 4, 2, [4]uint8{}, NumericSnorm, aspectColor, CompressionBC},
+	vk.FormatBc6hUfloatBlock:          {"bc6h_ufloat_block", 16, 4, 4, 3, [4]uint8{}, NumericUfloat, aspectColor, CompressionBC},
+	vk.FormatBc6hSfloatBlock:          {"bc6h_sfloat_block", 16, 4, 4, 3, [4]uint8{}, NumericSfloat, aspectColor, CompressionBC},
+	vk.FormatBc7UnormBlock:            {"bc7_unorm_block", 16, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionBC},
+	vk.FormatBc7SrgbBlock:             {"bc7_srgb_block", 16, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionBC},
+	vk.FormatEtc2R8g8b8UnormBlock:     {"etc2_r8g8b8_unorm_block", 8, 4, 4, 3, [4]uint8{}, NumericUnorm, aspectColor, CompressionETC2},
+	vk.FormatEtc2R8g8b8SrgbBlock:      {"etc2_r8g8b8_srgb_block", 8, 4, 4, 3, [4]uint8{}, NumericSrgb, aspectColor, CompressionETC2},
+	vk.FormatEtc2R8g8b8a1UnormBlock:   {"etc2_r8g8b8a1_unorm_block", 8, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionETC2},
+	vk.FormatEtc2R8g8b8a1SrgbBlock:    {"etc2_r8g8b8a1_srgb_block", 8, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionETC2},
+	vk.FormatEtc2R8g8b8a8UnormBlock:   {"etc2_r8g8b8a8_unorm_block", 16, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionETC2},
+	vk.FormatEtc2R8g8b8a8SrgbBlock:    {"etc2_r8g8b8a8_srgb_block", 16, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionETC2},
+	vk.FormatEacR11UnormBlock:         {"eac_r11_unorm_block", 8, 4, 4, 1, [4]uint8{}, NumericUnorm, aspectColor, CompressionEAC},
+	vk.FormatEacR11SnormBlock:         {"eac_r11_snorm_block", 8, 4, 4, 1, [4]uint8{}, NumericSnorm, aspectColor, CompressionEAC},
+	vk.FormatEacR11g11UnormBlock:      {"eac_r11g11_unorm_block", 16, 4, 4, 2, [4]uint8{}, NumericUnorm, aspectColor, CompressionEAC},
+	vk.FormatEacR11g11SnormBlock:      {"eac_r11g11_snorm_block", 16, 4, 4, 2, [4]uint8{}, NumericSnorm, aspectColor, CompressionEAC},
+	vk.FormatAstc4x4UnormBlock:        {"astc_4x4_unorm_block", 16, 4, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc4x4SrgbBlock:         {"astc_4x4_srgb_block", 16, 4, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc5x4UnormBlock:        {"astc_5x4_unorm_block", 16, 5, 4, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc5x4SrgbBlock:         {"astc_5x4_srgb_block", 16, 5, 4, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc5x5UnormBlock:        {"astc_5x5_unorm_block", 16, 5, 5, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc5x5SrgbBlock:         {"astc_5x5_srgb_block", 16, 5, 5, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc6x5UnormBlock:        {"astc_6x5_unorm_block", 16, 6, 5, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc6x5SrgbBlock:         {"astc_6x5_srgb_block", 16, 6, 5, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc6x6UnormBlock:        {"astc_6x6_unorm_block", 16, 6, 6, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc6x6SrgbBlock:         {"astc_6x6_srgb_block", 16, 6, 6, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc8x5UnormBlock:        {"astc_8x5_unorm_block", 16, 8, 5, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc8x5SrgbBlock:         {"astc_8x5_srgb_block", 16, 8, 5, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc8x6UnormBlock:        {"astc_8x6_unorm_block", 16, 8, 6, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc8x6SrgbBlock:         {"astc_8x6_srgb_block", 16, 8, 6, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc8x8UnormBlock:        {"astc_8x8_unorm_block", 16, 8, 8, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc8x8SrgbBlock:         {"astc_8x8_srgb_block", 16, 8, 8, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc10x5UnormBlock:       {"astc_10x5_unorm_block", 16, 10, 5, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc10x5SrgbBlock:        {"astc_10x5_srgb_block", 16, 10, 5, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc10x6UnormBlock:       {"astc_10x6_unorm_block", 16, 10, 6, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc10x6SrgbBlock:        {"astc_10x6_srgb_block", 16, 10, 6, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc10x8UnormBlock:       {"astc_10x8_unorm_block", 16, 10, 8, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc10x8SrgbBlock:        {"astc_10x8_srgb_block", 16, 10, 8, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc10x10UnormBlock:      {"astc_10x10_unorm_block", 16, 10, 10, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc10x10SrgbBlock:       {"astc_10x10_srgb_block", 16, 10, 10, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc12x10UnormBlock:      {"astc_12x10_unorm_block", 16, 12, 10, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc12x10SrgbBlock:       {"astc_12x10_srgb_block", 16, 12, 10, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc12x12UnormBlock:      {"astc_12x12_unorm_block", 16, 12, 12, 4, [4]uint8{}, NumericUnorm, aspectColor, CompressionASTC},
+	vk.FormatAstc12x12SrgbBlock:       {"astc_12x12_srgb_block", 16, 12, 12, 4, [4]uint8{}, NumericSrgb, aspectColor, CompressionASTC},
+	vk.FormatAstc4x4SfloatBlock:       {"astc_4x4_sfloat_block", 16, 4, 4, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc5x4SfloatBlock:       {"astc_5x4_sfloat_block", 16, 5, 4, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc5x5SfloatBlock:       {"astc_5x5_sfloat_block", 16, 5, 5, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc6x5SfloatBlock:       {"astc_6x5_sfloat_block", 16, 6, 5, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc6x6SfloatBlock:       {"astc_6x6_sfloat_block", 16, 6, 6, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc8x5SfloatBlock:       {"astc_8x5_sfloat_block", 16, 8, 5, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc8x6SfloatBlock:       {"astc_8x6_sfloat_block", 16, 8, 6, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc8x8SfloatBlock:       {"astc_8x8_sfloat_block", 16, 8, 8, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc10x5SfloatBlock:      {"astc_10x5_sfloat_block", 16, 10, 5, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc10x6SfloatBlock:      {"astc_10x6_sfloat_block", 16, 10, 6, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc10x8SfloatBlock:      {"astc_10x8_sfloat_block", 16, 10, 8, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc10x10SfloatBlock:     {"astc_10x10_sfloat_block", 16, 10, 10, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc12x10SfloatBlock:     {"astc_12x10_sfloat_block", 16, 12, 10, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+	vk.FormatAstc12x12SfloatBlock:     {"astc_12x12_sfloat_block", 16, 12, 12, 4, [4]uint8{}, NumericSfloat, aspectColor, CompressionASTC},
+}
+
+// formatNames maps FormatInfo.Name back to the format.
+var formatNames = func() map[string]vk.Format {
+	names := make(map[string]vk.Format, len(formatTable))
+	for format, info := range formatTable {
+		names[info.Name] = format
+	}
+	return names
+}()
+
+// LookupFormat returns the description of format.
+func LookupFormat(format vk.Format) (FormatInfo, bool) {
+	info, ok := formatTable[format]
+	return info, ok
+}
+
+// FormatByName returns the format of a FormatInfo.Name such as "r16g16_sfloat".
+func FormatByName(name string) (vk.Format, bool) {
+	format, ok := formatNames[strings.ToLower(name)]
+	return format, ok
+}
+
+// SRGBFormat returns the sRGB variant of a UNORM format.
+func SRGBFormat(format vk.Format) (vk.Format, bool) {
+	return formatVariant(format, "_unorm", "_srgb")
+}
+
+// UNORMFormat returns the UNORM variant of an sRGB format.
+func UNORMFormat(format vk.Format) (vk.Format, bool) {
+	return formatVariant(format, "_srgb", "_unorm")
+}
+
+func formatVariant(format vk.Format, from, to string) (vk.Format, bool) {
+	info, ok := formatTable[format]
+	if !ok || !strings.Contains(info.Name, from) {
+		return format, false
+	}
+	variant, ok := formatNames[strings.Replace(info.Name, from, to, 1)]
+	if !ok {
+		return format, false
+	}
+	return variant, true
+}
+
+// formatAspect returns the aspects of format, color for unknown formats.
+func formatAspect(format vk.Format) vk.ImageAspectFlags {
+	if info, ok := formatTable[format]; ok {
+		return info.Aspect
+	}
+	return aspectColor
+}
+
+// FindSupportedFormat returns the first candidate having all the features with the tiling.
+func (a *Allocator) FindSupportedFormat(tiling vk.ImageTiling, features vk.FormatFeatureFlags, candidates ...vk.Format) (vk.Format, error) {
+	for _, format := range candidates {
+		var props vk.FormatProperties
+		vk.GetPhysicalDeviceFormatProperties(a.gpu, format, &props)
+		props.Deref()
+		supported := props.OptimalTilingFeatures
+		if tiling == vk.ImageTilingLinear {
+			supported = props.LinearTilingFeatures
+		}
+		if supported&features == features {
+			return format, nil
+		}
+	}
+	return vk.FormatUndefined, fmt.Errorf("FindSupportedFormat: none of the formats %v supports features %#x", candidates, features)
+}
+
+// depthFormats are in order of preference, the first ones without stencil.
+var depthFormats = []vk.Format{
+	vk.FormatD32Sfloat,
+	vk.FormatX8D24UnormPack32,
+	vk.FormatD16Unorm,
+	vk.FormatD32SfloatS8Uint,
+	vk.FormatD24UnormS8Uint,
+	vk.FormatD16UnormS8Uint,
+}
+
+// FindDepthFormat returns a format usable as depth attachment, with a stencil aspect
+// when stencil is set. Every device supports at least one of D24S8 and D32S8.
+func (a *Allocator) FindDepthFormat(stencil bool) (vk.Format, error) {
+	var candidates []vk.Format
+	for _, format := range depthFormats {
+		if !stencil || formatTable[format].IsStencil() {
+			candidates = append(candidates, format)
+		}
+	}
+	return a.FindSupportedFormat(vk.ImageTilingOptimal, vk.FormatFeatureFlags(vk.FormatFeatureDepthStencilAttachmentBit), candidates...)
+}
@@ -0,0 +1,119 @@
+package asch
+
+import (
+	"strings"
+	"testing"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+func TestFormatTable(t *testing.T) {
+	if len(formatNames) != len(formatTable) {
+		t.Errorf("%d names for %d formats", len(formatNames), len(formatTable))
+	}
+	for format, info := range formatTable {
+		switch {
+		case info.Size == 0 || info.BlockWidth == 0 || info.BlockHeight == 0 || info.Components == 0:
+			t.Errorf("%s has an empty size, block or component count", info.Name)
+		case info.IsCompressed() != (info.BlockWidth > 1 || info.BlockHeight > 1):
+			t.Errorf("%s is compressed without blocks or the other way round", info.Name)
+		case info.IsCompressed() != strings.HasSuffix(info.Name, "_block"):
+			t.Errorf("%s has the wrong compression", info.Name)
+		case info.IsSRGB() != strings.Contains(info.Name, "_srgb"):
+			t.Errorf("%s has the wrong numeric format", info.Name)
+		case info.Aspect == 0:
+			t.Errorf("%s has no aspect", info.Name)
+		}
+		if info.IsCompressed() {
+			continue
+		}
+		var bits uint32
+		for _, b := range info.Bits[:info.Components] {
+			bits += uint32(b)
+		}
+		if bits > 8*info.Size {
+			t.Errorf("%s has %d bits in %d bytes", info.Name, bits, info.Size)
+		}
+		if named, ok := FormatByName(info.Name); !ok || named != format {
+			t.Errorf("FormatByName(%q) = %d, %t, want %d", info.Name, named, ok, format)
+		}
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	tests := []struct {
+		format vk.Format
+		name   string
+		size   uint32
+		block  uint32
+		aspect vk.ImageAspectFlags
+	}{
+		{vk.FormatR8g8b8a8Unorm, "r8g8b8a8_unorm", 4, 1, aspectColor},
+		{vk.FormatR8g8b8Unorm, "r8g8b8_unorm", 3, 1, aspectColor},
+		{vk.FormatD24UnormS8Uint, "d24_unorm_s8_uint", 4, 1, aspectDepthStencil},
+		{vk.FormatBc1RgbaUnormBlock, "bc1_rgba_unorm_block", 8, 4, aspectColor},
+		{vk.FormatBc7SrgbBlock, "bc7_srgb_block", 16, 4, aspectColor},
+		{vk.FormatAstc4x4SfloatBlock, "astc_4x4_sfloat_block", 16, 4, aspectColor},
+	}
+	for _, tt := range tests {
+		info, ok := LookupFormat(tt.format)
+		if !ok {
+			t.Errorf("LookupFormat(%d) found nothing", tt.format)
+			continue
+		}
+		if info.Name != tt.name || info.Size != tt.size || info.BlockWidth != tt.block || info.BlockHeight != tt.block || info.Aspect != tt.aspect {
+			t.Errorf("LookupFormat(%d) = %+v", tt.format, info)
+		}
+	}
+	if _, ok := LookupFormat(vk.FormatUndefined); ok {
+		t.Errorf("LookupFormat(vk.FormatUndefined) found a format")
+	}
+}
+
+func TestFormatByName(t *testing.T) {
+	tests := []struct {
+		name   string
+		format vk.Format
+		ok     bool
+	}{
+		{"r16g16_sfloat", vk.FormatR16g16Sfloat, true},
+		{"R16G16_SFLOAT", vk.FormatR16g16Sfloat, true},
+		{"bc7_srgb_block", vk.FormatBc7SrgbBlock, true},
+		{"r16g16", vk.FormatUndefined, false},
+		{"", vk.FormatUndefined, false},
+	}
+	for _, tt := range tests {
+		format, ok := FormatByName(tt.name)
+		if ok != tt.ok || ok && format != tt.format {
+			t.Errorf("FormatByName(%q) = %d, %t, want %d, %t", tt.name, format, ok, tt.format, tt.ok)
+		}
+	}
+}
+
+func TestSRGBFormat(t *testing.T) {
+	tests := []struct {
+		format vk.Format
+		want   vk.Format
+		ok     bool
+	}{
+		{vk.FormatR8g8b8a8Unorm, vk.FormatR8g8b8a8Srgb, true},
+		{vk.FormatB8g8r8a8Unorm, vk.FormatB8g8r8a8Srgb, true},
+		{vk.FormatBc1RgbaUnormBlock, vk.FormatBc1RgbaSrgbBlock, true},
+		{vk.FormatBc7UnormBlock, vk.FormatBc7SrgbBlock, true},
+		{vk.FormatR8g8b8a8Srgb, vk.FormatR8g8b8a8Srgb, false},
+		{vk.FormatR16g16b16a16Unorm, vk.FormatR16g16b16a16Unorm, false},
+		{vk.FormatR32Sfloat, vk.FormatR32Sfloat, false},
+	}
+	for _, tt := range tests {
+		got, ok := SRGBFormat(tt.format)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("SRGBFormat(%d) = %d, %t, want %d, %t", tt.format, got, ok, tt.want, tt.ok)
+		}
+		if !ok {
+			continue
+		}
+		if back, ok := UNORMFormat(got); !ok || back != tt.format {
+			t.Errorf("UNORMFormat(%d) = %d, %t, want %d", got, back, ok, tt.format)
+		}
+	}
+}
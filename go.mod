@@ -3,6 +3,7 @@ module github.com/tomas-mraz/vulkan-ash
 go 1.24.10
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/tomas-mraz/vulkan v0.0.0-20250718111449-7cdec55a4f76
 	github.com/xlab/linmath v0.0.0-20220922225318-40b6290c3b40
 )
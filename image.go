@@ -0,0 +1,252 @@
+package asch
+
+import (
+	"fmt"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// Image owns a vk.Image with optimal tiling, its memory and a view over all of it.
+type Image struct {
+	device     vk.Device
+	Handle     vk.Image
+	View       vk.ImageView
+	Allocation *Allocation
+	Format     vk.Format
+	Extent     vk.Extent3D
+	MipLevels  uint32
+	Layers     uint32
+	Usage      vk.ImageUsageFlags
+	ViewType   vk.ImageViewType
+
+	// views are the views made by CreateView, destroyed with the image
+	views []vk.ImageView
+	// states holds the tracked state of every subresource, layer by layer
+	states []syncState
+}
+
+// ImageCreateInfo describes an image, 2D unless Depth is above 1. Zero Depth, Layers and
+// MipLevels mean 1, MipLevelsAuto a full mip chain.
+type ImageCreateInfo struct {
+	Format vk.Format
+	Width  uint32
+	Height uint32
+	Depth  uint32
+	// Layers counts array layers, six per cube with Cube.
+	Layers uint32
+	// Cube makes a cube map, or a cube map array, of the layers.
+	Cube      bool
+	MipLevels uint32
+	Usage     vk.ImageUsageFlags
+}
+
+// CreateImage creates an image in device local memory together with its view.
+func (a *Allocator) CreateImage(info ImageCreateInfo) (*Image, error) {
+	if info.Width == 0 || info.Height == 0 {
+		return nil, fmt.Errorf("CreateImage: extent %dx%d is empty", info.Width, info.Height)
+	}
+	img := &Image{
+		device:    a.device,
+		Format:    info.Format,
+		Extent:    vk.Extent3D{Width: info.Width, Height: info.Height, Depth: max(info.Depth, 1)},
+		MipLevels: max(info.MipLevels, 1),
+		Layers:    max(info.Layers, 1),
+		Usage:     info.Usage,
+	}
+	if info.MipLevels == MipLevelsAuto {
+		img.MipLevels = MipLevelsFor(info.Width, max(info.Height, img.Extent.Depth))
+	}
+	imageType, viewType := vk.ImageType2d, vk.ImageViewType2d
+	var flags vk.ImageCreateFlags
+	switch {
+	case img.Extent.Depth > 1:
+		if img.Layers > 1 || info.Cube {
+			return nil, fmt.Errorf("CreateImage: 3D images have neither layers nor faces")
+		}
+		imageType, viewType = vk.ImageType3d, vk.ImageViewType3d
+	case info.Cube:
+		if img.Layers%6 != 0 || info.Width != info.Height {
+			return nil, fmt.Errorf("CreateImage: cube maps need square faces and six layers per cube, got %dx%d and %d layers", info.Width, info.Height, img.Layers)
+		}
+		flags = vk.ImageCreateFlags(vk.ImageCreateCubeCompatibleBit)
+		viewType = vk.ImageViewTypeCube
+		if img.Layers > 6 {
+			viewType = vk.ImageViewTypeCubeArray
+		}
+	case img.Layers > 1:
+		viewType = vk.ImageViewType2dArray
+	}
+	img.states = make([]syncState, img.MipLevels*img.Layers)
+	for i := range img.states {
+		img.states[i] = newSyncState()
+	}
+
+	// Phase 1: vk.CreateImage
+
+	imageCreateInfo := vk.ImageCreateInfo{
+		SType:         vk.StructureTypeImageCreateInfo,
+		Flags:         flags,
+		ImageType:     imageType,
+		Format:        info.Format,
+		Extent:        img.Extent,
+		MipLevels:     img.MipLevels,
+		ArrayLayers:   img.Layers,
+		Samples:       vk.SampleCount1Bit,
+		Tiling:        vk.ImageTilingOptimal,
+		Usage:         info.Usage,
+		SharingMode:   vk.SharingModeExclusive,
+		InitialLayout: vk.ImageLayoutUndefined,
+	}
+	err := vk.Error(vk.CreateImage(a.device, &imageCreateInfo, nil, &img.Handle))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateImage failed with %s", err)
+		return nil, err
+	}
+
+	// Phase 2: Allocator.AllocateForImage
+
+	img.Allocation, err = a.AllocateForImage(img.Handle, AllocationCreateInfo{Intent: MemoryGPUOnly})
+	if err != nil {
+		img.Destroy()
+		return nil, err
+	}
+
+	// Phase 3: vk.CreateImageView
+
+	img.ViewType = viewType
+	img.View, err = img.newView(ImageViewInfo{})
+	if err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	return img, nil
+}
+
+// ImageViewInfo selects the levels and layers a view covers. Zero Type and Format
+// keep those of the image, zero Levels and Layers reach the last level and layer.
+type ImageViewInfo struct {
+	Type      vk.ImageViewType
+	Format    vk.Format
+	BaseLevel uint32
+	Levels    uint32
+	BaseLayer uint32
+	Layers    uint32
+}
+
+// CreateView creates a view over part of the image, e.g. one face of a cube map or a
+// single mip level for rendering into. The view is destroyed together with the image.
+func (img *Image) CreateView(info ImageViewInfo) (vk.ImageView, error) {
+	view, err := img.newView(info)
+	if err != nil {
+		return vk.NullImageView, err
+	}
+	img.views = append(img.views, view)
+	return view, nil
+}
+
+func (img *Image) newView(info ImageViewInfo) (vk.ImageView, error) {
+	if info.BaseLevel >= img.MipLevels || info.BaseLayer >= img.Layers {
+		return vk.NullImageView, fmt.Errorf("CreateView: level %d layer %d out of %d levels and %d layers", info.BaseLevel, info.BaseLayer, img.MipLevels, img.Layers)
+	}
+	if info.Levels == 0 {
+		info.Levels = img.MipLevels - info.BaseLevel
+	}
+	if info.Layers == 0 {
+		info.Layers = img.Layers - info.BaseLayer
+	}
+	if info.Format == vk.FormatUndefined {
+		info.Format = img.Format
+	}
+	if info.Type == vk.ImageViewType1d {
+		info.Type = img.ViewType
+	}
+	viewCreateInfo := vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    img.Handle,
+		ViewType: info.Type,
+		Format:   info.Format,
+		Components: vk.ComponentMapping{
+			R: vk.ComponentSwizzleR,
+			G: vk.ComponentSwizzleG,
+			B: vk.ComponentSwizzleB,
+			A: vk.ComponentSwizzleA,
+		},
+		SubresourceRange: img.subresourceRange(info.BaseLevel, info.Levels, info.BaseLayer, info.Layers),
+	}
+	var view vk.ImageView
+	err := vk.Error(vk.CreateImageView(img.device, &viewCreateInfo, nil, &view))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateImageView failed with %s", err)
+		return vk.NullImageView, err
+	}
+	return view, nil
+}
+
+// FormatSupported reports whether optimally tiled images of format have all the features.
+func (a *Allocator) FormatSupported(format vk.Format, features vk.FormatFeatureFlags) bool {
+	var props vk.FormatProperties
+	vk.GetPhysicalDeviceFormatProperties(a.gpu, format, &props)
+	props.Deref()
+	return props.OptimalTilingFeatures&features == features
+}
+
+// Aspect returns the aspects of the image format.
+func (img *Image) Aspect() vk.ImageAspectFlags {
+	return formatAspect(img.Format)
+}
+
+func (img *Image) subresourceRange(baseLevel, levels, baseLayer, layers uint32) vk.ImageSubresourceRange {
+	return vk.ImageSubresourceRange{
+		AspectMask:     img.Aspect(),
+		BaseMipLevel:   baseLevel,
+		LevelCount:     levels,
+		BaseArrayLayer: baseLayer,
+		LayerCount:     layers,
+	}
+}
+
+// MipExtent returns the extent of a mip level.
+func (img *Image) MipExtent(level uint32) vk.Extent3D {
+	return vk.Extent3D{
+		Width:  max(img.Extent.Width>>level, 1),
+		Height: max(img.Extent.Height>>level, 1),
+		Depth:  max(img.Extent.Depth>>level, 1),
+	}
+}
+
+// Layout returns the current layout of a subresource as tracked by asch.
+func (img *Image) Layout(level, layer uint32) vk.ImageLayout {
+	return img.states[layer*img.MipLevels+level].layout
+}
+
+// Owner returns the queue family owning a subresource, vk.QueueFamilyIgnored before its first use.
+func (img *Image) Owner(level, layer uint32) uint32 {
+	return img.states[layer*img.MipLevels+level].owner
+}
+
+func (img *Image) state(level, layer uint32) *syncState {
+	return &img.states[layer*img.MipLevels+level]
+}
+
+// Destroy destroys the view, the image and frees its memory.
+func (img *Image) Destroy() {
+	if img == nil {
+		return
+	}
+	for _, view := range img.views {
+		vk.DestroyImageView(img.device, view, nil)
+	}
+	img.views = nil
+	if img.View != vk.NullImageView {
+		vk.DestroyImageView(img.device, img.View, nil)
+		img.View = vk.NullImageView
+	}
+	if img.Handle != vk.NullImage {
+		vk.DestroyImage(img.device, img.Handle, nil)
+		img.Handle = vk.NullImage
+	}
+	if img.Allocation != nil {
+		img.Allocation.Free()
+		img.Allocation = nil
+	}
+}
@@ -0,0 +1,69 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// primitiveRestart16 is the uint16 index reserved for primitive restart.
+const primitiveRestart16 = 0xFFFF
+
+// IndexBuffer is a device local buffer of uint16 or uint32 indices.
+type IndexBuffer struct {
+	*Buffer
+	Type  vk.IndexType
+	Count int
+}
+
+// NewIndexBuffer uploads the indices into a new index buffer, stored as uint16 whenever
+// every index fits, uint32 otherwise. The copy completes with the next Uploader.Flush.
+func NewIndexBuffer[I uint16 | uint32 | int](ctx context.Context, uploader *Uploader, indices []I) (*IndexBuffer, error) {
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("NewIndexBuffer: no indices")
+	}
+	if slices.Min(indices) < 0 {
+		return nil, fmt.Errorf("NewIndexBuffer: negative index")
+	}
+	usage := vk.BufferUsageFlags(vk.BufferUsageIndexBufferBit)
+	ib := &IndexBuffer{Count: len(indices)}
+	var data []byte
+	if maxIndex := int64(slices.Max(indices)); maxIndex < primitiveRestart16 {
+		ib.Type = vk.IndexTypeUint16
+		data = sliceBytes(convertIndices[uint16](indices))
+	} else if maxIndex <= 0xFFFFFFFF {
+		ib.Type = vk.IndexTypeUint32
+		data = sliceBytes(convertIndices[uint32](indices))
+	} else {
+		return nil, fmt.Errorf("NewIndexBuffer: index %d does not fit uint32", maxIndex)
+	}
+	var err error
+	ib.Buffer, err = uploader.CreateBufferWithData(ctx, usage, data)
+	if err != nil {
+		return nil, err
+	}
+	return ib, nil
+}
+
+func convertIndices[T, I uint16 | uint32 | int](indices []I) []T {
+	converted := make([]T, len(indices))
+	for i, index := range indices {
+		converted[i] = T(index)
+	}
+	return converted
+}
+
+// IndexSize returns the size of one index in bytes.
+func (ib *IndexBuffer) IndexSize() vk.DeviceSize {
+	if ib.Type == vk.IndexTypeUint16 {
+		return 2
+	}
+	return 4
+}
+
+// Bind binds the whole buffer as the index buffer.
+func (ib *IndexBuffer) Bind(cmd vk.CommandBuffer) {
+	vk.CmdBindIndexBuffer(cmd, ib.Handle, 0, ib.Type)
+}
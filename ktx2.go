@@ -0,0 +1,149 @@
+package asch
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/klauspost/compress/zstd"
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+var ktx2Identifier = []byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// KTX2 supercompression schemes
+const (
+	ktx2SupercompressionNone    = 0
+	ktx2SupercompressionBasisLZ = 1
+	ktx2SupercompressionZstd    = 2
+	ktx2SupercompressionZlib    = 3
+)
+
+// ktx2HeaderSize covers the identifier, the header and the index up to the level index.
+const ktx2HeaderSize = 80
+
+// ktx2MaxLevelSize bounds the bytes of one level, all layers and faces together.
+const ktx2MaxLevelSize = 1 << 31
+
+// DecodeKTX2 decodes a KTX2 file. Levels may be zstd or zlib supercompressed,
+// Basis Universal textures are rejected as they need transcoding.
+func DecodeKTX2(data []byte) (*TextureData, error) {
+	if len(data) < ktx2HeaderSize || !bytes.Equal(data[:len(ktx2Identifier)], ktx2Identifier) {
+		return nil, fmt.Errorf("DecodeKTX2: not a KTX2 file")
+	}
+	le := binary.LittleEndian
+	td := &TextureData{
+		Format: vk.Format(le.Uint32(data[12:])),
+		Width:  le.Uint32(data[20:]),
+		Height: max(le.Uint32(data[24:]), 1),
+		Depth:  max(le.Uint32(data[28:]), 1),
+		Layers: max(le.Uint32(data[32:]), 1),
+		Faces:  le.Uint32(data[36:]),
+	}
+	levels := le.Uint32(data[40:])
+	scheme := le.Uint32(data[44:])
+
+	if td.Format == vk.FormatUndefined || scheme == ktx2SupercompressionBasisLZ {
+		return nil, fmt.Errorf("DecodeKTX2: Basis Universal textures need transcoding, which is not supported")
+	}
+	info, ok := LookupFormat(td.Format)
+	if !ok {
+		return nil, fmt.Errorf("DecodeKTX2: unknown format %d", td.Format)
+	}
+	if td.Width == 0 {
+		return nil, fmt.Errorf("DecodeKTX2: texture is empty")
+	}
+	if td.Faces != 1 && td.Faces != 6 {
+		return nil, fmt.Errorf("DecodeKTX2: %d faces, expected 1 or 6", td.Faces)
+	}
+	if uint64(td.Layers)*uint64(td.Faces) > uint64(len(data)) {
+		return nil, fmt.Errorf("DecodeKTX2: %d layers exceed the file", td.Layers)
+	}
+	if levels == 0 {
+		// the file asks for the mips to be generated at load time
+		td.GenerateMipmaps = true
+		levels = 1
+	}
+	if levels > 32 || uint64(len(data)) < ktx2HeaderSize+24*uint64(levels) {
+		return nil, fmt.Errorf("DecodeKTX2: level index of %d levels is truncated", levels)
+	}
+
+	var decoder *zstd.Decoder
+	if scheme == ktx2SupercompressionZstd {
+		var err error
+		decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(ktx2MaxLevelSize))
+		if err != nil {
+			return nil, fmt.Errorf("DecodeKTX2: %w", err)
+		}
+		defer decoder.Close()
+	}
+
+	images := td.Layers * td.Faces
+	td.Levels = make([][][]byte, levels)
+	for level := range levels {
+		entry := data[ktx2HeaderSize+24*level:]
+		offset, length, uncompressed := le.Uint64(entry), le.Uint64(entry[8:]), le.Uint64(entry[16:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, fmt.Errorf("DecodeKTX2: level %d is truncated", level)
+		}
+		expected, ok := ktx2LevelSize(info, td, level)
+		if !ok || expected > ktx2MaxLevelSize {
+			return nil, fmt.Errorf("DecodeKTX2: level %d of %dx%dx%d is too large", level, td.Width, td.Height, td.Depth)
+		}
+		if uncompressed != expected {
+			return nil, fmt.Errorf("DecodeKTX2: level %d has %d bytes, expected %d", level, uncompressed, expected)
+		}
+		raw := data[offset : offset+length]
+
+		switch scheme {
+		case ktx2SupercompressionNone:
+		case ktx2SupercompressionZstd:
+			var err error
+			raw, err = decoder.DecodeAll(raw, make([]byte, 0, uncompressed))
+			if err != nil {
+				return nil, fmt.Errorf("DecodeKTX2: level %d: %w", level, err)
+			}
+		case ktx2SupercompressionZlib:
+			r, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("DecodeKTX2: level %d: %w", level, err)
+			}
+			raw, err = io.ReadAll(io.LimitReader(r, int64(uncompressed)+1))
+			if err != nil {
+				return nil, fmt.Errorf("DecodeKTX2: level %d: %w", level, err)
+			}
+		default:
+			return nil, fmt.Errorf("DecodeKTX2: unknown supercompression scheme %d", scheme)
+		}
+		if uint64(len(raw)) != expected {
+			return nil, fmt.Errorf("DecodeKTX2: level %d has %d bytes, expected %d", level, len(raw), expected)
+		}
+
+		// images follow each other layer by layer, face by face
+		size := len(raw) / int(images)
+		td.Levels[level] = make([][]byte, images)
+		for i := range td.Levels[level] {
+			td.Levels[level][i] = raw[i*size : (i+1)*size]
+		}
+	}
+	return td, nil
+}
+
+// ktx2LevelSize returns the bytes of a level in all its images, false when they overflow.
+func ktx2LevelSize(info FormatInfo, td *TextureData, level uint32) (uint64, bool) {
+	width, height := uint64(max(td.Width>>level, 1)), uint64(max(td.Height>>level, 1))
+	bw, bh := uint64(info.BlockWidth), uint64(info.BlockHeight)
+	blocks := (width + bw - 1) / bw * ((height + bh - 1) / bh)
+	size := uint64(info.Size)
+	for _, n := range []uint64{blocks, uint64(max(td.Depth>>level, 1)), uint64(td.Layers), uint64(td.Faces)} {
+		hi, lo := bits.Mul64(size, n)
+		if hi != 0 {
+			return 0, false
+		}
+		size = lo
+	}
+	return size, true
+}
@@ -0,0 +1,265 @@
+package asch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// LayoutRules are the GLSL block layouts Go values can be encoded with.
+//
+// Go types map to GLSL as float32, int32, uint32 and bool to float, int, uint and bool,
+// [2..4]scalar (linmath.Vec3) to vectors, [C][R]float32 (linmath.Mat4x4) to column major
+// matCxR, other arrays to arrays and structs to structs. DeviceAddress and uint64 map to
+// uint64_t or buffer references. Anything else, including int, float64 and pointers,
+// cannot be represented.
+type LayoutRules int
+
+const (
+	// Std140 is the layout of uniform blocks: arrays and matrix columns have their stride
+	// and structs their alignment rounded up to 16.
+	Std140 LayoutRules = iota
+	// Std430 is the layout of storage blocks and push constants, std140 without
+	// the rounding to 16.
+	Std430
+	// Scalar aligns everything to its scalar components, VK_EXT_scalar_block_layout.
+	Scalar
+)
+
+func (r LayoutRules) String() string {
+	switch r {
+	case Std140:
+		return "std140"
+	case Std430:
+		return "std430"
+	case Scalar:
+		return "scalar"
+	default:
+		return fmt.Sprintf("LayoutRules(%d)", int(r))
+	}
+}
+
+// DeviceAddress is the GPU address of a buffer, see Buffer.GetDeviceAddress.
+type DeviceAddress uint64
+
+// Layout returns the alignment and the size of t.
+func (r LayoutRules) Layout(t reflect.Type) (align, size uint32, err error) {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Int32, reflect.Uint32, reflect.Bool:
+		return 4, 4, nil
+	case reflect.Uint64:
+		return 8, 8, nil
+	case reflect.Array:
+		if t.Len() == 0 {
+			return 0, 0, fmt.Errorf("type %s: arrays must not be empty", t)
+		}
+		if isVector(t) {
+			n := uint32(t.Len())
+			return r.vectorAlign(n), 4 * n, nil
+		}
+		elemAlign, stride, err := r.arrayStride(t)
+		if err != nil {
+			return 0, 0, err
+		}
+		if r == Std140 {
+			elemAlign = max(elemAlign, 16)
+		}
+		return elemAlign, stride * uint32(t.Len()), nil
+	case reflect.Struct:
+		if t.NumField() == 0 {
+			return 0, 0, fmt.Errorf("type %s: structs must not be empty", t)
+		}
+		var offset uint32
+		align = 4
+		for i := 0; i < t.NumField(); i++ {
+			fieldAlign, fieldSize, err := r.Layout(t.Field(i).Type)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%s.%s: %w", t, t.Field(i).Name, err)
+			}
+			offset = alignUp32(offset, fieldAlign) + fieldSize
+			align = max(align, fieldAlign)
+		}
+		if r == Std140 {
+			align = alignUp32(align, 16)
+		}
+		return align, alignUp32(offset, align), nil
+	default:
+		return 0, 0, fmt.Errorf("type %s has no %s layout", t, r)
+	}
+}
+
+func (r LayoutRules) vectorAlign(components uint32) uint32 {
+	switch {
+	case r == Scalar:
+		return 4
+	case components == 2:
+		return 8
+	default:
+		return 16
+	}
+}
+
+// arrayStride returns the alignment and the stride of the elements of the array t.
+func (r LayoutRules) arrayStride(t reflect.Type) (align, stride uint32, err error) {
+	align, size, err := r.Layout(t.Elem())
+	if err != nil {
+		return 0, 0, err
+	}
+	stride = alignUp32(size, align)
+	if r == Std140 {
+		stride = alignUp32(stride, 16)
+	}
+	return align, stride, nil
+}
+
+// Sizeof returns the size of the type of value.
+func (r LayoutRules) Sizeof(value any) (uint32, error) {
+	v, err := indirect(value)
+	if err != nil {
+		return 0, err
+	}
+	_, size, err := r.Layout(v.Type())
+	return size, err
+}
+
+// indirect returns the value, or the value pointed to, failing on nil pointers.
+func indirect(value any) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return v, fmt.Errorf("nil value has no layout")
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return v, fmt.Errorf("nil %s has no layout", v.Type())
+		}
+		v = v.Elem()
+	}
+	return v, nil
+}
+
+// Offsets returns the offsets of the fields of the struct t.
+func (r LayoutRules) Offsets(t reflect.Type) ([]uint32, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type %s is not a struct", t)
+	}
+	offsets := make([]uint32, t.NumField())
+	var offset uint32
+	for i := range offsets {
+		fieldAlign, fieldSize, err := r.Layout(t.Field(i).Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t, t.Field(i).Name, err)
+		}
+		offsets[i] = alignUp32(offset, fieldAlign)
+		offset = offsets[i] + fieldSize
+	}
+	return offsets, nil
+}
+
+// Offsetof returns the offset of the named field of the struct value.
+func (r LayoutRules) Offsetof(value any, field string) (uint32, error) {
+	v, err := indirect(value)
+	if err != nil {
+		return 0, err
+	}
+	t := v.Type()
+	offsets, err := r.Offsets(t)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := t.FieldByName(field)
+	if !ok || len(f.Index) != 1 {
+		return 0, fmt.Errorf("type %s has no field %s", t, field)
+	}
+	return offsets[f.Index[0]], nil
+}
+
+// Marshal returns value encoded with the rules.
+func (r LayoutRules) Marshal(value any) ([]byte, error) {
+	size, err := r.Sizeof(value)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	return data, r.Encode(data, value)
+}
+
+// Encode writes value into dst, padding included, dst must hold its size.
+func (r LayoutRules) Encode(dst []byte, value any) error {
+	v, err := indirect(value)
+	if err != nil {
+		return err
+	}
+	_, size, err := r.Layout(v.Type())
+	if err != nil {
+		return err
+	}
+	if uint32(len(dst)) < size {
+		return fmt.Errorf("%s encoding of %s needs %d bytes, got %d", r, v.Type(), size, len(dst))
+	}
+	clear(dst[:size])
+	return r.encode(dst, v)
+}
+
+func (r LayoutRules) encode(dst []byte, v reflect.Value) error {
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Float32:
+		binary.LittleEndian.PutUint32(dst, math.Float32bits(float32(v.Float())))
+	case reflect.Int32:
+		binary.LittleEndian.PutUint32(dst, uint32(v.Int()))
+	case reflect.Uint32:
+		binary.LittleEndian.PutUint32(dst, uint32(v.Uint()))
+	case reflect.Uint64:
+		binary.LittleEndian.PutUint64(dst, v.Uint())
+	case reflect.Bool:
+		var b uint32
+		if v.Bool() {
+			b = 1
+		}
+		binary.LittleEndian.PutUint32(dst, b)
+	case reflect.Array:
+		stride := uint32(4)
+		if !isVector(t) {
+			var err error
+			_, stride, err = r.arrayStride(t)
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := r.encode(dst[uint32(i)*stride:], v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		offsets, err := r.Offsets(t)
+		if err != nil {
+			return err
+		}
+		for i, offset := range offsets {
+			if err := r.encode(dst[offset:], v.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("type %s has no %s layout", t, r)
+	}
+	return nil
+}
+
+// isVector reports arrays of two to four scalars.
+func isVector(t reflect.Type) bool {
+	if t.Kind() != reflect.Array || t.Len() < 2 || t.Len() > 4 {
+		return false
+	}
+	switch t.Elem().Kind() {
+	case reflect.Float32, reflect.Int32, reflect.Uint32, reflect.Bool:
+		return true
+	}
+	return false
+}
+
+func alignUp32(v, alignment uint32) uint32 {
+	return (v + alignment - 1) / alignment * alignment
+}
@@ -0,0 +1,211 @@
+package asch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/xlab/linmath"
+)
+
+type layoutVec3Padding struct {
+	A float32
+	B linmath.Vec3
+	C float32
+}
+
+type layoutInner struct {
+	X float32
+}
+
+type layoutNested struct {
+	A float32
+	N layoutInner
+	B float32
+}
+
+type layoutVec2 struct {
+	A float32
+	V [2]float32
+}
+
+type layoutAddress struct {
+	A float32
+	P DeviceAddress
+}
+
+type layoutArrays struct {
+	A [5]float32
+	V [2]linmath.Vec3
+	M linmath.Mat4x4
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     reflect.Type
+		rules   LayoutRules
+		align   uint32
+		size    uint32
+		offsets []uint32
+	}{
+		{"vec3 std140", reflect.TypeFor[layoutVec3Padding](), Std140, 16, 32, []uint32{0, 16, 28}},
+		{"vec3 std430", reflect.TypeFor[layoutVec3Padding](), Std430, 16, 32, []uint32{0, 16, 28}},
+		{"vec3 scalar", reflect.TypeFor[layoutVec3Padding](), Scalar, 4, 20, []uint32{0, 4, 16}},
+		{"nested std140", reflect.TypeFor[layoutNested](), Std140, 16, 48, []uint32{0, 16, 32}},
+		{"nested std430", reflect.TypeFor[layoutNested](), Std430, 4, 12, []uint32{0, 4, 8}},
+		{"vec2 std430", reflect.TypeFor[layoutVec2](), Std430, 8, 16, []uint32{0, 8}},
+		{"vec2 scalar", reflect.TypeFor[layoutVec2](), Scalar, 4, 12, []uint32{0, 4}},
+		{"address std430", reflect.TypeFor[layoutAddress](), Std430, 8, 16, []uint32{0, 8}},
+		{"arrays std140", reflect.TypeFor[layoutArrays](), Std140, 16, 176, []uint32{0, 80, 112}},
+		{"arrays std430", reflect.TypeFor[layoutArrays](), Std430, 16, 128, []uint32{0, 32, 64}},
+		{"arrays scalar", reflect.TypeFor[layoutArrays](), Scalar, 4, 108, []uint32{0, 20, 44}},
+		{"float array std140", reflect.TypeFor[[5]float32](), Std140, 16, 80, nil},
+		{"float array std430", reflect.TypeFor[[5]float32](), Std430, 4, 20, nil},
+		{"vec3 array std430", reflect.TypeFor[[2]linmath.Vec3](), Std430, 16, 32, nil},
+		{"vec3 array scalar", reflect.TypeFor[[2]linmath.Vec3](), Scalar, 4, 24, nil},
+		{"mat4 std140", reflect.TypeFor[linmath.Mat4x4](), Std140, 16, 64, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			align, size, err := tt.rules.Layout(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if align != tt.align || size != tt.size {
+				t.Errorf("Layout = align %d size %d, want align %d size %d", align, size, tt.align, tt.size)
+			}
+			if tt.offsets == nil {
+				return
+			}
+			offsets, err := tt.rules.Offsets(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(offsets, tt.offsets) {
+				t.Errorf("Offsets = %v, want %v", offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  reflect.Type
+	}{
+		{"int", reflect.TypeFor[int]()},
+		{"float64", reflect.TypeFor[float64]()},
+		{"pointer", reflect.TypeFor[*float32]()},
+		{"empty array", reflect.TypeFor[[0]float32]()},
+		{"empty struct", reflect.TypeFor[struct{}]()},
+		{"bad field", reflect.TypeFor[struct{ A []float32 }]()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Std430.Layout(tt.typ); err == nil {
+				t.Errorf("Layout(%s) succeeded", tt.typ)
+			}
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	f := func(v float32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(v))
+	}
+	pad := func(n int) []byte {
+		return make([]byte, n)
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		name  string
+		rules LayoutRules
+		value any
+		want  []byte
+	}{
+		{"vec3 std140", Std140, layoutVec3Padding{1, linmath.Vec3{2, 3, 4}, 5},
+			join(f(1), pad(12), f(2), f(3), f(4), f(5))},
+		{"vec3 scalar", Scalar, layoutVec3Padding{1, linmath.Vec3{2, 3, 4}, 5},
+			join(f(1), f(2), f(3), f(4), f(5))},
+		{"nested std140", Std140, layoutNested{1, layoutInner{2}, 3},
+			join(f(1), pad(12), f(2), pad(12), f(3), pad(12))},
+		{"float array std140", Std140, [2]struct{ A float32 }{{1}, {2}},
+			join(f(1), pad(12), f(2), pad(12))},
+		{"vec3 array std430", Std430, [2]linmath.Vec3{{1, 2, 3}, {4, 5, 6}},
+			join(f(1), f(2), f(3), pad(4), f(4), f(5), f(6), pad(4))},
+		{"pointer", Std430, &layoutVec2{1, [2]float32{2, 3}},
+			join(f(1), pad(4), f(2), f(3))},
+		{"scalars", Std430, struct {
+			B bool
+			I int32
+			U uint32
+			P DeviceAddress
+		}{true, -1, 7, 0x0102030405060708},
+			join([]byte{1, 0, 0, 0}, []byte{0xFF, 0xFF, 0xFF, 0xFF}, []byte{7, 0, 0, 0}, pad(4),
+				[]byte{8, 7, 6, 5, 4, 3, 2, 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Marshal = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeClearsPadding(t *testing.T) {
+	dst := bytes.Repeat([]byte{0xFF}, 40)
+	if err := Std140.Encode(dst, layoutVec3Padding{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst[:32], make([]byte, 32)) {
+		t.Errorf("Encode left padding bytes: %v", dst[:32])
+	}
+	if dst[32] != 0xFF {
+		t.Errorf("Encode wrote past the size of the value")
+	}
+	if err := Std140.Encode(dst[:31], layoutVec3Padding{}); err == nil {
+		t.Errorf("Encode into a short buffer succeeded")
+	}
+}
+
+func TestNilPointer(t *testing.T) {
+	var p *layoutVec3Padding
+	if _, err := Std430.Sizeof(p); err == nil {
+		t.Errorf("Sizeof of a nil pointer succeeded")
+	}
+	if _, err := Std430.Sizeof(nil); err == nil {
+		t.Errorf("Sizeof of nil succeeded")
+	}
+	if _, err := Std430.Marshal(p); err == nil {
+		t.Errorf("Marshal of a nil pointer succeeded")
+	}
+	if err := Std430.Encode(make([]byte, 32), p); err == nil {
+		t.Errorf("Encode of a nil pointer succeeded")
+	}
+	if _, err := Std430.Offsetof(p, "B"); err == nil {
+		t.Errorf("Offsetof of a nil pointer succeeded")
+	}
+}
+
+func TestOffsetof(t *testing.T) {
+	offset, err := Std140.Offsetof(layoutVec3Padding{}, "C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 28 {
+		t.Errorf("Offsetof = %d, want 28", offset)
+	}
+	if _, err = Std140.Offsetof(layoutVec3Padding{}, "D"); err == nil {
+		t.Errorf("Offsetof of a missing field succeeded")
+	}
+}
@@ -0,0 +1,95 @@
+package asch
+
+import (
+	"fmt"
+	"math/bits"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// MemoryIntent says how the CPU and the GPU are going to access a resource,
+// the memory type is picked from it.
+type MemoryIntent int
+
+const (
+	// MemoryGPUOnly is device local memory the CPU cannot map,
+	// fill it through a transfer.
+	MemoryGPUOnly MemoryIntent = iota
+	// MemoryCPUToGPU is host visible memory written by the CPU and read by the GPU,
+	// e.g. staging or per-frame uniform data.
+	MemoryCPUToGPU
+	// MemoryGPUToCPU is host visible, preferably cached and coherent memory for readbacks.
+	MemoryGPUToCPU
+	// MemoryCPUToGPUDeviceLocal is device local memory the CPU can map, found on unified
+	// memory devices and behind resizable BAR.
+	MemoryCPUToGPUDeviceLocal
+)
+
+func (i MemoryIntent) String() string {
+	switch i {
+	case MemoryGPUOnly:
+		return "GPUOnly"
+	case MemoryCPUToGPU:
+		return "CPUToGPU"
+	case MemoryGPUToCPU:
+		return "GPUToCPU"
+	case MemoryCPUToGPUDeviceLocal:
+		return "CPUToGPUDeviceLocal"
+	default:
+		return fmt.Sprintf("MemoryIntent(%d)", int(i))
+	}
+}
+
+// properties returns the required and the preferred memory property flags.
+func (i MemoryIntent) properties() (required, preferred vk.MemoryPropertyFlags) {
+	switch i {
+	case MemoryCPUToGPU:
+		return vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit),
+			vk.MemoryPropertyFlags(vk.MemoryPropertyHostCoherentBit)
+	case MemoryGPUToCPU:
+		return vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit),
+			vk.MemoryPropertyFlags(vk.MemoryPropertyHostCachedBit | vk.MemoryPropertyHostCoherentBit)
+	case MemoryCPUToGPUDeviceLocal:
+		return vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit | vk.MemoryPropertyHostVisibleBit),
+			vk.MemoryPropertyFlags(vk.MemoryPropertyHostCoherentBit)
+	default:
+		return 0, vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit)
+	}
+}
+
+// findMemoryType returns the memory type allowed by typeBits which has all the required
+// flags and most of the preferred ones.
+func findMemoryType(memProperties *vk.PhysicalDeviceMemoryProperties, typeBits uint32, required, preferred vk.MemoryPropertyFlags) (uint32, error) {
+	best, bestScore := -1, -1
+	for i := uint32(0); i < memProperties.MemoryTypeCount; i++ {
+		if typeBits&(1<<i) == 0 {
+			continue
+		}
+		flags := memProperties.MemoryTypes[i].PropertyFlags
+		if flags&required != required {
+			continue
+		}
+		score := bits.OnesCount32(uint32(flags & preferred))
+		if score > bestScore {
+			best, bestScore = int(i), score
+		}
+	}
+	if best < 0 {
+		err := fmt.Errorf("findMemoryType: no memory type in bits %#x has flags %#x", typeBits, required)
+		return 0, err
+	}
+	return uint32(best), nil
+}
+
+func getMemoryProperties(gpu vk.PhysicalDevice) vk.PhysicalDeviceMemoryProperties {
+	var memProperties vk.PhysicalDeviceMemoryProperties
+	vk.GetPhysicalDeviceMemoryProperties(gpu, &memProperties)
+	memProperties.Deref()
+	for i := range memProperties.MemoryTypes {
+		memProperties.MemoryTypes[i].Deref()
+	}
+	for i := range memProperties.MemoryHeaps {
+		memProperties.MemoryHeaps[i].Deref()
+	}
+	return memProperties
+}
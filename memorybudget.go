@@ -0,0 +1,103 @@
+package asch
+
+/*
+#include <stdint.h>
+#include <stddef.h>
+
+// VK_EXT_memory_budget is read through vkGetPhysicalDeviceMemoryProperties2, a Vulkan 1.1
+// entry point the bindings do not expose. It is loaded with vgo_vkGetInstanceProcAddr,
+// set by the bindings in vk.InitInstance.
+
+typedef void (*asch_PFN_vkVoidFunction)(void);
+typedef asch_PFN_vkVoidFunction (*asch_PFN_vkGetInstanceProcAddr)(void* instance, const char* name);
+
+extern asch_PFN_vkGetInstanceProcAddr vgo_vkGetInstanceProcAddr;
+
+#define ASCH_MAX_MEMORY_TYPES 32
+#define ASCH_MAX_MEMORY_HEAPS 16
+#define ASCH_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_PROPERTIES_2 1000059006
+#define ASCH_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_BUDGET_PROPERTIES_EXT 1000237000
+
+typedef struct {
+	int32_t  sType;
+	void*    pNext;
+	uint64_t heapBudget[ASCH_MAX_MEMORY_HEAPS];
+	uint64_t heapUsage[ASCH_MAX_MEMORY_HEAPS];
+} asch_VkPhysicalDeviceMemoryBudgetPropertiesEXT;
+
+typedef struct {
+	int32_t  sType;
+	void*    pNext;
+	uint32_t memoryTypeCount;
+	struct {
+		uint32_t propertyFlags;
+		uint32_t heapIndex;
+	} memoryTypes[ASCH_MAX_MEMORY_TYPES];
+	uint32_t memoryHeapCount;
+	struct {
+		uint64_t size;
+		uint32_t flags;
+	} memoryHeaps[ASCH_MAX_MEMORY_HEAPS];
+} asch_VkPhysicalDeviceMemoryProperties2;
+
+typedef void (*asch_PFN_vkGetPhysicalDeviceMemoryProperties2)(void* gpu, asch_VkPhysicalDeviceMemoryProperties2* properties);
+
+static void* asch_loadMemoryProperties2(void* instance) {
+	if (vgo_vkGetInstanceProcAddr == NULL) {
+		return NULL;
+	}
+	asch_PFN_vkVoidFunction fn = vgo_vkGetInstanceProcAddr(instance, "vkGetPhysicalDeviceMemoryProperties2");
+	if (fn == NULL) {
+		fn = vgo_vkGetInstanceProcAddr(instance, "vkGetPhysicalDeviceMemoryProperties2KHR");
+	}
+	return (void*)fn;
+}
+
+static uint32_t asch_getMemoryBudget(void* fn, void* gpu, uint64_t* budget, uint64_t* usage) {
+	asch_VkPhysicalDeviceMemoryBudgetPropertiesEXT budgetProperties = {0};
+	budgetProperties.sType = ASCH_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_BUDGET_PROPERTIES_EXT;
+	asch_VkPhysicalDeviceMemoryProperties2 properties = {0};
+	properties.sType = ASCH_STRUCTURE_TYPE_PHYSICAL_DEVICE_MEMORY_PROPERTIES_2;
+	properties.pNext = &budgetProperties;
+	((asch_PFN_vkGetPhysicalDeviceMemoryProperties2)fn)(gpu, &properties);
+	for (uint32_t i = 0; i < properties.memoryHeapCount; i++) {
+		budget[i] = budgetProperties.heapBudget[i];
+		usage[i] = budgetProperties.heapUsage[i];
+	}
+	return properties.memoryHeapCount;
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// memoryBudgetQuery reads the per heap budget and usage of VK_EXT_memory_budget.
+type memoryBudgetQuery struct {
+	fn  unsafe.Pointer
+	gpu vk.PhysicalDevice
+}
+
+// newMemoryBudgetQuery loads vkGetPhysicalDeviceMemoryProperties2 of the instance,
+// it returns nil when the instance has none.
+func newMemoryBudgetQuery(instance vk.Instance, gpu vk.PhysicalDevice) *memoryBudgetQuery {
+	fn := C.asch_loadMemoryProperties2(unsafe.Pointer(instance))
+	if fn == nil {
+		return nil
+	}
+	return &memoryBudgetQuery{fn: fn, gpu: gpu}
+}
+
+// heaps returns the budget and the process usage of every heap.
+func (q *memoryBudgetQuery) heaps() (budget, usage []vk.DeviceSize) {
+	var b, u [C.ASCH_MAX_MEMORY_HEAPS]C.uint64_t
+	n := C.asch_getMemoryBudget(q.fn, unsafe.Pointer(q.gpu), &b[0], &u[0])
+	budget, usage = make([]vk.DeviceSize, n), make([]vk.DeviceSize, n)
+	for i := range budget {
+		budget[i], usage[i] = vk.DeviceSize(b[i]), vk.DeviceSize(u[i])
+	}
+	return budget, usage
+}
@@ -0,0 +1,193 @@
+package asch
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// MipLevelsAuto asks CreateImage for a full mip chain down to 1x1.
+const MipLevelsAuto = ^uint32(0)
+
+// MipLevelsFor returns the number of levels of a full mip chain.
+func MipLevelsFor(width, height uint32) uint32 {
+	return uint32(bits.Len32(max(width, height, 1)))
+}
+
+// blitFeatures are needed to build mips with linear filtered blits.
+const blitFeatures = vk.FormatFeatureFlags(vk.FormatFeatureBlitSrcBit | vk.FormatFeatureBlitDstBit | vk.FormatFeatureSampledImageFilterLinearBit)
+
+// CanBlitMipmaps reports whether mips of format can be generated on the GPU.
+func (a *Allocator) CanBlitMipmaps(format vk.Format) bool {
+	return a.FormatSupported(format, blitFeatures)
+}
+
+// GenerateMipmaps fills the levels after the first from level 0 of every layer, which
+// must have been uploaded. With blits supported by the format they run on the graphics
+// queue at the next Flush, otherwise base, the tightly packed texels of level 0 of a
+// single layer image, is box filtered on the CPU and every level uploaded. The image
+// needs vk.ImageUsageTransferSrcBit and vk.ImageUsageTransferDstBit and ends in
+// vk.ImageLayoutShaderReadOnlyOptimal.
+func (u *Uploader) GenerateMipmaps(ctx context.Context, img *Image, base []byte) error {
+	var bases [][]byte
+	if base != nil {
+		bases = [][]byte{base}
+	}
+	return u.generateMipmaps(ctx, img, bases)
+}
+
+// generateMipmaps takes the level 0 texels of every layer for the CPU fallback.
+func (u *Uploader) generateMipmaps(ctx context.Context, img *Image, bases [][]byte) error {
+	if img.MipLevels == 1 {
+		return nil
+	}
+	transfer := vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit | vk.ImageUsageTransferDstBit)
+	if img.Usage&transfer != transfer {
+		return fmt.Errorf("GenerateMipmaps: image needs transfer source and destination usage")
+	}
+	if !u.allocator.CanBlitMipmaps(img.Format) {
+		return u.generateMipmapsCPU(ctx, img, bases)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.begin(ctx); err != nil {
+		return err
+	}
+	family := u.graphics.Family()
+	u.graphicsWork = append(u.graphicsWork, func(cmd vk.CommandBuffer) error {
+		return recordMipmapBlits(cmd, family, img)
+	})
+	return nil
+}
+
+// recordMipmapBlits halves every level into the next one, each level becoming a transfer
+// source once written, and finally makes all of them shader readable.
+func recordMipmapBlits(cmd vk.CommandBuffer, family uint32, img *Image) error {
+	barriers := NewBarriers(family)
+	barriers.Image(img, ImageRange{Levels: 1}, StateTransferSrc)
+	for level := uint32(1); level < img.MipLevels; level++ {
+		barriers.DiscardImage(img, ImageRange{BaseLevel: level, Levels: 1}, StateTransferDst)
+		if err := barriers.Record(cmd); err != nil {
+			return fmt.Errorf("GenerateMipmaps: %w", err)
+		}
+		src, dst := img.MipExtent(level-1), img.MipExtent(level)
+		blits := []vk.ImageBlit{{
+			SrcSubresource: vk.ImageSubresourceLayers{
+				AspectMask: img.Aspect(), MipLevel: level - 1, LayerCount: img.Layers,
+			},
+			SrcOffsets: [2]vk.Offset3D{{}, {X: int32(src.Width), Y: int32(src.Height), Z: int32(src.Depth)}},
+			DstSubresource: vk.ImageSubresourceLayers{
+				AspectMask: img.Aspect(), MipLevel: level, LayerCount: img.Layers,
+			},
+			DstOffsets: [2]vk.Offset3D{{}, {X: int32(dst.Width), Y: int32(dst.Height), Z: int32(dst.Depth)}},
+		}}
+		vk.CmdBlitImage(cmd, img.Handle, vk.ImageLayoutTransferSrcOptimal,
+			img.Handle, vk.ImageLayoutTransferDstOptimal, 1, blits, vk.FilterLinear)
+		if level+1 < img.MipLevels {
+			barriers.Image(img, ImageRange{BaseLevel: level, Levels: 1}, StateTransferSrc)
+		}
+	}
+	if err := barriers.Record(cmd); err != nil {
+		return fmt.Errorf("GenerateMipmaps: %w", err)
+	}
+	barriers.Image(img, ImageRange{}, StateShaderRead)
+	if err := barriers.Record(cmd); err != nil {
+		return fmt.Errorf("GenerateMipmaps: %w", err)
+	}
+	return nil
+}
+
+func (u *Uploader) generateMipmapsCPU(ctx context.Context, img *Image, bases [][]byte) error {
+	channels, channelSize, srgb, ok := boxFilterFormat(img.Format)
+	if !ok {
+		return fmt.Errorf("GenerateMipmaps: format %d supports neither blits nor the CPU box filter", img.Format)
+	}
+	if len(bases) != int(img.Layers) || img.Extent.Depth != 1 {
+		return fmt.Errorf("GenerateMipmaps: format %d cannot be blitted, the CPU fallback needs level 0 of a 2D image", img.Format)
+	}
+	for layer, level := range bases {
+		for i := uint32(1); i < img.MipLevels; i++ {
+			extent := img.MipExtent(i - 1)
+			level = boxFilter(level, int(extent.Width), int(extent.Height), channels, channelSize, srgb)
+			if err := u.UploadImageData(ctx, img, i, uint32(layer), level); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// boxFilterFormat describes the formats the CPU box filter handles, UNORM and sRGB color
+// with 8 or 16 bits in every component.
+func boxFilterFormat(format vk.Format) (channels, channelSize int, srgb, ok bool) {
+	info, ok := LookupFormat(format)
+	if !ok || info.IsCompressed() || info.Aspect != aspectColor || (info.Numeric != NumericUnorm && info.Numeric != NumericSrgb) {
+		return 0, 0, false, false
+	}
+	bits := info.Bits[0]
+	for _, b := range info.Bits[:info.Components] {
+		if b != bits || (b != 8 && b != 16) {
+			return 0, 0, false, false
+		}
+	}
+	return int(info.Components), int(bits / 8), info.IsSRGB(), true
+}
+
+// boxFilter averages 2x2 texels of a w x h level into the next level. sRGB color is
+// averaged in linear space, alpha, the fourth channel, always is.
+func boxFilter(src []byte, w, h, channels, channelSize int, srgb bool) []byte {
+	nw, nh := max(w/2, 1), max(h/2, 1)
+	texel := channels * channelSize
+	scale := float64(uint64(1)<<(8*channelSize) - 1)
+	read := func(x, y, c int) float64 {
+		x, y = min(x, w-1), min(y, h-1)
+		i := (y*w+x)*texel + c*channelSize
+		var v float64
+		if channelSize == 1 {
+			v = float64(src[i]) / scale
+		} else {
+			v = float64(binary.LittleEndian.Uint16(src[i:])) / scale
+		}
+		if srgb && c < 3 {
+			v = srgbToLinear(v)
+		}
+		return v
+	}
+	dst := make([]byte, nw*nh*texel)
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			for c := 0; c < channels; c++ {
+				v := (read(2*x, 2*y, c) + read(2*x+1, 2*y, c) + read(2*x, 2*y+1, c) + read(2*x+1, 2*y+1, c)) / 4
+				if srgb && c < 3 {
+					v = linearToSrgb(v)
+				}
+				i := (y*nw+x)*texel + c*channelSize
+				if channelSize == 1 {
+					dst[i] = uint8(math.Round(v * scale))
+				} else {
+					binary.LittleEndian.PutUint16(dst[i:], uint16(math.Round(v*scale)))
+				}
+			}
+		}
+	}
+	return dst
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(c float64) float64 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
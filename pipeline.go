@@ -7,21 +7,66 @@ import (
 )
 
 type VulkanGfxPipelineInfo struct {
-	device   vk.Device
-	layout   vk.PipelineLayout
-	cache    vk.PipelineCache
-	pipeline vk.Pipeline
+	device        vk.Device
+	layout        vk.PipelineLayout
+	cache         vk.PipelineCache
+	pipeline      vk.Pipeline
+	pushConstants []vk.PushConstantRange
 }
 
+// GraphicsPipelineConfig holds what differs between the graphics pipelines.
+type GraphicsPipelineConfig struct {
+	DisplaySize vk.Extent2D
+	RenderPass  vk.RenderPass
+	// Vertex is the vertex input state, build it with NewVertexLayout from the vertex types.
+	Vertex VertexLayout
+	// SetLayouts are the descriptor set layouts of the pipeline layout, by set number,
+	// see DescriptorLayoutCache.
+	SetLayouts []vk.DescriptorSetLayout
+	// PushConstants are the push constant ranges of the pipeline layout, see
+	// PushConstantRangeFor. They must fit into the maxPushConstantsSize of the device.
+	PushConstants []vk.PushConstantRange
+}
+
+// NewGraphicsPipeline creates the pipeline drawing the demo triangle.
 func NewGraphicsPipeline(device vk.Device, displaySize vk.Extent2D, renderPass vk.RenderPass) (VulkanGfxPipelineInfo, error) {
+	vertex, err := NewVertexLayout(PerVertex[TriangleVertex](0))
+	if err != nil {
+		return VulkanGfxPipelineInfo{}, err
+	}
+	return newGraphicsPipeline(device, minPushConstantsSize, GraphicsPipelineConfig{
+		DisplaySize: displaySize,
+		RenderPass:  renderPass,
+		Vertex:      vertex,
+	})
+}
+
+// NewGraphicsPipelineWith creates a graphics pipeline from config, checking its push
+// constants against the limits of v.
+func NewGraphicsPipelineWith(v *Vulkan, config GraphicsPipelineConfig) (VulkanGfxPipelineInfo, error) {
+	return newGraphicsPipeline(v.Device, max(v.Properties.Limits.MaxPushConstantsSize, minPushConstantsSize), config)
+}
+
+func newGraphicsPipeline(device vk.Device, maxPushConstantsSize uint32, config GraphicsPipelineConfig) (VulkanGfxPipelineInfo, error) {
 
 	var gfxPipeline VulkanGfxPipelineInfo
+	displaySize := config.DisplaySize
+	if len(config.Vertex.Bindings) == 0 {
+		return gfxPipeline, fmt.Errorf("NewGraphicsPipeline: no vertex bindings")
+	}
+	if err := validatePushConstantRanges(config.PushConstants, maxPushConstantsSize); err != nil {
+		return gfxPipeline, fmt.Errorf("NewGraphicsPipeline: %w", err)
+	}
 
 	// Phase 1: vk.CreatePipelineLayout
-	//			create pipeline layout (empty)
+	//			create pipeline layout with the descriptor set layouts and push constant ranges
 
 	pipelineLayoutCreateInfo := vk.PipelineLayoutCreateInfo{
-		SType: vk.StructureTypePipelineLayoutCreateInfo,
+		SType:                  vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount:         uint32(len(config.SetLayouts)),
+		PSetLayouts:            config.SetLayouts,
+		PushConstantRangeCount: uint32(len(config.PushConstants)),
+		PPushConstantRanges:    config.PushConstants,
 	}
 	err := vk.Error(vk.CreatePipelineLayout(device, &pipelineLayoutCreateInfo, nil, &gfxPipeline.layout))
 	if err != nil {
@@ -130,24 +175,7 @@ func NewGraphicsPipeline(device vk.Device, displaySize vk.Extent2D, renderPass v
 		Topology:               vk.PrimitiveTopologyTriangleList,
 		PrimitiveRestartEnable: vk.False,
 	}
-	vertexInputBindings := []vk.VertexInputBindingDescription{{
-		Binding:   0,
-		Stride:    3 * 4, // 4 = sizeof(float32)
-		InputRate: vk.VertexInputRateVertex,
-	}}
-	vertexInputAttributes := []vk.VertexInputAttributeDescription{{
-		Binding:  0,
-		Location: 0,
-		Format:   vk.FormatR32g32b32Sfloat,
-		Offset:   0,
-	}}
-	vertexInputState := vk.PipelineVertexInputStateCreateInfo{
-		SType:                           vk.StructureTypePipelineVertexInputStateCreateInfo,
-		VertexBindingDescriptionCount:   1,
-		PVertexBindingDescriptions:      vertexInputBindings,
-		VertexAttributeDescriptionCount: 1,
-		PVertexAttributeDescriptions:    vertexInputAttributes,
-	}
+	vertexInputState := config.Vertex.createInfo()
 
 	// Phase 5: vk.CreatePipelineCache
 	//			vk.CreateGraphicsPipelines
@@ -172,7 +200,7 @@ func NewGraphicsPipeline(device vk.Device, displaySize vk.Extent2D, renderPass v
 		PColorBlendState:    &colorBlendState,
 		PDynamicState:       &dynamicState,
 		Layout:              gfxPipeline.layout,
-		RenderPass:          renderPass,
+		RenderPass:          config.RenderPass,
 	}}
 	pipelines := make([]vk.Pipeline, 1)
 	err = vk.Error(vk.CreateGraphicsPipelines(device,
@@ -183,9 +211,25 @@ func NewGraphicsPipeline(device vk.Device, displaySize vk.Extent2D, renderPass v
 	}
 	gfxPipeline.pipeline = pipelines[0]
 	gfxPipeline.device = device
+	gfxPipeline.pushConstants = config.PushConstants
 	return gfxPipeline, nil
 }
 
+// Layout returns the pipeline layout, for binding descriptor sets.
+func (gfx *VulkanGfxPipelineInfo) Layout() vk.PipelineLayout {
+	return gfx.layout
+}
+
+// PushConstantLayout returns the pipeline layout with its push constant ranges, for PushConstants.
+func (gfx *VulkanGfxPipelineInfo) PushConstantLayout() PushConstantLayout {
+	return PushConstantLayout{Layout: gfx.layout, Ranges: gfx.pushConstants}
+}
+
+// BindDescriptorSets binds sets starting at set number first.
+func (gfx *VulkanGfxPipelineInfo) BindDescriptorSets(cmd vk.CommandBuffer, first uint32, sets ...vk.DescriptorSet) {
+	vk.CmdBindDescriptorSets(cmd, vk.PipelineBindPointGraphics, gfx.layout, first, uint32(len(sets)), sets, 0, nil)
+}
+
 func (gfx *VulkanGfxPipelineInfo) Destroy() {
 	if gfx == nil {
 		return
@@ -0,0 +1,94 @@
+package asch
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// minPushConstantsSize is the maxPushConstantsSize every device supports.
+const minPushConstantsSize = 128
+
+// PushConstantRangeFor returns the range of the stages holding a T laid out with std430
+// rules at offset.
+func PushConstantRangeFor[T any](stages vk.ShaderStageFlags, offset uint32) (vk.PushConstantRange, error) {
+	_, size, err := Std430.Layout(reflect.TypeFor[T]())
+	if err != nil {
+		return vk.PushConstantRange{}, err
+	}
+	return vk.PushConstantRange{StageFlags: stages, Offset: offset, Size: size}, nil
+}
+
+// validatePushConstantRanges checks the ranges of a pipeline layout: multiples of 4 within
+// maxSize, each stage in one range at most.
+func validatePushConstantRanges(ranges []vk.PushConstantRange, maxSize uint32) error {
+	var seen vk.ShaderStageFlags
+	for i, r := range ranges {
+		switch {
+		case r.StageFlags == 0:
+			return fmt.Errorf("push constant range %d has no stages", i)
+		case r.Size == 0 || r.Offset%4 != 0 || r.Size%4 != 0:
+			return fmt.Errorf("push constant range %d of %d bytes at %d is not made of multiples of 4", i, r.Size, r.Offset)
+		case r.Offset+r.Size > maxSize:
+			return fmt.Errorf("push constant range %d ends at %d, past maxPushConstantsSize %d", i, r.Offset+r.Size, maxSize)
+		case r.StageFlags&seen != 0:
+			return fmt.Errorf("push constant range %d repeats stages %#x", i, r.StageFlags&seen)
+		}
+		seen |= r.StageFlags
+	}
+	return nil
+}
+
+// PushConstantLayout is a pipeline layout together with its push constant ranges.
+type PushConstantLayout struct {
+	Layout vk.PipelineLayout
+	Ranges []vk.PushConstantRange
+}
+
+// check applies the rules of vkCmdPushConstants: every stage pushed to has a range
+// covering the bytes, every range overlapping them is pushed to with all its stages.
+func (l PushConstantLayout) check(stages vk.ShaderStageFlags, offset, size uint32) error {
+	if stages == 0 {
+		return fmt.Errorf("no stages")
+	}
+	if size == 0 || offset%4 != 0 || size%4 != 0 {
+		return fmt.Errorf("%d bytes at %d are not made of multiples of 4", size, offset)
+	}
+	for stage := vk.ShaderStageFlags(1); stage != 0 && stage <= stages; stage <<= 1 {
+		if stages&stage == 0 {
+			continue
+		}
+		covered := false
+		for _, r := range l.Ranges {
+			if r.StageFlags&stage != 0 && r.Offset <= offset && offset+size <= r.Offset+r.Size {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fmt.Errorf("no range of stage %#x covers %d bytes at %d", stage, size, offset)
+		}
+	}
+	for _, r := range l.Ranges {
+		if r.Offset < offset+size && offset < r.Offset+r.Size && r.StageFlags&^stages != 0 {
+			return fmt.Errorf("range of stages %#x overlaps %d bytes at %d, pushed to stages %#x", r.StageFlags, size, offset, stages)
+		}
+	}
+	return nil
+}
+
+// PushConstants encodes value with std430 rules, the layout of push constant blocks,
+// and records it into cmd for the stages at offset.
+func PushConstants[T any](cmd vk.CommandBuffer, layout PushConstantLayout, stages vk.ShaderStageFlags, offset uint32, value T) error {
+	data, err := Std430.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("PushConstants: %w", err)
+	}
+	if err = layout.check(stages, offset, uint32(len(data))); err != nil {
+		return fmt.Errorf("PushConstants: %w", err)
+	}
+	vk.CmdPushConstants(cmd, layout.Layout, stages, offset, uint32(len(data)), unsafe.Pointer(&data[0]))
+	return nil
+}
@@ -0,0 +1,189 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// QueueFamilyIndices lists the queue family used for each logical role.
+// Roles may share a family; the dedicated compute and transfer families
+// are preferred when the device exposes them.
+type QueueFamilyIndices struct {
+	Graphics uint32
+	Present  uint32
+	Compute  uint32
+	Transfer uint32
+}
+
+// QueueStats are cumulative counters of a Queue.
+type QueueStats struct {
+	Submits     uint64        // vk.QueueSubmit calls
+	SubmitInfos uint64        // submit batches over all calls
+	Presents    uint64        // vk.QueuePresent calls
+	WaitIdles   uint64        // vk.QueueWaitIdle calls
+	Errors      uint64        // calls that did not return vk.Success
+	Busy        time.Duration // time spent inside the driver calls
+}
+
+// Queue serializes access to a vk.Queue. vkQueueSubmit, vkQueuePresentKHR and
+// vkQueueWaitIdle require external synchronization, so all of them go through one mutex.
+type Queue struct {
+	mu     sync.Mutex
+	handle vk.Queue
+	family uint32
+	index  uint32
+	stats  QueueStats
+}
+
+func newQueue(device vk.Device, family, index uint32) *Queue {
+	q := &Queue{
+		family: family,
+		index:  index,
+	}
+	vk.GetDeviceQueue(device, family, index, &q.handle)
+	return q
+}
+
+// Handle returns the raw queue. Using it directly bypasses the synchronization.
+func (q *Queue) Handle() vk.Queue {
+	return q.handle
+}
+
+func (q *Queue) Family() uint32 {
+	return q.family
+}
+
+// Submit submits all batches with a single vk.QueueSubmit call.
+func (q *Queue) Submit(fence vk.Fence, submits ...vk.SubmitInfo) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	start := time.Now()
+	ret := vk.QueueSubmit(q.handle, uint32(len(submits)), submits, fence)
+	q.stats.Busy += time.Since(start)
+	q.stats.Submits++
+	q.stats.SubmitInfos += uint64(len(submits))
+	if err := vk.Error(ret); err != nil {
+		q.stats.Errors++
+		return fmt.Errorf("vk.QueueSubmit failed with %s", err)
+	}
+	return nil
+}
+
+// Present returns the raw result, so callers can tell vk.Suboptimal and
+// vk.ErrorOutOfDate apart from real failures.
+func (q *Queue) Present(presentInfo *vk.PresentInfo) vk.Result {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	start := time.Now()
+	ret := vk.QueuePresent(q.handle, presentInfo)
+	q.stats.Busy += time.Since(start)
+	q.stats.Presents++
+	if ret != vk.Success {
+		q.stats.Errors++
+	}
+	return ret
+}
+
+// WaitIdle waits until the queue is idle. vk.QueueWaitIdle takes no timeout, so the
+// context is only checked before the call.
+func (q *Queue) WaitIdle(ctx context.Context) error {
+	return waitBlocking(ctx, "vk.QueueWaitIdle", func() error {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		start := time.Now()
+		ret := vk.QueueWaitIdle(q.handle)
+		q.stats.Busy += time.Since(start)
+		q.stats.WaitIdles++
+		if err := vk.Error(ret); err != nil {
+			q.stats.Errors++
+			return fmt.Errorf("vk.QueueWaitIdle failed with %s", err)
+		}
+		return nil
+	})
+}
+
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+func findQueueFamilies(gpu vk.PhysicalDevice, surface vk.Surface) (QueueFamilyIndices, error) {
+	var familyCount uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &familyCount, nil)
+	families := make([]vk.QueueFamilyProperties, familyCount)
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &familyCount, families)
+
+	const none = ^uint32(0)
+	indices := QueueFamilyIndices{Graphics: none, Present: none, Compute: none, Transfer: none}
+	has := func(flags vk.QueueFlags, bit vk.QueueFlagBits) bool {
+		return flags&vk.QueueFlags(bit) != 0
+	}
+	for i := range families {
+		families[i].Deref()
+		family := uint32(i)
+		flags := families[i].QueueFlags
+		if families[i].QueueCount == 0 {
+			continue
+		}
+		var supported vk.Bool32
+		vk.GetPhysicalDeviceSurfaceSupport(gpu, family, surface, &supported)
+
+		if has(flags, vk.QueueGraphicsBit) {
+			// prefer a graphics family which can also present
+			if indices.Graphics == none || (supported.B() && indices.Present != indices.Graphics) {
+				indices.Graphics = family
+				if supported.B() {
+					indices.Present = family
+				}
+			}
+		}
+		if supported.B() && indices.Present == none {
+			indices.Present = family
+		}
+		if has(flags, vk.QueueComputeBit) && !has(flags, vk.QueueGraphicsBit) && indices.Compute == none {
+			indices.Compute = family
+		}
+		if has(flags, vk.QueueTransferBit) && !has(flags, vk.QueueGraphicsBit) && !has(flags, vk.QueueComputeBit) && indices.Transfer == none {
+			indices.Transfer = family
+		}
+	}
+	if indices.Graphics == none {
+		return indices, fmt.Errorf("findQueueFamilies: no graphics queue family found")
+	}
+	if indices.Present == none {
+		return indices, fmt.Errorf("findQueueFamilies: no queue family can present to the surface")
+	}
+	if indices.Compute == none {
+		indices.Compute = indices.Graphics
+	}
+	if indices.Transfer == none {
+		// graphics and compute families implicitly support transfers
+		indices.Transfer = indices.Compute
+	}
+	return indices, nil
+}
+
+// unique returns the distinct families in a stable order.
+func (f QueueFamilyIndices) unique() []uint32 {
+	return uniqueFamilies([]uint32{f.Graphics, f.Present, f.Compute, f.Transfer})
+}
+
+// uniqueFamilies returns the families without repetitions, in their order.
+func uniqueFamilies(all []uint32) []uint32 {
+	var families []uint32
+	for _, family := range all {
+		found := false
+		for _, known := range families {
+			found = found || known == family
+		}
+		if !found {
+			families = append(families, family)
+		}
+	}
+	return families
+}
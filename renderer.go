@@ -2,6 +2,7 @@ package asch
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	vk "github.com/tomas-mraz/vulkan"
 )
@@ -13,9 +14,22 @@ type VulkanRenderInfo struct {
 	cmdBuffers []vk.CommandBuffer
 	semaphores []vk.Semaphore
 	fences     []vk.Fence
+	frames     *frameCounter
+
+	// Deletions is collected by DrawFrame whenever a frame completes and flushed by
+	// DestroyInOrder, NewRenderer sets it to the device level Vulkan.Deletions.
+	Deletions *DeletionQueue
+}
+
+// frameCounter is shared by the copies of VulkanRenderInfo passed around by value.
+type frameCounter struct {
+	current   atomic.Uint64
+	completed atomic.Uint64
 }
 
-func NewRenderer(device vk.Device, displayFormat vk.Format) (VulkanRenderInfo, error) {
+// NewRenderer creates the render pass and the command pool of the graphics queue of v.
+func NewRenderer(v *Vulkan, displayFormat vk.Format) (VulkanRenderInfo, error) {
+	device := v.Device
 	attachmentDescriptions := []vk.AttachmentDescription{{
 		Format:         displayFormat,
 		Samples:        vk.SampleCount1Bit,
@@ -45,7 +59,7 @@ func NewRenderer(device vk.Device, displayFormat vk.Format) (VulkanRenderInfo, e
 	cmdPoolCreateInfo := vk.CommandPoolCreateInfo{
 		SType:            vk.StructureTypeCommandPoolCreateInfo,
 		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateResetCommandBufferBit),
-		QueueFamilyIndex: 0,
+		QueueFamilyIndex: v.Queue.Family(),
 	}
 	var r VulkanRenderInfo
 	err := vk.Error(vk.CreateRenderPass(device, &renderPassCreateInfo, nil, &r.RenderPass))
@@ -59,6 +73,9 @@ func NewRenderer(device vk.Device, displayFormat vk.Format) (VulkanRenderInfo, e
 		return r, err
 	}
 	r.device = device
+	r.Deletions = v.Deletions
+	r.frames = &frameCounter{}
+	r.frames.current.Store(1)
 	return r, nil
 }
 
@@ -85,3 +102,23 @@ func (r *VulkanRenderInfo) DefaultFence() vk.Fence {
 func (r *VulkanRenderInfo) DefaultSemaphore() vk.Semaphore {
 	return r.semaphores[0]
 }
+
+// Frame returns the number of the frame DrawFrame submits next. Use it as the
+// DeletionQueue point of resources the frame is using, frame numbers start at 1.
+func (r *VulkanRenderInfo) Frame() uint64 {
+	return r.frames.current.Load()
+}
+
+// CompletedFrame returns the number of the last frame the GPU has finished.
+func (r *VulkanRenderInfo) CompletedFrame() uint64 {
+	return r.frames.completed.Load()
+}
+
+// completeFrame advances the frame counter after the frame fence was signalled.
+func (r *VulkanRenderInfo) completeFrame() {
+	completed := r.frames.current.Add(1) - 1
+	r.frames.completed.Store(completed)
+	if r.Deletions != nil {
+		r.Deletions.Collect(completed)
+	}
+}
@@ -0,0 +1,140 @@
+package asch
+
+import (
+	"fmt"
+	"sync"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// SamplerDesc describes a sampler. It is comparable, identical descriptions share one
+// vk.Sampler through the SamplerCache. The zero value samples the nearest texel of mip 0
+// with repeat addressing, DefaultSamplerDesc is the usual trilinear one.
+type SamplerDesc struct {
+	MagFilter  vk.Filter
+	MinFilter  vk.Filter
+	MipmapMode vk.SamplerMipmapMode
+	AddressU   vk.SamplerAddressMode
+	AddressV   vk.SamplerAddressMode
+	AddressW   vk.SamplerAddressMode
+	// MaxAnisotropy above 1 enables anisotropic filtering. It is clamped to
+	// maxSamplerAnisotropy and ignored without the samplerAnisotropy feature.
+	MaxAnisotropy float32
+	// Compare enables depth comparison with CompareOp, for shadow maps.
+	Compare     bool
+	CompareOp   vk.CompareOp
+	BorderColor vk.BorderColor
+	MipLodBias  float32
+	MinLod      float32
+	// MaxLod limits the mip levels, vk.LodClampNone reaches all of them.
+	MaxLod float32
+}
+
+// DefaultSamplerDesc returns trilinear filtering with repeat addressing over all mips.
+func DefaultSamplerDesc() SamplerDesc {
+	return SamplerDesc{
+		MagFilter:  vk.FilterLinear,
+		MinFilter:  vk.FilterLinear,
+		MipmapMode: vk.SamplerMipmapModeLinear,
+		AddressU:   vk.SamplerAddressModeRepeat,
+		AddressV:   vk.SamplerAddressModeRepeat,
+		AddressW:   vk.SamplerAddressModeRepeat,
+		MaxLod:     vk.LodClampNone,
+	}
+}
+
+// SamplerCache creates every distinct sampler once. Devices may allow as few as
+// 4000 samplers (maxSamplerAllocationCount), so samplers should not be created per texture.
+type SamplerCache struct {
+	mu            sync.Mutex
+	device        vk.Device
+	anisotropy    bool
+	maxAnisotropy float32
+	maxSamplers   uint32
+	samplers      map[SamplerDesc]vk.Sampler
+}
+
+func NewSamplerCache(v *Vulkan) *SamplerCache {
+	return &SamplerCache{
+		device:        v.Device,
+		anisotropy:    v.Features.SamplerAnisotropy,
+		maxAnisotropy: v.Properties.Limits.MaxSamplerAnisotropy,
+		maxSamplers:   v.Properties.Limits.MaxSamplerAllocationCount,
+		samplers:      make(map[SamplerDesc]vk.Sampler),
+	}
+}
+
+// Get returns the sampler of desc, creating it on first use.
+func (c *SamplerCache) Get(desc SamplerDesc) (vk.Sampler, error) {
+	desc = c.normalize(desc)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sampler, ok := c.samplers[desc]; ok {
+		return sampler, nil
+	}
+	if c.maxSamplers > 0 && uint32(len(c.samplers)) >= c.maxSamplers {
+		return vk.NullSampler, fmt.Errorf("SamplerCache.Get: maxSamplerAllocationCount of %d reached", c.maxSamplers)
+	}
+
+	// Phase 1: vk.CreateSampler
+
+	samplerCreateInfo := vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    desc.MagFilter,
+		MinFilter:    desc.MinFilter,
+		MipmapMode:   desc.MipmapMode,
+		AddressModeU: desc.AddressU,
+		AddressModeV: desc.AddressV,
+		AddressModeW: desc.AddressW,
+		MipLodBias:   desc.MipLodBias,
+		CompareOp:    desc.CompareOp,
+		MinLod:       desc.MinLod,
+		MaxLod:       desc.MaxLod,
+		BorderColor:  desc.BorderColor,
+	}
+	if desc.MaxAnisotropy > 1 {
+		samplerCreateInfo.AnisotropyEnable = vk.True
+		samplerCreateInfo.MaxAnisotropy = desc.MaxAnisotropy
+	}
+	if desc.Compare {
+		samplerCreateInfo.CompareEnable = vk.True
+	}
+	var sampler vk.Sampler
+	err := vk.Error(vk.CreateSampler(c.device, &samplerCreateInfo, nil, &sampler))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateSampler failed with %s", err)
+		return vk.NullSampler, err
+	}
+	c.samplers[desc] = sampler
+	return sampler, nil
+}
+
+// normalize applies the device limits, so descriptions ending up equal share a sampler.
+func (c *SamplerCache) normalize(desc SamplerDesc) SamplerDesc {
+	if !c.anisotropy || desc.MaxAnisotropy <= 1 {
+		desc.MaxAnisotropy = 0
+	} else {
+		desc.MaxAnisotropy = min(desc.MaxAnisotropy, c.maxAnisotropy)
+	}
+	if !desc.Compare {
+		desc.CompareOp = 0
+	}
+	return desc
+}
+
+// Len returns the number of samplers created.
+func (c *SamplerCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.samplers)
+}
+
+// Destroy destroys all samplers, the GPU must be done with them.
+func (c *SamplerCache) Destroy() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for desc, sampler := range c.samplers {
+		vk.DestroySampler(c.device, sampler, nil)
+		delete(c.samplers, desc)
+	}
+}
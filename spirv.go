@@ -0,0 +1,311 @@
+package asch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const spirvMagic = 0x07230203
+
+// SPIR-V opcodes, decorations and storage classes the reflection needs.
+const (
+	spirvOpName             = 5
+	spirvOpMemberName       = 6
+	spirvOpTypeMatrix       = 24
+	spirvOpTypeArray        = 28
+	spirvOpTypeRuntimeArray = 29
+	spirvOpTypeStruct       = 30
+	spirvOpTypePointer      = 32
+	spirvOpConstant         = 43
+	spirvOpVariable         = 59
+	spirvOpDecorate         = 71
+	spirvOpMemberDecorate   = 72
+
+	spirvDecorationBlock         = 2
+	spirvDecorationBufferBlock   = 3
+	spirvDecorationRowMajor      = 4
+	spirvDecorationArrayStride   = 6
+	spirvDecorationMatrixStride  = 7
+	spirvDecorationBinding       = 33
+	spirvDecorationDescriptorSet = 34
+	spirvDecorationOffset        = 35
+
+	spirvStorageUniform       = 2
+	spirvStoragePushConstant  = 9
+	spirvStorageStorageBuffer = 12
+)
+
+// spirvOperands are the fewest operands of the instructions the reflection reads.
+var spirvOperands = map[uint32]int{
+	spirvOpName:             2,
+	spirvOpMemberName:       3,
+	spirvOpTypeMatrix:       3,
+	spirvOpTypeArray:        3,
+	spirvOpTypeRuntimeArray: 2,
+	spirvOpTypeStruct:       1,
+	spirvOpTypePointer:      3,
+	spirvOpConstant:         3,
+	spirvOpVariable:         3,
+	spirvOpDecorate:         2,
+	spirvOpMemberDecorate:   3,
+}
+
+// spirvDecorationOperands are the operands of the decorations the reflection reads.
+var spirvDecorationOperands = map[uint32]int{
+	spirvDecorationArrayStride:   1,
+	spirvDecorationMatrixStride:  1,
+	spirvDecorationBinding:       1,
+	spirvDecorationDescriptorSet: 1,
+	spirvDecorationOffset:        1,
+}
+
+// spirvMaxTypeDepth bounds the nesting of block member types.
+const spirvMaxTypeDepth = 64
+
+// shaderBlock is a uniform, storage or push constant block declared by a shader.
+type shaderBlock struct {
+	Name         string
+	StorageClass uint32
+	Set          uint32
+	Binding      uint32
+	Members      []shaderBlockMember
+}
+
+type shaderBlockMember struct {
+	Name   string
+	Offset uint32
+	// MatrixStride and RowMajor apply to matrices and arrays of them.
+	MatrixStride uint32
+	RowMajor     bool
+	Type         *shaderType
+}
+
+// shaderType is the type of a block member, scalars and vectors are left empty.
+type shaderType struct {
+	// Members are the members of structs.
+	Members []shaderBlockMember
+	// Array and Matrix types have an element type, the column type of matrices. Length
+	// is the length of arrays, zero for runtime arrays, or the columns of matrices.
+	Array       bool
+	Matrix      bool
+	Elem        *shaderType
+	Length      uint32
+	ArrayStride uint32
+}
+
+// reflectBlocks lists the interface blocks of a SPIR-V module.
+func reflectBlocks(code []byte) ([]shaderBlock, error) {
+	if len(code)%4 != 0 || len(code) < 20 {
+		return nil, fmt.Errorf("SPIR-V module of %d bytes is malformed", len(code))
+	}
+	words := make([]uint32, len(code)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(code[4*i:])
+	}
+	if words[0] != spirvMagic {
+		return nil, fmt.Errorf("SPIR-V magic number %#x is invalid", words[0])
+	}
+
+	type structType struct {
+		declared    bool
+		block       bool
+		bufferBlock bool
+		members     []shaderBlockMember
+		memberTypes []uint32
+	}
+	// compositeType is an array, a runtime array or a matrix
+	type compositeType struct {
+		opcode uint32
+		elem   uint32
+		// length is the id of the length constant of arrays, the columns of matrices
+		length uint32
+	}
+	names := make(map[uint32]string)
+	sets := make(map[uint32]uint32)
+	bindings := make(map[uint32]uint32)
+	structs := make(map[uint32]*structType)
+	composites := make(map[uint32]compositeType)
+	constants := make(map[uint32]uint32)
+	arrayStrides := make(map[uint32]uint32)
+	pointers := make(map[uint32]uint32)
+	getStruct := func(id uint32) *structType {
+		if structs[id] == nil {
+			structs[id] = &structType{}
+		}
+		return structs[id]
+	}
+	member := func(s *structType, i uint32) (*shaderBlockMember, error) {
+		// a struct cannot have more members than the module has words
+		if i >= uint32(len(words)) {
+			return nil, fmt.Errorf("SPIR-V member index %d is out of range", i)
+		}
+		for uint32(len(s.members)) <= i {
+			s.members = append(s.members, shaderBlockMember{})
+		}
+		return &s.members[i], nil
+	}
+	var variables [][3]uint32 // pointer type, id, storage class
+
+	for i := 5; i < len(words); {
+		count, opcode := int(words[i]>>16), words[i]&0xFFFF
+		if count == 0 || i+count > len(words) {
+			return nil, fmt.Errorf("SPIR-V instruction at word %d is truncated", i)
+		}
+		args := words[i+1 : i+count]
+		if len(args) < spirvOperands[opcode] {
+			return nil, fmt.Errorf("SPIR-V instruction %d at word %d has %d operands, expected %d", opcode, i, len(args), spirvOperands[opcode])
+		}
+		switch opcode {
+		case spirvOpDecorate, spirvOpMemberDecorate:
+			decoration, n := args[1], 2
+			if opcode == spirvOpMemberDecorate {
+				decoration, n = args[2], 3
+			}
+			if len(args) < n+spirvDecorationOperands[decoration] {
+				return nil, fmt.Errorf("SPIR-V decoration %d at word %d lacks its operands", decoration, i)
+			}
+		}
+
+		switch opcode {
+		case spirvOpName:
+			names[args[0]] = spirvString(args[1:])
+		case spirvOpMemberName:
+			m, err := member(getStruct(args[0]), args[1])
+			if err != nil {
+				return nil, err
+			}
+			m.Name = spirvString(args[2:])
+		case spirvOpTypeStruct:
+			s := getStruct(args[0])
+			s.declared = true
+			s.memberTypes = args[1:]
+			for j := range args[1:] {
+				if _, err := member(s, uint32(j)); err != nil {
+					return nil, err
+				}
+			}
+		case spirvOpTypeArray, spirvOpTypeMatrix:
+			composites[args[0]] = compositeType{opcode: opcode, elem: args[1], length: args[2]}
+		case spirvOpTypeRuntimeArray:
+			composites[args[0]] = compositeType{opcode: opcode, elem: args[1]}
+		case spirvOpConstant:
+			constants[args[1]] = args[2]
+		case spirvOpTypePointer:
+			pointers[args[0]] = args[2]
+		case spirvOpVariable:
+			variables = append(variables, [3]uint32{args[0], args[1], args[2]})
+		case spirvOpDecorate:
+			switch args[1] {
+			case spirvDecorationBlock:
+				getStruct(args[0]).block = true
+			case spirvDecorationBufferBlock:
+				getStruct(args[0]).block = true
+				getStruct(args[0]).bufferBlock = true
+			case spirvDecorationArrayStride:
+				arrayStrides[args[0]] = args[2]
+			case spirvDecorationBinding:
+				bindings[args[0]] = args[2]
+			case spirvDecorationDescriptorSet:
+				sets[args[0]] = args[2]
+			}
+		case spirvOpMemberDecorate:
+			switch args[2] {
+			case spirvDecorationOffset, spirvDecorationMatrixStride, spirvDecorationRowMajor:
+				m, err := member(getStruct(args[0]), args[1])
+				if err != nil {
+					return nil, err
+				}
+				switch args[2] {
+				case spirvDecorationOffset:
+					m.Offset = args[3]
+				case spirvDecorationMatrixStride:
+					m.MatrixStride = args[3]
+				case spirvDecorationRowMajor:
+					m.RowMajor = true
+				}
+			}
+		}
+		i += count
+	}
+
+	// member types are resolved once per type id
+
+	resolved := make(map[uint32]*shaderType)
+	var resolve func(id uint32, depth int) (*shaderType, error)
+	resolve = func(id uint32, depth int) (*shaderType, error) {
+		if t := resolved[id]; t != nil {
+			return t, nil
+		}
+		if depth > spirvMaxTypeDepth {
+			return nil, fmt.Errorf("SPIR-V type %d is nested too deeply", id)
+		}
+		t := &shaderType{}
+		if s := structs[id]; s != nil && s.declared {
+			t.Members = slices.Clone(s.members)
+			for j, memberType := range s.memberTypes {
+				var err error
+				if t.Members[j].Type, err = resolve(memberType, depth+1); err != nil {
+					return nil, err
+				}
+			}
+		} else if c, ok := composites[id]; ok {
+			var err error
+			if t.Elem, err = resolve(c.elem, depth+1); err != nil {
+				return nil, err
+			}
+			switch c.opcode {
+			case spirvOpTypeMatrix:
+				t.Matrix, t.Length = true, c.length
+			case spirvOpTypeArray:
+				t.Array, t.Length = true, constants[c.length]
+			default:
+				t.Array = true
+			}
+			t.ArrayStride = arrayStrides[id]
+		}
+		resolved[id] = t
+		return t, nil
+	}
+
+	var blocks []shaderBlock
+	for _, v := range variables {
+		switch v[2] {
+		case spirvStorageUniform, spirvStorageStorageBuffer, spirvStoragePushConstant:
+		default:
+			continue
+		}
+		typeID := pointers[v[0]]
+		s := structs[typeID]
+		if s == nil || !s.block || !s.declared {
+			continue
+		}
+		t, err := resolve(typeID, 0)
+		if err != nil {
+			return nil, err
+		}
+		storageClass := v[2]
+		if s.bufferBlock {
+			// storage buffers before SPIR-V 1.3
+			storageClass = spirvStorageStorageBuffer
+		}
+		blocks = append(blocks, shaderBlock{
+			Name:         names[typeID],
+			StorageClass: storageClass,
+			Set:          sets[v[1]],
+			Binding:      bindings[v[1]],
+			Members:      t.Members,
+		})
+	}
+	return blocks, nil
+}
+
+func spirvString(words []uint32) string {
+	b := make([]byte, 0, 4*len(words))
+	for _, w := range words {
+		b = binary.LittleEndian.AppendUint32(b, w)
+	}
+	s, _, _ := strings.Cut(string(b), "\x00")
+	return s
+}
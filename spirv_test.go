@@ -0,0 +1,148 @@
+package asch
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/xlab/linmath"
+)
+
+// spirvModule assembles instructions of an opcode followed by its operands.
+func spirvModule(instructions ...[]uint32) []byte {
+	words := []uint32{spirvMagic, 0x10000, 0, 32, 0}
+	for _, inst := range instructions {
+		words = append(words, uint32(len(inst))<<16|inst[0])
+		words = append(words, inst[1:]...)
+	}
+	code := make([]byte, 0, 4*len(words))
+	for _, w := range words {
+		code = binary.LittleEndian.AppendUint32(code, w)
+	}
+	return code
+}
+
+// spirvName returns OpName of id.
+func spirvName(id uint32, name string) []uint32 {
+	b := append([]byte(name), make([]byte, 4-len(name)%4)...)
+	inst := []uint32{spirvOpName, id}
+	for i := 0; i < len(b); i += 4 {
+		inst = append(inst, binary.LittleEndian.Uint32(b[i:]))
+	}
+	return inst
+}
+
+// spirvBlockModule declares the uniform block
+//
+//	layout(set = 0, binding = 1) uniform Block {
+//		mat4 M;
+//		struct { float A; vec4 B; } In;
+//		float Arr[5];
+//	};
+//
+// with the given inner member offset, array stride and matrix stride.
+func spirvBlockModule(innerOffset, arrayStride, matrixStride uint32) []byte {
+	const (
+		opTypeInt    = 21
+		opTypeFloat  = 22
+		opTypeVector = 23
+	)
+	return spirvModule(
+		spirvName(8, "Block"),
+		[]uint32{spirvOpDecorate, 8, spirvDecorationBlock},
+		[]uint32{spirvOpDecorate, 10, spirvDecorationDescriptorSet, 0},
+		[]uint32{spirvOpDecorate, 10, spirvDecorationBinding, 1},
+		[]uint32{spirvOpDecorate, 6, spirvDecorationArrayStride, arrayStride},
+		[]uint32{spirvOpMemberDecorate, 7, 0, spirvDecorationOffset, 0},
+		[]uint32{spirvOpMemberDecorate, 7, 1, spirvDecorationOffset, innerOffset},
+		[]uint32{spirvOpMemberDecorate, 8, 0, spirvDecorationOffset, 0},
+		[]uint32{spirvOpMemberDecorate, 8, 0, spirvDecorationMatrixStride, matrixStride},
+		[]uint32{spirvOpMemberDecorate, 8, 1, spirvDecorationOffset, 64},
+		[]uint32{spirvOpMemberDecorate, 8, 2, spirvDecorationOffset, 96},
+		[]uint32{opTypeFloat, 1, 32},
+		[]uint32{opTypeVector, 2, 1, 4},
+		[]uint32{spirvOpTypeMatrix, 3, 2, 4},
+		[]uint32{opTypeInt, 4, 32, 0},
+		[]uint32{spirvOpConstant, 4, 5, 5},
+		[]uint32{spirvOpTypeArray, 6, 1, 5},
+		[]uint32{spirvOpTypeStruct, 7, 1, 2},
+		[]uint32{spirvOpTypeStruct, 8, 3, 7, 6},
+		[]uint32{spirvOpTypePointer, 9, spirvStorageUniform, 8},
+		[]uint32{spirvOpVariable, 9, 10, spirvStorageUniform},
+	)
+}
+
+type spirvInner struct {
+	A float32
+	B linmath.Vec4
+}
+
+type spirvBlock struct {
+	M   linmath.Mat4x4
+	In  spirvInner
+	Arr [5]float32
+}
+
+func TestCheckUniformBlock(t *testing.T) {
+	tests := []struct {
+		name         string
+		innerOffset  uint32
+		arrayStride  uint32
+		matrixStride uint32
+		ok           bool
+	}{
+		{"match", 16, 16, 16, true},
+		{"nested offset", 4, 16, 16, false},
+		{"array stride", 16, 4, 16, false},
+		{"matrix stride", 16, 16, 32, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := spirvBlockModule(tt.innerOffset, tt.arrayStride, tt.matrixStride)
+			err := CheckUniformBlock(code, 0, 1, &spirvBlock{})
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("CheckUniformBlock accepted the mismatch")
+			}
+		})
+	}
+	if err := CheckUniformBlock(spirvBlockModule(16, 16, 16), 0, 1, struct {
+		M   linmath.Mat4x4
+		In  [2]linmath.Vec4
+		Arr [5]float32
+	}{}); err == nil {
+		t.Errorf("CheckUniformBlock accepted an array in place of a struct")
+	}
+	if err := CheckUniformBlock(spirvBlockModule(16, 16, 16), 0, 2, spirvBlock{}); err == nil {
+		t.Errorf("CheckUniformBlock found a block at a missing binding")
+	}
+}
+
+func TestReflectBlocksMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"decorate without operands", spirvModule([]uint32{spirvOpDecorate})},
+		{"decorate without target", spirvModule([]uint32{spirvOpDecorate, 8})},
+		{"binding without value", spirvModule([]uint32{spirvOpDecorate, 10, spirvDecorationBinding})},
+		{"offset without value", spirvModule([]uint32{spirvOpMemberDecorate, 8, 0, spirvDecorationOffset})},
+		{"member index", spirvModule([]uint32{spirvOpMemberDecorate, 8, 0xFFFFFFFF, spirvDecorationOffset, 0})},
+		{"name without string", spirvModule([]uint32{spirvOpName, 8})},
+		{"pointer", spirvModule([]uint32{spirvOpTypePointer, 9, spirvStorageUniform})},
+		{"variable", spirvModule([]uint32{spirvOpVariable, 9, 10})},
+		{"array", spirvModule([]uint32{spirvOpTypeArray, 6, 1})},
+		{"struct", spirvModule([]uint32{spirvOpTypeStruct})},
+		{"truncated", spirvBlockModule(16, 16, 16)[:len(spirvBlockModule(16, 16, 16))-4]},
+		{"zero word count", append(spirvModule(), 0, 0, 0, 0)},
+		{"short header", make([]byte, 16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := reflectBlocks(tt.code); err == nil {
+				t.Errorf("reflectBlocks accepted a malformed module")
+			}
+		})
+	}
+}
@@ -20,7 +20,18 @@ type VulkanSwapchainInfo struct {
 	DisplayViews []vk.ImageView
 }
 
-func NewSwapchain(device vk.Device, gpu vk.PhysicalDevice, surface vk.Surface, windowSize vk.Extent2D) (VulkanSwapchainInfo, error) {
+// swapchainFormats are the surface formats NewSwapchain accepts, in order of preference.
+var swapchainFormats = []vk.Format{
+	vk.FormatB8g8r8a8Unorm,
+	vk.FormatR8g8b8a8Unorm,
+	vk.FormatA8b8g8r8UnormPack32,
+	vk.FormatA2b10g10r10UnormPack32,
+}
+
+// NewSwapchain creates the swapchain of the surface. queueFamilies are the families using
+// its images, e.g. the graphics and the present family; images are shared between them
+// when they differ.
+func NewSwapchain(device vk.Device, gpu vk.PhysicalDevice, surface vk.Surface, windowSize vk.Extent2D, queueFamilies ...uint32) (VulkanSwapchainInfo, error) {
 	//gpu := v.gpuDevices[0]
 
 	// Phase 1: vk.GetPhysicalDeviceSurfaceCapabilities
@@ -40,11 +51,22 @@ func NewSwapchain(device vk.Device, gpu vk.PhysicalDevice, surface vk.Surface, w
 
 	slog.Debug(fmt.Sprintf("got %d physical device surface formats", formatCount))
 
-	chosenFormat := -1
-	for i := 0; i < int(formatCount); i++ {
+	for i := range formats {
 		formats[i].Deref()
-		if formats[i].Format == vk.FormatB8g8r8a8Unorm || formats[i].Format == vk.FormatR8g8b8a8Unorm {
-			chosenFormat = i
+	}
+	if len(formats) == 1 && formats[0].Format == vk.FormatUndefined {
+		// the surface has no preferred format
+		formats[0].Format = swapchainFormats[0]
+	}
+	chosenFormat := -1
+	for _, format := range swapchainFormats {
+		for i := range formats {
+			if formats[i].Format == format {
+				chosenFormat = i
+				break
+			}
+		}
+		if chosenFormat >= 0 {
 			break
 		}
 	}
@@ -90,6 +112,12 @@ func NewSwapchain(device vk.Device, gpu vk.PhysicalDevice, surface vk.Surface, w
 		OldSwapchain:     vk.NullSwapchain,
 		Clipped:          vk.False,
 	}
+	families := uniqueFamilies(queueFamilies)
+	if len(families) > 1 {
+		swapchainCreateInfo.ImageSharingMode = vk.SharingModeConcurrent
+		swapchainCreateInfo.QueueFamilyIndexCount = uint32(len(families))
+		swapchainCreateInfo.PQueueFamilyIndices = families
+	}
 	var swapchain vk.Swapchain
 	err = vk.Error(vk.CreateSwapchain(device, &swapchainCreateInfo, nil, &swapchain))
 	if err != nil {
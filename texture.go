@@ -0,0 +1,194 @@
+package asch
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// TextureOptions tells CreateTexture how the pixels are meant to be sampled.
+type TextureOptions struct {
+	// SRGB marks color data encoded with the sRGB curve, which is what Go images
+	// decoded from PNG or JPEG hold. Leave it false for normal maps, masks and other
+	// linear data. The format decodes sRGB on sampling where one exists, otherwise
+	// the pixels are converted to linear values on upload. Linear values lose precision
+	// in the dark tones with 8 bit UNORM formats, prefer their sRGB variants.
+	SRGB bool
+	// Format overrides the format picked from the image type.
+	Format vk.Format
+	// Usage is added to vk.ImageUsageSampledBit and vk.ImageUsageTransferDstBit.
+	Usage vk.ImageUsageFlags
+	// Mipmaps generates a full mip chain, see Uploader.GenerateMipmaps.
+	Mipmaps bool
+}
+
+// CreateTexture creates a sampled 2D image holding src. The image is ready for shaders
+// once Uploader.Flush returns.
+func (u *Uploader) CreateTexture(ctx context.Context, src image.Image, opts TextureOptions) (*Image, error) {
+	format := opts.Format
+	if format == vk.FormatUndefined {
+		var err error
+		if format, err = u.sampledTextureFormat(src, opts.SRGB); err != nil {
+			return nil, fmt.Errorf("CreateTexture: %w", err)
+		}
+	}
+	data, err := encodePixels(src, format, opts.SRGB)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	info := ImageCreateInfo{
+		Format: format,
+		Width:  uint32(bounds.Dx()),
+		Height: uint32(bounds.Dy()),
+		Usage:  opts.Usage | vk.ImageUsageFlags(vk.ImageUsageSampledBit|vk.ImageUsageTransferDstBit),
+	}
+	if opts.Mipmaps {
+		info.MipLevels = MipLevelsAuto
+		info.Usage |= vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit)
+	}
+	img, err := u.allocator.CreateImage(info)
+	if err != nil {
+		return nil, err
+	}
+	if err = u.UploadImageData(ctx, img, 0, 0, data); err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	if err = u.GenerateMipmaps(ctx, img, data); err != nil {
+		img.Destroy()
+		return nil, err
+	}
+	return img, nil
+}
+
+// sampledTextureFormat is textureFormat when the device samples it, otherwise four
+// channels of the same or 8 bit precision.
+func (u *Uploader) sampledTextureFormat(src image.Image, srgb bool) (vk.Format, error) {
+	format := textureFormat(src, srgb)
+	rgba := vk.FormatR8g8b8a8Unorm
+	if srgb {
+		rgba = vk.FormatR8g8b8a8Srgb
+	}
+	candidates := []vk.Format{format}
+	if info := formatTable[format]; info.Bits[0] == 16 {
+		candidates = append(candidates, vk.FormatR16g16b16a16Unorm)
+	}
+	candidates = append(candidates, rgba)
+	return u.allocator.FindSupportedFormat(vk.ImageTilingOptimal, vk.FormatFeatureFlags(vk.FormatFeatureSampledImageBit), candidates...)
+}
+
+// textureFormat keeps the channels and the precision of src.
+func textureFormat(src image.Image, srgb bool) vk.Format {
+	switch src.(type) {
+	case *image.Gray:
+		if srgb {
+			return vk.FormatR8Srgb
+		}
+		return vk.FormatR8Unorm
+	case *image.Gray16:
+		return vk.FormatR16Unorm
+	case *image.RGBA64, *image.NRGBA64:
+		return vk.FormatR16g16b16a16Unorm
+	default:
+		if srgb {
+			return vk.FormatR8g8b8a8Srgb
+		}
+		return vk.FormatR8g8b8a8Unorm
+	}
+}
+
+// encodePixels converts src into tightly packed texels of format with straight alpha.
+// srgb tells src holds sRGB encoded color, which is linearized for UNORM formats.
+func encodePixels(src image.Image, format vk.Format, srgb bool) ([]byte, error) {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// 8 bit UNORM formats of sRGB encoded color hold linear values, the sRGB formats
+	// the encoded ones
+	linear8 := srgb && formatTable[format].Numeric == NumericUnorm
+	to8 := func(v uint16) uint8 {
+		if linear8 {
+			return srgbToLinear8[v>>8]
+		}
+		return uint8(v >> 8)
+	}
+
+	var texelSize int
+	var put func(dst []byte, c color.NRGBA64)
+	switch format {
+	case vk.FormatR8g8b8a8Unorm, vk.FormatR8g8b8a8Srgb:
+		texelSize = 4
+		put = func(dst []byte, c color.NRGBA64) {
+			dst[0], dst[1], dst[2], dst[3] = to8(c.R), to8(c.G), to8(c.B), uint8(c.A>>8)
+		}
+	case vk.FormatB8g8r8a8Unorm, vk.FormatB8g8r8a8Srgb:
+		texelSize = 4
+		put = func(dst []byte, c color.NRGBA64) {
+			dst[0], dst[1], dst[2], dst[3] = to8(c.B), to8(c.G), to8(c.R), uint8(c.A>>8)
+		}
+	case vk.FormatR8Unorm, vk.FormatR8Srgb:
+		texelSize = 1
+		put = func(dst []byte, c color.NRGBA64) {
+			dst[0] = to8(luma16(c))
+		}
+	case vk.FormatR16Unorm:
+		texelSize = 2
+		put = func(dst []byte, c color.NRGBA64) {
+			binary.LittleEndian.PutUint16(dst, linearize16(luma16(c), srgb))
+		}
+	case vk.FormatR16g16b16a16Unorm:
+		texelSize = 8
+		put = func(dst []byte, c color.NRGBA64) {
+			binary.LittleEndian.PutUint16(dst[0:], linearize16(c.R, srgb))
+			binary.LittleEndian.PutUint16(dst[2:], linearize16(c.G, srgb))
+			binary.LittleEndian.PutUint16(dst[4:], linearize16(c.B, srgb))
+			binary.LittleEndian.PutUint16(dst[6:], c.A)
+		}
+	default:
+		return nil, fmt.Errorf("encodePixels: cannot convert images to format %d", format)
+	}
+
+	data := make([]byte, w*h*texelSize)
+	if nrgba, ok := src.(*image.NRGBA); ok && !linear8 && (format == vk.FormatR8g8b8a8Unorm || format == vk.FormatR8g8b8a8Srgb) {
+		// the common case, rows are copied as they are
+		for y := 0; y < h; y++ {
+			start := nrgba.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			copy(data[y*w*4:(y+1)*w*4], nrgba.Pix[start:start+w*4])
+		}
+		return data, nil
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA64Model.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+			put(data[(y*w+x)*texelSize:], c)
+		}
+	}
+	return data, nil
+}
+
+// luma16 follows color.Gray16Model.
+func luma16(c color.NRGBA64) uint16 {
+	return uint16((19595*uint32(c.R) + 38470*uint32(c.G) + 7471*uint32(c.B) + 1<<15) >> 16)
+}
+
+// srgbToLinear8 decodes sRGB encoded bytes into linear ones.
+var srgbToLinear8 = func() (table [256]uint8) {
+	for i := range table {
+		table[i] = uint8(math.Round(srgbToLinear(float64(i)/0xFF) * 0xFF))
+	}
+	return table
+}()
+
+// linearize16 decodes an sRGB encoded value when srgb is set.
+func linearize16(v uint16, srgb bool) uint16 {
+	if !srgb {
+		return v
+	}
+	return uint16(math.Round(srgbToLinear(float64(v)/0xFFFF) * 0xFFFF))
+}
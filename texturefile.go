@@ -0,0 +1,148 @@
+package asch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// TextureData is a texture decoded from a KTX2 or DDS file, every image tightly packed.
+type TextureData struct {
+	Format vk.Format
+	Width  uint32
+	Height uint32
+	Depth  uint32
+	// Layers counts array layers, Faces is 6 for cube maps and 1 otherwise.
+	Layers uint32
+	Faces  uint32
+	// Levels holds for every mip level the image of each layer and face at layer*Faces+face,
+	// with all the depth slices of 3D textures.
+	Levels [][][]byte
+	// GenerateMipmaps is set by files asking for their mips to be generated at load time.
+	GenerateMipmaps bool
+}
+
+// DecodeTexture decodes a KTX2 or DDS file, told apart by their magic.
+func DecodeTexture(data []byte) (*TextureData, error) {
+	switch {
+	case bytes.HasPrefix(data, ktx2Identifier):
+		return DecodeKTX2(data)
+	case bytes.HasPrefix(data, []byte(ddsMagic)):
+		return DecodeDDS(data)
+	}
+	return nil, fmt.Errorf("DecodeTexture: neither a KTX2 nor a DDS file")
+}
+
+// decompress decodes block compressed levels into plain texels on the CPU.
+func (td *TextureData) decompress() (*TextureData, error) {
+	format, ok := decompressFormat(td.Format)
+	if !ok {
+		return nil, fmt.Errorf("format %d is not supported by the device and cannot be transcoded", td.Format)
+	}
+	out := *td
+	out.Format = format
+	out.Levels = make([][][]byte, len(td.Levels))
+	for level, images := range td.Levels {
+		w, h, d := max(td.Width>>level, 1), max(td.Height>>level, 1), max(td.Depth>>level, 1)
+		out.Levels[level] = make([][]byte, len(images))
+		for i, image := range images {
+			var err error
+			if out.Levels[level][i], err = decompressBlocks(td.Format, image, w, h, d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &out, nil
+}
+
+// LoadTexture reads a KTX2 or DDS file and creates a sampled image from it,
+// see CreateTextureFromData.
+func (u *Uploader) LoadTexture(ctx context.Context, r io.Reader, opts TextureOptions) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	td, err := DecodeTexture(data)
+	if err != nil {
+		return nil, err
+	}
+	return u.CreateTextureFromData(ctx, td, opts)
+}
+
+// CreateTextureFromData creates a sampled image holding every mip, layer and face of td.
+// BC1 to BC5 textures the device cannot sample are decompressed on the CPU, other
+// unsupported formats fail. opts.SRGB selects the sRGB variant of a UNORM format,
+// opts.Format is ignored. The image is ready for shaders once Uploader.Flush returns.
+func (u *Uploader) CreateTextureFromData(ctx context.Context, td *TextureData, opts TextureOptions) (*Image, error) {
+	if len(td.Levels) == 0 {
+		return nil, fmt.Errorf("CreateTextureFromData: texture has no levels")
+	}
+
+	// Phase 1: format supported by the device, or transcoded
+
+	if opts.SRGB {
+		srgb := *td
+		srgb.Format, _ = SRGBFormat(td.Format)
+		td = &srgb
+	}
+	sampled := vk.FormatFeatureFlags(vk.FormatFeatureSampledImageBit)
+	if !u.allocator.FormatSupported(td.Format, sampled) {
+		transcoded, err := td.decompress()
+		if err != nil {
+			return nil, fmt.Errorf("CreateTextureFromData: %w", err)
+		}
+		if !u.allocator.FormatSupported(transcoded.Format, sampled) {
+			return nil, fmt.Errorf("CreateTextureFromData: neither format %d nor %d are supported by the device", td.Format, transcoded.Format)
+		}
+		slog.Info("Texture format not supported by the device, decompressed on the CPU", "format", td.Format, "to", transcoded.Format)
+		td = transcoded
+	}
+
+	// Phase 2: Allocator.CreateImage
+
+	info := ImageCreateInfo{
+		Format:    td.Format,
+		Width:     td.Width,
+		Height:    td.Height,
+		Depth:     td.Depth,
+		Layers:    td.Layers * td.Faces,
+		Cube:      td.Faces == 6,
+		MipLevels: uint32(len(td.Levels)),
+		Usage:     opts.Usage | vk.ImageUsageFlags(vk.ImageUsageSampledBit|vk.ImageUsageTransferDstBit),
+	}
+	generate := len(td.Levels) == 1 && (td.GenerateMipmaps || opts.Mipmaps)
+	if generate {
+		info.MipLevels = MipLevelsAuto
+		info.Usage |= vk.ImageUsageFlags(vk.ImageUsageTransferSrcBit)
+	}
+	img, err := u.allocator.CreateImage(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// Phase 3: Uploader.UploadImageData of every level, layer and face
+
+	for level, images := range td.Levels {
+		if len(images) != int(img.Layers) {
+			img.Destroy()
+			return nil, fmt.Errorf("CreateTextureFromData: level %d has %d images, expected %d", level, len(images), img.Layers)
+		}
+		for layer, data := range images {
+			if err = u.UploadImageData(ctx, img, uint32(level), uint32(layer), data); err != nil {
+				img.Destroy()
+				return nil, err
+			}
+		}
+	}
+	if generate {
+		if err = u.generateMipmaps(ctx, img, td.Levels[0]); err != nil {
+			img.Destroy()
+			return nil, err
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,278 @@
+package asch
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// ktx2Level is one level of a test KTX2 file, raw as stored and its uncompressed length.
+type ktx2Level struct {
+	raw          []byte
+	uncompressed uint64
+}
+
+func makeKTX2(format vk.Format, width, height, layers, faces, scheme uint32, levels ...ktx2Level) []byte {
+	le := binary.LittleEndian
+	header := make([]byte, ktx2HeaderSize+24*len(levels))
+	copy(header, ktx2Identifier)
+	le.PutUint32(header[12:], uint32(format))
+	le.PutUint32(header[20:], width)
+	le.PutUint32(header[24:], height)
+	le.PutUint32(header[32:], layers)
+	le.PutUint32(header[36:], faces)
+	le.PutUint32(header[40:], uint32(len(levels)))
+	le.PutUint32(header[44:], scheme)
+	offset := len(header)
+	for i, level := range levels {
+		entry := header[ktx2HeaderSize+24*i:]
+		le.PutUint64(entry, uint64(offset))
+		le.PutUint64(entry[8:], uint64(len(level.raw)))
+		le.PutUint64(entry[16:], level.uncompressed)
+		offset += len(level.raw)
+	}
+	for _, level := range levels {
+		header = append(header, level.raw...)
+	}
+	return header
+}
+
+// pattern returns size bytes counting up.
+func pattern(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func rawLevel(size int) ktx2Level {
+	return ktx2Level{pattern(size), uint64(size)}
+}
+
+func TestDecodeKTX2(t *testing.T) {
+	data := makeKTX2(vk.FormatR8g8b8a8Unorm, 2, 2, 0, 1, ktx2SupercompressionNone, rawLevel(16), rawLevel(4))
+	td, err := DecodeKTX2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.Format != vk.FormatR8g8b8a8Unorm || td.Width != 2 || td.Height != 2 || td.Depth != 1 || td.Layers != 1 || td.Faces != 1 {
+		t.Errorf("DecodeKTX2 = %+v", td)
+	}
+	if len(td.Levels) != 2 || len(td.Levels[0]) != 1 || len(td.Levels[0][0]) != 16 || len(td.Levels[1][0]) != 4 {
+		t.Fatalf("DecodeKTX2 levels = %v", td.Levels)
+	}
+	if !bytes.Equal(td.Levels[1][0], rawLevel(4).raw) {
+		t.Errorf("level 1 = %v", td.Levels[1][0])
+	}
+}
+
+func TestDecodeKTX2Cube(t *testing.T) {
+	level := rawLevel(6 * 4 * 4)
+	td, err := DecodeKTX2(makeKTX2(vk.FormatR32Sfloat, 2, 2, 0, 6, ktx2SupercompressionNone, level))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(td.Levels[0]) != 6 {
+		t.Fatalf("DecodeKTX2 has %d faces, want 6", len(td.Levels[0]))
+	}
+	if !bytes.Equal(td.Levels[0][5], level.raw[80:]) {
+		t.Errorf("face 5 = %v", td.Levels[0][5])
+	}
+}
+
+func TestDecodeKTX2Zlib(t *testing.T) {
+	level := rawLevel(8 * 8)
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(level.raw)
+	w.Close()
+	data := makeKTX2(vk.FormatBc1RgbaUnormBlock, 8, 8, 0, 1, ktx2SupercompressionZlib,
+		ktx2Level{compressed.Bytes(), 4 * 8})
+	if _, err := DecodeKTX2(data); err == nil {
+		t.Errorf("DecodeKTX2 accepted a level of the wrong size")
+	}
+	data = makeKTX2(vk.FormatR8Unorm, 8, 8, 0, 1, ktx2SupercompressionZlib,
+		ktx2Level{compressed.Bytes(), 64})
+	td, err := DecodeKTX2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(td.Levels[0][0], level.raw) {
+		t.Errorf("level 0 = %v", td.Levels[0][0])
+	}
+}
+
+func TestDecodeKTX2Zstd(t *testing.T) {
+	level0, level1 := rawLevel(4*4*4), rawLevel(2*2*4)
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compress := func(level ktx2Level) ktx2Level {
+		return ktx2Level{encoder.EncodeAll(level.raw, nil), level.uncompressed}
+	}
+	data := makeKTX2(vk.FormatR8g8b8a8Unorm, 4, 4, 0, 1, ktx2SupercompressionZstd, compress(level0), compress(level1))
+	encoder.Close()
+	td, err := DecodeKTX2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(td.Levels) != 2 || !bytes.Equal(td.Levels[0][0], level0.raw) || !bytes.Equal(td.Levels[1][0], level1.raw) {
+		t.Errorf("DecodeKTX2 levels = %v", td.Levels)
+	}
+
+	data = makeKTX2(vk.FormatR8g8b8a8Unorm, 4, 4, 0, 1, ktx2SupercompressionZstd, ktx2Level{level0.raw, level0.uncompressed})
+	if _, err = DecodeKTX2(data); err == nil {
+		t.Errorf("DecodeKTX2 accepted a level which is not zstd compressed")
+	}
+}
+
+func TestDecodeKTX2Errors(t *testing.T) {
+	truncated := makeKTX2(vk.FormatR8g8b8a8Unorm, 2, 2, 0, 1, ktx2SupercompressionNone, rawLevel(16))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not KTX2", make([]byte, 100)},
+		{"basis", makeKTX2(vk.FormatUndefined, 2, 2, 0, 1, ktx2SupercompressionBasisLZ, rawLevel(16))},
+		{"unknown format", makeKTX2(vk.Format(0x7FFFFFFF), 2, 2, 0, 1, ktx2SupercompressionNone, rawLevel(16))},
+		{"empty", makeKTX2(vk.FormatR8Unorm, 0, 2, 0, 1, ktx2SupercompressionNone, rawLevel(16))},
+		{"faces", makeKTX2(vk.FormatR8Unorm, 2, 2, 0, 3, ktx2SupercompressionNone, rawLevel(12))},
+		{"level size", makeKTX2(vk.FormatR8g8b8a8Unorm, 2, 2, 0, 1, ktx2SupercompressionNone, rawLevel(15))},
+		{"truncated", truncated[:len(truncated)-1]},
+		{"too large", makeKTX2(vk.FormatR32g32b32a32Sfloat, 1<<20, 1<<20, 0, 1, ktx2SupercompressionNone,
+			ktx2Level{nil, 1 << 44})},
+		{"scheme", makeKTX2(vk.FormatR8Unorm, 2, 2, 0, 1, 9, rawLevel(4))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeKTX2(tt.data); err == nil {
+				t.Errorf("DecodeKTX2 succeeded")
+			}
+		})
+	}
+}
+
+// ddsHeader returns a DDS header of a width x height texture with levels mips.
+func ddsHeader(width, height, levels uint32) []byte {
+	le := binary.LittleEndian
+	data := make([]byte, ddsHeaderSize)
+	copy(data, ddsMagic)
+	header := data[4:]
+	le.PutUint32(header, 124)
+	le.PutUint32(header[4:], ddsFlagMipMapCount)
+	le.PutUint32(header[8:], height)
+	le.PutUint32(header[12:], width)
+	le.PutUint32(header[24:], levels)
+	le.PutUint32(header[72:], 32)
+	return data
+}
+
+func ddsFourCC(width, height, levels uint32, fourCC string) []byte {
+	data := ddsHeader(width, height, levels)
+	binary.LittleEndian.PutUint32(data[4+76:], ddsPixelFourCC)
+	copy(data[4+80:], fourCC)
+	return data
+}
+
+func TestDecodeDDS(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format vk.Format
+		layers uint32
+		faces  uint32
+		sizes  []int
+	}{
+		{"DXT1", append(ddsFourCC(8, 8, 2, "DXT1"), pattern(32+8)...), vk.FormatBc1RgbaUnormBlock, 1, 1, []int{32, 8}},
+		{"DXT5", append(ddsFourCC(4, 4, 1, "DXT5"), pattern(16)...), vk.FormatBc3UnormBlock, 1, 1, []int{16}},
+		{"RGBA", func() []byte {
+			data := ddsHeader(2, 1, 1)
+			le := binary.LittleEndian
+			le.PutUint32(data[4+76:], ddsPixelRGB|ddsPixelAlphaPixels)
+			le.PutUint32(data[4+84:], 32)
+			le.PutUint32(data[4+88:], 0xFF)
+			le.PutUint32(data[4+92:], 0xFF00)
+			le.PutUint32(data[4+96:], 0xFF0000)
+			le.PutUint32(data[4+100:], 0xFF000000)
+			return append(data, pattern(8)...)
+		}(), vk.FormatR8g8b8a8Unorm, 1, 1, []int{8}},
+		{"DX10 array", func() []byte {
+			data := ddsFourCC(2, 2, 1, "DX10")
+			dx10 := make([]byte, ddsDX10Size)
+			binary.LittleEndian.PutUint32(dx10, 29)
+			binary.LittleEndian.PutUint32(dx10[12:], 3)
+			return append(append(data, dx10...), pattern(3*16)...)
+		}(), vk.FormatR8g8b8a8Srgb, 3, 1, []int{16}},
+		{"DX10 cube", func() []byte {
+			data := ddsFourCC(1, 1, 1, "DX10")
+			dx10 := make([]byte, ddsDX10Size)
+			binary.LittleEndian.PutUint32(dx10, 61)
+			binary.LittleEndian.PutUint32(dx10[8:], ddsDX10MiscCube)
+			return append(append(data, dx10...), pattern(6)...)
+		}(), vk.FormatR8Unorm, 1, 6, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td, err := DecodeDDS(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if td.Format != tt.format || td.Layers != tt.layers || td.Faces != tt.faces {
+				t.Errorf("DecodeDDS = format %d, %d layers, %d faces", td.Format, td.Layers, td.Faces)
+			}
+			if len(td.Levels) != len(tt.sizes) {
+				t.Fatalf("DecodeDDS has %d levels, want %d", len(td.Levels), len(tt.sizes))
+			}
+			for level, size := range tt.sizes {
+				if len(td.Levels[level]) != int(tt.layers*tt.faces) {
+					t.Fatalf("level %d has %d images", level, len(td.Levels[level]))
+				}
+				for image, data := range td.Levels[level] {
+					if len(data) != size {
+						t.Errorf("level %d image %d has %d bytes, want %d", level, image, len(data), size)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDDSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not DDS", make([]byte, 200)},
+		{"empty", ddsFourCC(0, 4, 1, "DXT1")},
+		{"FourCC", append(ddsFourCC(4, 4, 1, "ETC1"), pattern(8)...)},
+		{"levels", append(ddsFourCC(4, 4, 4, "DXT1"), pattern(32)...)},
+		{"truncated", append(ddsFourCC(8, 8, 1, "DXT1"), pattern(31)...)},
+		{"DX10 truncated", ddsFourCC(4, 4, 1, "DX10")},
+		{"pixel format", append(ddsHeader(4, 4, 1), pattern(64)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeDDS(tt.data); err == nil {
+				t.Errorf("DecodeDDS succeeded")
+			}
+		})
+	}
+}
+
+func TestDecodeTexture(t *testing.T) {
+	if _, err := DecodeTexture(append(ddsFourCC(4, 4, 1, "DXT1"), pattern(8)...)); err != nil {
+		t.Errorf("DecodeTexture of DDS: %v", err)
+	}
+	if _, err := DecodeTexture(makeKTX2(vk.FormatR8Unorm, 2, 2, 0, 1, ktx2SupercompressionNone, rawLevel(4))); err != nil {
+		t.Errorf("DecodeTexture of KTX2: %v", err)
+	}
+	if _, err := DecodeTexture([]byte("\x89PNG\r\n\x1a\n")); err == nil {
+		t.Errorf("DecodeTexture of PNG succeeded")
+	}
+}
@@ -0,0 +1,376 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// Timeline is a monotonically increasing GPU counter. Submissions signal increasing
+// values and both the GPU (other submissions) and the host can wait for them.
+//
+// On Vulkan 1.2 devices with the timelineSemaphore feature the counter is a timeline
+// semaphore, so GPU waits happen on the device. Otherwise waits on the timeline are
+// resolved on the host before the waiting batch is submitted. In both cases every
+// signal is paired with a fence, because the bindings expose neither
+// vkWaitSemaphores nor vkGetSemaphoreCounterValue for host waits.
+type Timeline struct {
+	device    vk.Device
+	native    bool
+	semaphore vk.Semaphore
+
+	mu        sync.Mutex
+	submitted uint64 // highest value submitted for signalling
+	completed uint64 // highest value known to be reached
+	err       error  // set when a fence wait failed, e.g. on device loss
+	pending   []pendingSignal
+	waiters   map[uint64]chan struct{}
+	fences    []vk.Fence // reset fences ready for reuse
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+type pendingSignal struct {
+	value uint64
+	fence vk.Fence
+}
+
+// TimelineWait makes a submission wait until the timeline reaches Value.
+type TimelineWait struct {
+	Timeline *Timeline
+	Value    uint64
+	Stage    vk.PipelineStageFlags
+}
+
+// TimelineSubmit is a batch which signals the timeline once it completes.
+// Binary semaphores (e.g. from vk.AcquireNextImage) can be mixed in.
+type TimelineSubmit struct {
+	CommandBuffers []vk.CommandBuffer
+	Waits          []TimelineWait
+
+	WaitSemaphores   []vk.Semaphore
+	WaitStages       []vk.PipelineStageFlags
+	SignalSemaphores []vk.Semaphore
+
+	// Signal is the value reached when the batch completes, zero means
+	// the next value after the last submitted one.
+	Signal uint64
+}
+
+// Future is a timeline value which Go code can wait on or select over.
+type Future struct {
+	timeline *Timeline
+	value    uint64
+}
+
+func NewTimeline(device vk.Device, features DeviceFeatures) (*Timeline, error) {
+	t := &Timeline{
+		device:  device,
+		native:  features.TimelineSemaphore,
+		waiters: make(map[uint64]chan struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if t.native {
+		typeCreateInfo := vk.SemaphoreTypeCreateInfo{
+			SType:         vk.StructureTypeSemaphoreTypeCreateInfo,
+			SemaphoreType: vk.SemaphoreTypeTimeline,
+		}
+		ref, _ := typeCreateInfo.PassRef()
+		defer typeCreateInfo.Free()
+		semaphoreCreateInfo := vk.SemaphoreCreateInfo{
+			SType: vk.StructureTypeSemaphoreCreateInfo,
+			PNext: unsafe.Pointer(ref),
+		}
+		err := vk.Error(vk.CreateSemaphore(device, &semaphoreCreateInfo, nil, &t.semaphore))
+		if err != nil {
+			err = fmt.Errorf("vk.CreateSemaphore failed with %s", err)
+			return nil, err
+		}
+	}
+	go t.watch()
+	return t, nil
+}
+
+// Native reports whether the timeline is backed by a timeline semaphore.
+func (t *Timeline) Native() bool {
+	return t.native
+}
+
+// Semaphore returns the timeline semaphore, or vk.NullSemaphore on the fence fallback.
+func (t *Timeline) Semaphore() vk.Semaphore {
+	return t.semaphore
+}
+
+// GetValue returns the highest value the host has seen completed. It is read from the
+// fences paired with the signals, not from the semaphore counter, so it can lag behind
+// the value the GPU has already reached.
+func (t *Timeline) GetValue() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.completed
+}
+
+// LastSubmitted returns the highest value submitted for signalling.
+func (t *Timeline) LastSubmitted() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.submitted
+}
+
+// Future returns a future for an arbitrary value of the timeline.
+func (t *Timeline) Future(value uint64) *Future {
+	return &Future{timeline: t, value: value}
+}
+
+// Wait blocks until the timeline reaches value or the context is done.
+func (t *Timeline) Wait(ctx context.Context, value uint64) error {
+	select {
+	case <-t.reached(value):
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if value > t.completed {
+			return fmt.Errorf("timeline wait for %d: %w", value, t.err)
+		}
+		return nil
+	case <-ctx.Done():
+		return waitError(ctx, fmt.Sprintf("timeline wait for %d", value))
+	}
+}
+
+// Signal submits an empty batch to the queue which sets the timeline to value.
+func (t *Timeline) Signal(ctx context.Context, queue *Queue, value uint64) (*Future, error) {
+	return t.Submit(ctx, queue, TimelineSubmit{Signal: value})
+}
+
+// Submit submits the batch to the queue with the timeline waits and the signal attached.
+func (t *Timeline) Submit(ctx context.Context, queue *Queue, s TimelineSubmit) (*Future, error) {
+	waitSemaphores := append([]vk.Semaphore(nil), s.WaitSemaphores...)
+	waitStages := append([]vk.PipelineStageFlags(nil), s.WaitStages...)
+	waitValues := make([]uint64, len(waitSemaphores)) // ignored for binary semaphores
+	nativeWaits := false
+	for _, w := range s.Waits {
+		if !w.Timeline.native {
+			// no GPU side wait is possible without timeline semaphores
+			if err := w.Timeline.Wait(ctx, w.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		waitSemaphores = append(waitSemaphores, w.Timeline.semaphore)
+		waitStages = append(waitStages, w.Stage)
+		waitValues = append(waitValues, w.Value)
+		nativeWaits = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	value := s.Signal
+	if value == 0 {
+		value = t.submitted + 1
+	}
+	if value <= t.submitted {
+		return nil, fmt.Errorf("timeline signal %d is not above the last submitted value %d", value, t.submitted)
+	}
+	fence, err := t.fence()
+	if err != nil {
+		return nil, err
+	}
+
+	signalSemaphores := append([]vk.Semaphore(nil), s.SignalSemaphores...)
+	submitInfo := vk.SubmitInfo{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: uint32(len(s.CommandBuffers)),
+		PCommandBuffers:    s.CommandBuffers,
+	}
+	if t.native {
+		signalSemaphores = append(signalSemaphores, t.semaphore)
+	}
+	if t.native || nativeWaits {
+		signalValues := make([]uint64, len(signalSemaphores))
+		if t.native {
+			signalValues[len(signalValues)-1] = value
+		}
+		timelineInfo := vk.TimelineSemaphoreSubmitInfo{
+			SType:                     vk.StructureTypeTimelineSemaphoreSubmitInfo,
+			WaitSemaphoreValueCount:   uint32(len(waitValues)),
+			PWaitSemaphoreValues:      waitValues,
+			SignalSemaphoreValueCount: uint32(len(signalValues)),
+			PSignalSemaphoreValues:    signalValues,
+		}
+		ref, _ := timelineInfo.PassRef()
+		defer timelineInfo.Free()
+		submitInfo.PNext = unsafe.Pointer(ref)
+	}
+	submitInfo.WaitSemaphoreCount = uint32(len(waitSemaphores))
+	submitInfo.PWaitSemaphores = waitSemaphores
+	submitInfo.PWaitDstStageMask = waitStages
+	submitInfo.SignalSemaphoreCount = uint32(len(signalSemaphores))
+	submitInfo.PSignalSemaphores = signalSemaphores
+
+	if err = queue.Submit(fence, submitInfo); err != nil {
+		t.fences = append(t.fences, fence)
+		return nil, err
+	}
+	t.submitted = value
+	t.pending = append(t.pending, pendingSignal{value: value, fence: fence})
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return &Future{timeline: t, value: value}, nil
+}
+
+// fence returns an unsignalled fence, t.mu must be held.
+func (t *Timeline) fence() (vk.Fence, error) {
+	if n := len(t.fences); n > 0 {
+		fence := t.fences[n-1]
+		t.fences = t.fences[:n-1]
+		return fence, nil
+	}
+	fenceCreateInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}
+	var fence vk.Fence
+	err := vk.Error(vk.CreateFence(t.device, &fenceCreateInfo, nil, &fence))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateFence failed with %s", err)
+		return vk.NullFence, err
+	}
+	return fence, nil
+}
+
+// reached returns a channel closed once the timeline reaches value.
+func (t *Timeline) reached(value uint64) <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch, ok := t.waiters[value]
+	if !ok {
+		ch = make(chan struct{})
+		if value <= t.completed || t.err != nil {
+			close(ch)
+			return ch
+		}
+		t.waiters[value] = ch
+	}
+	return ch
+}
+
+// watch waits on the signal fences in submission order and wakes up the waiters.
+func (t *Timeline) watch() {
+	defer close(t.done)
+	const pollTimeout = 100 * 1000 * 1000 // 100 ms, so stop is noticed
+	for {
+		t.mu.Lock()
+		var next pendingSignal
+		if len(t.pending) > 0 {
+			next = t.pending[0]
+		}
+		t.mu.Unlock()
+
+		if next.fence == vk.NullFence {
+			select {
+			case <-t.wake:
+				continue
+			case <-t.stop:
+				return
+			}
+		}
+		ret := vk.WaitForFences(t.device, 1, []vk.Fence{next.fence}, vk.True, pollTimeout)
+		if ret == vk.Timeout {
+			select {
+			case <-t.stop:
+				return
+			default:
+				continue
+			}
+		}
+		if err := vk.Error(ret); err != nil {
+			t.fail(fmt.Errorf("vk.WaitForFences failed with %s", err))
+			return
+		}
+		vk.ResetFences(t.device, 1, []vk.Fence{next.fence})
+
+		t.mu.Lock()
+		t.pending = t.pending[1:]
+		t.fences = append(t.fences, next.fence)
+		if next.value > t.completed {
+			t.completed = next.value
+		}
+		for value, ch := range t.waiters {
+			if value <= t.completed {
+				close(ch)
+				delete(t.waiters, value)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// fail releases all waiters with the error, nothing will complete anymore.
+func (t *Timeline) fail(err error) {
+	slog.Error(err.Error())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+	for value, ch := range t.waiters {
+		close(ch)
+		delete(t.waiters, value)
+	}
+}
+
+// Destroy stops the fence watcher and destroys the semaphore and fences.
+// The device must not be using the timeline anymore.
+func (t *Timeline) Destroy() {
+	close(t.stop)
+	<-t.done
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.pending {
+		vk.DestroyFence(t.device, p.fence, nil)
+	}
+	for _, fence := range t.fences {
+		vk.DestroyFence(t.device, fence, nil)
+	}
+	t.pending = nil
+	t.fences = nil
+	if t.semaphore != vk.NullSemaphore {
+		vk.DestroySemaphore(t.device, t.semaphore, nil)
+	}
+}
+
+// Value returns the timeline value the future stands for.
+func (f *Future) Value() uint64 {
+	return f.value
+}
+
+// Done returns a channel which is closed once the value is reached.
+func (f *Future) Done() <-chan struct{} {
+	return f.timeline.reached(f.value)
+}
+
+// Ready reports whether the value has been reached without blocking.
+func (f *Future) Ready() bool {
+	select {
+	case <-f.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *Future) Wait(ctx context.Context) error {
+	return f.timeline.Wait(ctx, f.value)
+}
+
+// WaitAt returns a TimelineWait for the future, to be used in another submission.
+func (f *Future) WaitAt(stage vk.PipelineStageFlagBits) TimelineWait {
+	return TimelineWait{Timeline: f.timeline, Value: f.value, Stage: vk.PipelineStageFlags(stage)}
+}
@@ -0,0 +1,308 @@
+package asch
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// UniformRing sub-allocates per-frame uniform data from one persistently mapped buffer.
+// The buffer is split into one region per frame in flight, a region is reused once the
+// frame that wrote it has completed. Allocations are bound through a single dynamic
+// uniform buffer descriptor, the allocation offset being its dynamic offset.
+type UniformRing struct {
+	mu        sync.Mutex
+	device    vk.Device
+	buffer    *Buffer
+	mapped    []byte
+	alignment vk.DeviceSize
+	frameSize vk.DeviceSize
+	maxRange  vk.DeviceSize
+	frames    int
+	start     vk.DeviceSize
+	head      vk.DeviceSize
+
+	setLayout vk.DescriptorSetLayout
+	pool      vk.DescriptorPool
+	set       vk.DescriptorSet
+}
+
+// NewUniformRing creates a ring with frameSize bytes for each of the frames in flight.
+// maxRange is the largest block written at once, the descriptor covers that many bytes,
+// stages are the shader stages reading the blocks.
+func NewUniformRing(v *Vulkan, framesInFlight int, frameSize, maxRange vk.DeviceSize, stages vk.ShaderStageFlags) (*UniformRing, error) {
+	limits := v.Properties.Limits
+	if maxRange == 0 || maxRange > vk.DeviceSize(limits.MaxUniformBufferRange) {
+		return nil, fmt.Errorf("NewUniformRing: range %d exceeds maxUniformBufferRange %d", maxRange, limits.MaxUniformBufferRange)
+	}
+	r := &UniformRing{
+		device:    v.Device,
+		alignment: max(limits.MinUniformBufferOffsetAlignment, 1),
+		maxRange:  maxRange,
+		frames:    framesInFlight,
+	}
+	r.frameSize = alignUp(max(frameSize, maxRange), r.alignment)
+
+	// Phase 1: Allocator.CreateBuffer
+	//			one region per frame, plus room for the descriptor range past the last offset
+
+	var err error
+	r.buffer, err = v.Allocator.CreateBuffer(r.frameSize*vk.DeviceSize(framesInFlight)+maxRange,
+		vk.BufferUsageFlags(vk.BufferUsageUniformBufferBit), MemoryCPUToGPU)
+	if err != nil {
+		return nil, err
+	}
+	r.mapped, err = r.buffer.Map()
+	if err != nil {
+		r.Destroy()
+		return nil, err
+	}
+
+	// Phase 2: vk.CreateDescriptorSetLayout
+	//			vk.CreateDescriptorPool
+	//			vk.AllocateDescriptorSets
+
+	setLayoutBindings := []vk.DescriptorSetLayoutBinding{{
+		Binding:         0,
+		DescriptorType:  vk.DescriptorTypeUniformBufferDynamic,
+		DescriptorCount: 1,
+		StageFlags:      stages,
+	}}
+	setLayoutCreateInfo := vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: 1,
+		PBindings:    setLayoutBindings,
+	}
+	err = vk.Error(vk.CreateDescriptorSetLayout(r.device, &setLayoutCreateInfo, nil, &r.setLayout))
+	if err != nil {
+		r.Destroy()
+		err = fmt.Errorf("vk.CreateDescriptorSetLayout failed with %s", err)
+		return nil, err
+	}
+	poolSizes := []vk.DescriptorPoolSize{{
+		Type:            vk.DescriptorTypeUniformBufferDynamic,
+		DescriptorCount: 1,
+	}}
+	poolCreateInfo := vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       1,
+		PoolSizeCount: 1,
+		PPoolSizes:    poolSizes,
+	}
+	err = vk.Error(vk.CreateDescriptorPool(r.device, &poolCreateInfo, nil, &r.pool))
+	if err != nil {
+		r.Destroy()
+		err = fmt.Errorf("vk.CreateDescriptorPool failed with %s", err)
+		return nil, err
+	}
+	setAllocateInfo := vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     r.pool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{r.setLayout},
+	}
+	sets := make([]vk.DescriptorSet, 1)
+	err = vk.Error(vk.AllocateDescriptorSets(r.device, &setAllocateInfo, &sets[0]))
+	if err != nil {
+		r.Destroy()
+		err = fmt.Errorf("vk.AllocateDescriptorSets failed with %s", err)
+		return nil, err
+	}
+	r.set = sets[0]
+
+	// Phase 3: vk.UpdateDescriptorSets
+
+	writes := []vk.WriteDescriptorSet{{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          r.set,
+		DstBinding:      0,
+		DescriptorCount: 1,
+		DescriptorType:  vk.DescriptorTypeUniformBufferDynamic,
+		PBufferInfo: []vk.DescriptorBufferInfo{{
+			Buffer: r.buffer.Handle,
+			Offset: 0,
+			Range:  maxRange,
+		}},
+	}}
+	vk.UpdateDescriptorSets(r.device, 1, writes, 0, nil)
+	return r, nil
+}
+
+// DescriptorSetLayout returns the layout of the ring descriptor set, for pipeline layouts.
+func (r *UniformRing) DescriptorSetLayout() vk.DescriptorSetLayout {
+	return r.setLayout
+}
+
+// DescriptorSet returns the set with the dynamic uniform buffer at binding 0.
+func (r *UniformRing) DescriptorSet() vk.DescriptorSet {
+	return r.set
+}
+
+// BeginFrame starts writing into the region of frame, which the GPU must have finished
+// reading, e.g. VulkanRenderInfo.Frame after DrawFrame waited for the previous use.
+func (r *UniformRing) BeginFrame(frame uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.start = vk.DeviceSize(frame%uint64(r.frames)) * r.frameSize
+	r.head = r.start
+}
+
+// Alloc returns size bytes of the current frame region and their dynamic offset.
+// Call Flush once they are written.
+func (r *UniformRing) Alloc(size vk.DeviceSize) ([]byte, uint32, error) {
+	if size > r.maxRange {
+		return nil, 0, fmt.Errorf("UniformRing.Alloc: %d bytes exceed the range of %d", size, r.maxRange)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offset := alignUp(r.head, r.alignment)
+	if offset+size > r.start+r.frameSize {
+		return nil, 0, fmt.Errorf("UniformRing.Alloc: frame region of %d bytes is full", r.frameSize)
+	}
+	r.head = offset + size
+	return r.mapped[offset : offset+size], uint32(offset), nil
+}
+
+// Write lays value out with std140 rules into the current frame region and returns
+// the dynamic offset to bind it with.
+func (r *UniformRing) Write(value any) (uint32, error) {
+	size, err := Std140.Sizeof(value)
+	if err != nil {
+		return 0, err
+	}
+	data, offset, err := r.Alloc(vk.DeviceSize(size))
+	if err != nil {
+		return 0, err
+	}
+	if err = Std140.Encode(data, value); err != nil {
+		return 0, err
+	}
+	if err = r.buffer.Flush(vk.DeviceSize(offset), vk.DeviceSize(size)); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// Flush makes everything written into the current frame region visible to the device,
+// needed after filling Alloc results on non-coherent memory.
+func (r *UniformRing) Flush() error {
+	r.mu.Lock()
+	start, head := r.start, r.head
+	r.mu.Unlock()
+	return r.buffer.Flush(start, head-start)
+}
+
+// Bind binds the ring descriptor set at set with the dynamic offset of an allocation.
+func (r *UniformRing) Bind(cmd vk.CommandBuffer, bindPoint vk.PipelineBindPoint, layout vk.PipelineLayout, set uint32, offset uint32) {
+	vk.CmdBindDescriptorSets(cmd, bindPoint, layout, set, 1, []vk.DescriptorSet{r.set}, 1, []uint32{offset})
+}
+
+// Destroy destroys the descriptors and the buffer, the GPU must be done with them.
+func (r *UniformRing) Destroy() {
+	if r.pool != vk.NullDescriptorPool {
+		vk.DestroyDescriptorPool(r.device, r.pool, nil)
+	}
+	if r.setLayout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(r.device, r.setLayout, nil)
+	}
+	r.buffer.Destroy()
+	r.mapped = nil
+}
+
+// CheckUniformBlock verifies that the std140 layout of the Go struct value matches the
+// uniform block the SPIR-V shader declares at set and binding, member by member, nested
+// structs and the strides of arrays and matrices included.
+func CheckUniformBlock(spirv []byte, set, binding uint32, value any) error {
+	return checkBlock(spirv, spirvStorageUniform, set, binding, Std140, value)
+}
+
+// CheckStorageBlock is CheckUniformBlock for storage blocks laid out with rules.
+func CheckStorageBlock(spirv []byte, set, binding uint32, rules LayoutRules, value any) error {
+	return checkBlock(spirv, spirvStorageStorageBuffer, set, binding, rules, value)
+}
+
+func checkBlock(spirv []byte, storageClass, set, binding uint32, rules LayoutRules, value any) error {
+	v, err := indirect(value)
+	if err != nil {
+		return err
+	}
+	blocks, err := reflectBlocks(spirv)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if b.StorageClass != storageClass || b.Set != set || b.Binding != binding {
+			continue
+		}
+		return checkMembers("block "+b.Name, b.Members, v.Type(), rules)
+	}
+	return fmt.Errorf("shader declares no such block at set %d binding %d", set, binding)
+}
+
+// checkMembers compares the members of a block, or of a struct in it, with the fields of t.
+func checkMembers(path string, members []shaderBlockMember, t reflect.Type, rules LayoutRules) error {
+	offsets, err := rules.Offsets(t)
+	if err != nil {
+		return err
+	}
+	if len(members) != len(offsets) {
+		return fmt.Errorf("%s has %d members, %s has %d fields", path, len(members), t, len(offsets))
+	}
+	for i, m := range members {
+		name := path + " member " + m.Name
+		if m.Offset != offsets[i] {
+			return fmt.Errorf("%s is at offset %d, %s.%s at %s offset %d",
+				name, m.Offset, t, t.Field(i).Name, rules, offsets[i])
+		}
+		if err := checkMember(name, m, t.Field(i).Type, rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMember compares the array and matrix strides and the struct members of m with t.
+func checkMember(name string, m shaderBlockMember, t reflect.Type, rules LayoutRules) error {
+	st := m.Type
+	for st != nil && st.Array {
+		if t.Kind() != reflect.Array || isVector(t) {
+			return fmt.Errorf("%s is an array, the Go field is %s", name, t)
+		}
+		if st.Length != 0 && uint32(t.Len()) != st.Length {
+			return fmt.Errorf("%s has %d elements, %s has %d", name, st.Length, t, t.Len())
+		}
+		_, stride, err := rules.arrayStride(t)
+		if err != nil {
+			return err
+		}
+		if stride != st.ArrayStride {
+			return fmt.Errorf("%s has an array stride of %d, %s has %s stride %d", name, st.ArrayStride, t, rules, stride)
+		}
+		st, t = st.Elem, t.Elem()
+	}
+	switch {
+	case st == nil:
+	case st.Matrix:
+		if m.RowMajor {
+			return fmt.Errorf("%s is row major, Go matrices are column major", name)
+		}
+		if t.Kind() != reflect.Array || !isVector(t.Elem()) || uint32(t.Len()) != st.Length {
+			return fmt.Errorf("%s is a matrix of %d columns, the Go field is %s", name, st.Length, t)
+		}
+		_, stride, err := rules.arrayStride(t)
+		if err != nil {
+			return err
+		}
+		if stride != m.MatrixStride {
+			return fmt.Errorf("%s has a matrix stride of %d, %s has %s stride %d", name, m.MatrixStride, t, rules, stride)
+		}
+	case st.Members != nil:
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("%s is a struct, the Go field is %s", name, t)
+		}
+		return checkMembers(name, st.Members, t, rules)
+	}
+	return nil
+}
@@ -0,0 +1,696 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// stagingAlignment keeps staging offsets valid for any copy, including buffer to image.
+const stagingAlignment = 16
+
+// uploadBatches is the number of submissions reading from the ring at the same time.
+const uploadBatches = 4
+
+// Uploader copies data into device local memory through a staging ring buffer.
+// Copies are batched into one command buffer until Flush. When the ring runs out, the
+// batch is submitted and only the batches holding the bytes about to be reused are
+// waited for, so uploads keep flowing while earlier ones are copied.
+//
+// Copies run on the transfer queue. When it belongs to another family than the graphics
+// queue, the uploaded resources are released by the transfer queue and acquired by the
+// graphics queue. On unified memory devices (integrated GPUs, lavapipe) host visible
+// memory is device local as well, so resources are written directly without staging.
+type Uploader struct {
+	mu        sync.Mutex
+	device    vk.Device
+	allocator *Allocator
+	samplers  *SamplerCache
+	transfer  *Queue
+	graphics  *Queue
+	unified   bool
+
+	staging *Buffer
+	ring    []byte
+	// head and tail count the bytes ever reserved in the ring and ever released by
+	// completed batches, the bytes between them are in use
+	head vk.DeviceSize
+	tail vk.DeviceSize
+
+	batches [uploadBatches]uploadBatch
+	// batch is the batch being recorded, nil between submissions
+	batch *uploadBatch
+	// submitted are the batches in flight, oldest first
+	submitted []*uploadBatch
+
+	// acquires are recorded on the graphics queue, for resources released by the transfer queue
+	acquires *Barriers
+	// graphicsWork is recorded on the graphics queue after the acquires, e.g. mip blits
+	graphicsWork []func(cmd vk.CommandBuffer) error
+}
+
+// uploadBatch is one submission of the uploader.
+type uploadBatch struct {
+	transferPool vk.CommandPool
+	graphicsPool vk.CommandPool
+	transferCmd  vk.CommandBuffer
+	graphicsCmd  vk.CommandBuffer
+	semaphore    vk.Semaphore
+	fence        vk.Fence
+	// end is the ring head when the batch was submitted
+	end vk.DeviceSize
+}
+
+func NewUploader(v *Vulkan, ringSize vk.DeviceSize) (*Uploader, error) {
+	u := &Uploader{
+		device:    v.Device,
+		allocator: v.Allocator,
+		samplers:  v.Samplers,
+		transfer:  v.TransferQueue,
+		graphics:  v.Queue,
+		unified:   isUnifiedMemory(v.Properties.DeviceType, v.Allocator.MemoryProperties()),
+		acquires:  NewBarriers(v.Queue.Family()),
+	}
+
+	// Phase 1: staging ring buffer, mapped for the whole life of the uploader
+
+	var err error
+	u.staging, err = v.Allocator.CreateBuffer(ringSize, vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit), MemoryCPUToGPU)
+	if err != nil {
+		return nil, err
+	}
+	u.ring, err = u.staging.Map()
+	if err != nil {
+		u.Destroy()
+		return nil, err
+	}
+
+	// Phase 2: vk.CreateCommandPool
+	//			vk.AllocateCommandBuffers
+	//			vk.CreateFence
+	//			one pool per queue family taking part in the upload, for every batch
+
+	for i := range u.batches {
+		if err = u.batches[i].init(u.device, u.transfer.Family(), u.graphics.Family()); err != nil {
+			u.Destroy()
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func (b *uploadBatch) init(device vk.Device, transferFamily, graphicsFamily uint32) error {
+	var err error
+	b.transferPool, b.transferCmd, err = newTransientCommandBuffer(device, transferFamily)
+	if err != nil {
+		return err
+	}
+	if transferFamily != graphicsFamily {
+		b.graphicsPool, b.graphicsCmd, err = newTransientCommandBuffer(device, graphicsFamily)
+		if err != nil {
+			return err
+		}
+		semaphoreCreateInfo := vk.SemaphoreCreateInfo{
+			SType: vk.StructureTypeSemaphoreCreateInfo,
+		}
+		err = vk.Error(vk.CreateSemaphore(device, &semaphoreCreateInfo, nil, &b.semaphore))
+		if err != nil {
+			err = fmt.Errorf("vk.CreateSemaphore failed with %s", err)
+			return err
+		}
+	}
+	fenceCreateInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}
+	err = vk.Error(vk.CreateFence(device, &fenceCreateInfo, nil, &b.fence))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateFence failed with %s", err)
+		return err
+	}
+	return nil
+}
+
+func (b *uploadBatch) destroy(device vk.Device) {
+	if b.fence != vk.NullFence {
+		vk.DestroyFence(device, b.fence, nil)
+	}
+	if b.semaphore != vk.NullSemaphore {
+		vk.DestroySemaphore(device, b.semaphore, nil)
+	}
+	for _, pool := range []vk.CommandPool{b.transferPool, b.graphicsPool} {
+		if pool != vk.NullCommandPool {
+			vk.DestroyCommandPool(device, pool, nil)
+		}
+	}
+	*b = uploadBatch{}
+}
+
+func newTransientCommandBuffer(device vk.Device, family uint32) (vk.CommandPool, vk.CommandBuffer, error) {
+	cmdPoolCreateInfo := vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateTransientBit),
+		QueueFamilyIndex: family,
+	}
+	var pool vk.CommandPool
+	err := vk.Error(vk.CreateCommandPool(device, &cmdPoolCreateInfo, nil, &pool))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateCommandPool failed with %s", err)
+		return vk.NullCommandPool, nil, err
+	}
+	cmdBuffers := make([]vk.CommandBuffer, 1)
+	cmdBufferAllocateInfo := vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        pool,
+		Level:              vk.CommandBufferLevelPrimary,
+		CommandBufferCount: 1,
+	}
+	err = vk.Error(vk.AllocateCommandBuffers(device, &cmdBufferAllocateInfo, cmdBuffers))
+	if err != nil {
+		vk.DestroyCommandPool(device, pool, nil)
+		err = fmt.Errorf("vk.AllocateCommandBuffers failed with %s", err)
+		return vk.NullCommandPool, nil, err
+	}
+	return pool, cmdBuffers[0], nil
+}
+
+// isUnifiedMemory reports devices where some memory is both device local and host visible
+// and the GPU has no memory of its own worth staging into.
+func isUnifiedMemory(deviceType vk.PhysicalDeviceType, memProperties vk.PhysicalDeviceMemoryProperties) bool {
+	if deviceType != vk.PhysicalDeviceTypeIntegratedGpu && deviceType != vk.PhysicalDeviceTypeCpu {
+		return false
+	}
+	unified := vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit | vk.MemoryPropertyHostVisibleBit)
+	for i := uint32(0); i < memProperties.MemoryTypeCount; i++ {
+		if memProperties.MemoryTypes[i].PropertyFlags&unified == unified {
+			return true
+		}
+	}
+	return false
+}
+
+// Unified reports whether uploads are written directly instead of staged.
+func (u *Uploader) Unified() bool {
+	return u.unified
+}
+
+func (u *Uploader) ownershipTransfer() bool {
+	return u.transfer.Family() != u.graphics.Family()
+}
+
+// CreateBufferWithData creates a device local buffer filled with data. The buffer is
+// ready for use once Flush returns.
+func (u *Uploader) CreateBufferWithData(ctx context.Context, usage vk.BufferUsageFlags, data []byte) (*Buffer, error) {
+	var buffer *Buffer
+	var err error
+	if u.unified {
+		// the usage may rule out the device local host visible types, host visible
+		// memory is as fast to read then
+		buffer, err = u.allocator.CreateBuffer(vk.DeviceSize(len(data)), usage, MemoryCPUToGPUDeviceLocal)
+		if err != nil {
+			buffer, err = u.allocator.CreateBuffer(vk.DeviceSize(len(data)), usage, MemoryCPUToGPU)
+		}
+	} else {
+		usage |= vk.BufferUsageFlags(vk.BufferUsageTransferDstBit)
+		buffer, err = u.allocator.CreateBuffer(vk.DeviceSize(len(data)), usage, MemoryGPUOnly)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = u.UploadBuffer(ctx, buffer, 0, data); err != nil {
+		buffer.Destroy()
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// UploadBuffer copies data into dst at offset. Host visible buffers are written directly,
+// everything else is staged and copied on the GPU at the next Flush. dst must have been
+// created with vk.BufferUsageTransferDstBit then. Buffers the graphics queue owns already
+// are copied into on the graphics queue, after the work using them and keeping the bytes
+// outside data.
+func (u *Uploader) UploadBuffer(ctx context.Context, dst *Buffer, offset vk.DeviceSize, data []byte) error {
+	if offset+vk.DeviceSize(len(data)) > dst.Size {
+		return fmt.Errorf("UploadBuffer: %d bytes at offset %d overflow buffer of %d bytes", len(data), offset, dst.Size)
+	}
+	if dst.HostVisible() {
+		return dst.Upload(offset, data)
+	}
+	if dst.Usage&vk.BufferUsageFlags(vk.BufferUsageTransferDstBit) == 0 {
+		return fmt.Errorf("UploadBuffer: buffer was not created with vk.BufferUsageTransferDstBit")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.begin(ctx); err != nil {
+		return err
+	}
+	onGraphics := u.copiesOnGraphics(dst.state.owner)
+	barriers := NewBarriers(u.copyFamily(onGraphics))
+	barriers.Buffer(dst, StateTransferDst)
+	cmd, err := u.copyCmd(onGraphics)
+	if err != nil {
+		return err
+	}
+	if err = barriers.Record(cmd); err != nil {
+		return fmt.Errorf("UploadBuffer: %w", err)
+	}
+	for len(data) > 0 {
+		chunk := min(vk.DeviceSize(len(data)), u.staging.Size)
+		src, err := u.stage(ctx, data[:chunk], stagingAlignment)
+		if err != nil {
+			return err
+		}
+		// stage may have submitted the batch
+		if cmd, err = u.copyCmd(onGraphics); err != nil {
+			return err
+		}
+		regions := []vk.BufferCopy{{
+			SrcOffset: src,
+			DstOffset: offset,
+			Size:      chunk,
+		}}
+		vk.CmdCopyBuffer(cmd, u.staging.Handle, dst.Handle, 1, regions)
+		data = data[chunk:]
+		offset += chunk
+	}
+	return u.releaseBuffer(dst, onGraphics)
+}
+
+// stage copies data into the ring at a multiple of alignment and returns its offset.
+// When the ring is full it waits for the oldest batches until their bytes are released,
+// submitting the batch being recorded first if it holds them.
+func (u *Uploader) stage(ctx context.Context, data []byte, alignment vk.DeviceSize) (vk.DeviceSize, error) {
+	size := vk.DeviceSize(len(data))
+	for {
+		if u.head == u.tail && len(u.submitted) == 0 {
+			// an empty ring starts over at its beginning
+			u.head, u.tail = 0, 0
+		}
+		offset := alignUp(u.head%u.staging.Size, alignment)
+		if offset+size > u.staging.Size {
+			offset = 0
+		}
+		// the bytes skipped to reach offset count as used until the batch completes
+		end := u.head - u.head%u.staging.Size + offset + size
+		if offset < u.head%u.staging.Size {
+			end += u.staging.Size
+		}
+		if end-u.tail <= u.staging.Size {
+			if err := u.begin(ctx); err != nil {
+				return 0, err
+			}
+			copy(u.ring[offset:], data)
+			if err := u.staging.Flush(offset, size); err != nil {
+				return 0, err
+			}
+			u.head = end
+			return offset, nil
+		}
+		if len(u.submitted) == 0 {
+			if err := u.submit(); err != nil {
+				return 0, err
+			}
+		}
+		if err := u.retire(ctx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// begin starts recording a batch unless one is being recorded, u.mu must be held.
+// It waits for the oldest batch when all of them are in flight.
+func (u *Uploader) begin(ctx context.Context) error {
+	if u.batch != nil {
+		return nil
+	}
+	if len(u.submitted) == len(u.batches) {
+		if err := u.retire(ctx); err != nil {
+			return err
+		}
+	}
+	var batch *uploadBatch
+	for i := range u.batches {
+		if !slices.Contains(u.submitted, &u.batches[i]) {
+			batch = &u.batches[i]
+			break
+		}
+	}
+	cmdBufferBeginInfo := vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+	}
+	for _, cmd := range []vk.CommandBuffer{batch.transferCmd, batch.graphicsCmd} {
+		if cmd == nil {
+			continue
+		}
+		err := vk.Error(vk.BeginCommandBuffer(cmd, &cmdBufferBeginInfo))
+		if err != nil {
+			err = fmt.Errorf("vk.BeginCommandBuffer failed with %s", err)
+			return err
+		}
+	}
+	u.batch = batch
+	return nil
+}
+
+// copiesOnGraphics reports whether copies into a resource owned by owner are recorded on
+// the graphics queue. Once the graphics queue uses a resource, copies on the transfer queue
+// would neither wait for that work nor keep the contents without a transfer back.
+func (u *Uploader) copiesOnGraphics(owner uint32) bool {
+	return u.ownershipTransfer() && owner == u.graphics.Family()
+}
+
+func (u *Uploader) copyFamily(onGraphics bool) uint32 {
+	if onGraphics {
+		return u.graphics.Family()
+	}
+	return u.transfer.Family()
+}
+
+// copyCmd returns the command buffer of the batch being recorded copies go to. Copies on
+// the graphics queue follow the acquires and the graphics work queued before them.
+func (u *Uploader) copyCmd(onGraphics bool) (vk.CommandBuffer, error) {
+	if !onGraphics {
+		return u.batch.transferCmd, nil
+	}
+	if err := u.recordGraphics(u.batch.graphicsCmd); err != nil {
+		return nil, err
+	}
+	return u.batch.graphicsCmd, nil
+}
+
+// recordGraphics records the pending acquires and graphics work into cmd.
+func (u *Uploader) recordGraphics(cmd vk.CommandBuffer) error {
+	if err := u.acquires.Record(cmd); err != nil {
+		return err
+	}
+	for _, record := range u.graphicsWork {
+		if err := record(cmd); err != nil {
+			return err
+		}
+	}
+	u.graphicsWork = nil
+	return nil
+}
+
+// releaseBuffer makes the copies visible to the readers implied by the buffer usage,
+// handing the buffer over to the graphics queue family when needed.
+func (u *Uploader) releaseBuffer(dst *Buffer, onGraphics bool) error {
+	access, stages := bufferReadScope(dst.Usage)
+	readers := ResourceState{Stages: stages, Access: access}
+	barriers := NewBarriers(u.copyFamily(onGraphics))
+	if u.ownershipTransfer() && !onGraphics {
+		barriers.ReleaseBuffer(dst, u.graphics.Family())
+		u.acquires.Buffer(dst, readers)
+	} else {
+		barriers.Buffer(dst, readers)
+	}
+	cmd, err := u.copyCmd(onGraphics)
+	if err != nil {
+		return err
+	}
+	if err = barriers.Record(cmd); err != nil {
+		return fmt.Errorf("UploadBuffer: %w", err)
+	}
+	return nil
+}
+
+// shaderStages are the stages reading uploaded resources from shaders.
+const shaderStages = vk.PipelineStageFlags(vk.PipelineStageVertexShaderBit | vk.PipelineStageFragmentShaderBit | vk.PipelineStageComputeShaderBit)
+
+// bufferReadScope returns how the GPU reads a buffer of the given usage.
+func bufferReadScope(usage vk.BufferUsageFlags) (vk.AccessFlags, vk.PipelineStageFlags) {
+	var access vk.AccessFlags
+	var stages vk.PipelineStageFlags
+	has := func(bit vk.BufferUsageFlagBits) bool {
+		return usage&vk.BufferUsageFlags(bit) != 0
+	}
+	if has(vk.BufferUsageVertexBufferBit) {
+		access |= vk.AccessFlags(vk.AccessVertexAttributeReadBit)
+		stages |= vk.PipelineStageFlags(vk.PipelineStageVertexInputBit)
+	}
+	if has(vk.BufferUsageIndexBufferBit) {
+		access |= vk.AccessFlags(vk.AccessIndexReadBit)
+		stages |= vk.PipelineStageFlags(vk.PipelineStageVertexInputBit)
+	}
+	if has(vk.BufferUsageUniformBufferBit) {
+		access |= vk.AccessFlags(vk.AccessUniformReadBit)
+		stages |= shaderStages
+	}
+	if has(vk.BufferUsageStorageBufferBit) {
+		access |= vk.AccessFlags(vk.AccessShaderReadBit | vk.AccessShaderWriteBit)
+		stages |= shaderStages
+	}
+	if has(vk.BufferUsageIndirectBufferBit) {
+		access |= vk.AccessFlags(vk.AccessIndirectCommandReadBit)
+		stages |= vk.PipelineStageFlags(vk.PipelineStageDrawIndirectBit)
+	}
+	if has(vk.BufferUsageTransferSrcBit) {
+		access |= vk.AccessFlags(vk.AccessTransferReadBit)
+		stages |= vk.PipelineStageFlags(vk.PipelineStageTransferBit)
+	}
+	if stages == 0 {
+		access = vk.AccessFlags(vk.AccessMemoryReadBit)
+		stages = vk.PipelineStageFlags(vk.PipelineStageAllCommandsBit)
+	}
+	return access, stages
+}
+
+// UploadImageData replaces a whole subresource of dst with tightly packed texel data and
+// leaves it in vk.ImageLayoutShaderReadOnlyOptimal once Flush returns. dst must have been
+// created with vk.ImageUsageTransferDstBit.
+func (u *Uploader) UploadImageData(ctx context.Context, dst *Image, level, layer uint32, data []byte) error {
+	if level >= dst.MipLevels || layer >= dst.Layers {
+		return fmt.Errorf("UploadImageData: level %d layer %d out of %d levels and %d layers", level, layer, dst.MipLevels, dst.Layers)
+	}
+	if dst.Usage&vk.ImageUsageFlags(vk.ImageUsageTransferDstBit) == 0 {
+		return fmt.Errorf("UploadImageData: image was not created with vk.ImageUsageTransferDstBit")
+	}
+	info, ok := LookupFormat(dst.Format)
+	if !ok {
+		return fmt.Errorf("UploadImageData: unknown format %d", dst.Format)
+	}
+	// rows are rows of texel blocks for compressed formats
+	extent := dst.MipExtent(level)
+	height := int((extent.Height + info.BlockHeight - 1) / info.BlockHeight)
+	rows := height * int(extent.Depth)
+	rowSize := int((extent.Width+info.BlockWidth-1)/info.BlockWidth) * int(info.Size)
+	if len(data) != rows*rowSize {
+		return fmt.Errorf("UploadImageData: %d bytes, expected %d rows of %d bytes", len(data), rows, rowSize)
+	}
+	if vk.DeviceSize(rowSize) > u.staging.Size {
+		return fmt.Errorf("UploadImageData: row of %d bytes exceeds the staging ring", rowSize)
+	}
+	// buffer offsets of copies to images are multiples of the texel block size too,
+	// which is 3, 6 or 12 bytes for some formats
+	alignment := vk.DeviceSize(stagingAlignment)
+	for alignment%vk.DeviceSize(info.Size) != 0 {
+		alignment += stagingAlignment
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.begin(ctx); err != nil {
+		return err
+	}
+
+	// Phase 1: vk.CmdPipelineBarrier
+	//			the whole subresource is replaced, its previous contents are discarded
+	//			once the reads tracked for it are done, on the graphics queue when it
+	//			has used the subresource
+
+	r := ImageRange{BaseLevel: level, Levels: 1, BaseLayer: layer, Layers: 1}
+	onGraphics := u.copiesOnGraphics(dst.state(level, layer).owner)
+	barriers := NewBarriers(u.copyFamily(onGraphics))
+	barriers.DiscardImage(dst, r, StateTransferDst)
+	cmd, err := u.copyCmd(onGraphics)
+	if err != nil {
+		return err
+	}
+	if err = barriers.Record(cmd); err != nil {
+		return fmt.Errorf("UploadImageData: %w", err)
+	}
+	aspect := dst.Aspect()
+
+	// Phase 2: vk.CmdCopyBufferToImage
+	//			as many rows at once as fit into the ring, never across depth slices
+
+	for row := 0; row < rows; {
+		y, z := row%height, row/height
+		n := min(rows-row, height-y, int(u.staging.Size)/rowSize)
+		src, err := u.stage(ctx, data[row*rowSize:(row+n)*rowSize], alignment)
+		if err != nil {
+			return err
+		}
+		if cmd, err = u.copyCmd(onGraphics); err != nil {
+			return err
+		}
+		regions := []vk.BufferImageCopy{{
+			BufferOffset: src,
+			ImageSubresource: vk.ImageSubresourceLayers{
+				AspectMask:     aspect,
+				MipLevel:       level,
+				BaseArrayLayer: layer,
+				LayerCount:     1,
+			},
+			ImageOffset: vk.Offset3D{Y: int32(uint32(y) * info.BlockHeight), Z: int32(z)},
+			ImageExtent: vk.Extent3D{
+				Width:  extent.Width,
+				Height: min(uint32(n)*info.BlockHeight, extent.Height-uint32(y)*info.BlockHeight),
+				Depth:  1,
+			},
+		}}
+		vk.CmdCopyBufferToImage(cmd, u.staging.Handle, dst.Handle,
+			vk.ImageLayoutTransferDstOptimal, 1, regions)
+		row += n
+	}
+
+	// Phase 3: vk.CmdPipelineBarrier
+	//			to vk.ImageLayoutShaderReadOnlyOptimal, handed over to the graphics queue when needed
+
+	return u.releaseImage(dst, r, onGraphics)
+}
+
+// releaseImage moves the copied subresources to vk.ImageLayoutShaderReadOnlyOptimal,
+// handing them over to the graphics queue family when needed.
+func (u *Uploader) releaseImage(dst *Image, r ImageRange, onGraphics bool) error {
+	barriers := NewBarriers(u.copyFamily(onGraphics))
+	if u.ownershipTransfer() && !onGraphics {
+		barriers.ReleaseImage(dst, r, u.graphics.Family(), StateShaderRead)
+		u.acquires.Image(dst, r, StateShaderRead)
+	} else {
+		barriers.Image(dst, r, StateShaderRead)
+	}
+	cmd, err := u.copyCmd(onGraphics)
+	if err != nil {
+		return err
+	}
+	if err = barriers.Record(cmd); err != nil {
+		return fmt.Errorf("UploadImageData: %w", err)
+	}
+	return nil
+}
+
+// Flush submits the recorded copies and waits until they are complete.
+func (u *Uploader) Flush(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.flush(ctx)
+}
+
+func (u *Uploader) flush(ctx context.Context) error {
+	if err := u.submit(); err != nil {
+		return err
+	}
+	return u.wait(ctx)
+}
+
+// submit submits the batch being recorded, if any, u.mu must be held.
+func (u *Uploader) submit() error {
+	batch := u.batch
+	if batch == nil {
+		return nil
+	}
+
+	// Phase 1: vk.CmdPipelineBarrier
+	//			vk.EndCommandBuffer
+	//			acquire ownership on the graphics queue
+
+	graphicsCmd := batch.graphicsCmd
+	if !u.ownershipTransfer() {
+		graphicsCmd = batch.transferCmd
+	}
+	if err := u.recordGraphics(graphicsCmd); err != nil {
+		return err
+	}
+	for _, cmd := range []vk.CommandBuffer{batch.transferCmd, batch.graphicsCmd} {
+		if cmd == nil {
+			continue
+		}
+		err := vk.Error(vk.EndCommandBuffer(cmd))
+		if err != nil {
+			err = fmt.Errorf("vk.EndCommandBuffer failed with %s", err)
+			return err
+		}
+	}
+	u.batch = nil
+
+	// Phase 2: Queue.Submit
+	//			the graphics queue waits for the transfer through a semaphore
+
+	transferSubmit := vk.SubmitInfo{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vk.CommandBuffer{batch.transferCmd},
+	}
+	if !u.ownershipTransfer() {
+		if err := u.transfer.Submit(batch.fence, transferSubmit); err != nil {
+			return err
+		}
+	} else {
+		transferSubmit.SignalSemaphoreCount = 1
+		transferSubmit.PSignalSemaphores = []vk.Semaphore{batch.semaphore}
+		if err := u.transfer.Submit(vk.NullFence, transferSubmit); err != nil {
+			return err
+		}
+		graphicsSubmit := vk.SubmitInfo{
+			SType:              vk.StructureTypeSubmitInfo,
+			WaitSemaphoreCount: 1,
+			PWaitSemaphores:    []vk.Semaphore{batch.semaphore},
+			PWaitDstStageMask:  []vk.PipelineStageFlags{vk.PipelineStageFlags(vk.PipelineStageAllCommandsBit)},
+			CommandBufferCount: 1,
+			PCommandBuffers:    []vk.CommandBuffer{batch.graphicsCmd},
+		}
+		if err := u.graphics.Submit(batch.fence, graphicsSubmit); err != nil {
+			return err
+		}
+	}
+	batch.end = u.head
+	u.submitted = append(u.submitted, batch)
+	return nil
+}
+
+// retire waits for the oldest batch in flight and releases its ring bytes and command
+// buffers, u.mu must be held. When the context ends first, the batch stays in flight.
+func (u *Uploader) retire(ctx context.Context) error {
+	batch := u.submitted[0]
+	if err := WaitForFences(ctx, u.device, []vk.Fence{batch.fence}, true); err != nil {
+		return err
+	}
+	vk.ResetFences(u.device, 1, []vk.Fence{batch.fence})
+	for _, pool := range []vk.CommandPool{batch.transferPool, batch.graphicsPool} {
+		if pool != vk.NullCommandPool {
+			vk.ResetCommandPool(u.device, pool, 0)
+		}
+	}
+	u.submitted = u.submitted[1:]
+	u.tail = batch.end
+	return nil
+}
+
+// wait waits for all submitted copies, u.mu must be held.
+func (u *Uploader) wait(ctx context.Context) error {
+	for len(u.submitted) > 0 {
+		if err := u.retire(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Destroy releases the uploader. Pending copies must have been flushed.
+func (u *Uploader) Destroy() {
+	for i := range u.batches {
+		u.batches[i].destroy(u.device)
+	}
+	u.batch, u.submitted = nil, nil
+	u.staging.Destroy()
+	u.ring = nil
+}
+
+func alignUp(v, alignment vk.DeviceSize) vk.DeviceSize {
+	return (v + alignment - 1) / alignment * alignment
+}
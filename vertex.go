@@ -0,0 +1,313 @@
+package asch
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+// VertexBinding describes one vertex buffer binding whose attributes are derived
+// from the fields of a Go struct.
+//
+// Exported fields become attributes in declaration order, each at the location after
+// the previous one unless tagged otherwise. The `vk` struct tag accepts
+//
+//	vk:"location=2,format=r16g16_sfloat,normalized"
+//	vk:"-"
+//
+// Scalars and arrays of up to four float32, int32, uint32, int16, uint16, int8 or uint8
+// get a format matching their type, normalized selects the unorm/snorm variant of the
+// integer ones. Arrays of such vectors (linmath.Mat4x4) take one location per column.
+type VertexBinding struct {
+	Binding uint32
+	Rate    vk.VertexInputRate
+	Type    reflect.Type
+}
+
+// PerVertex binds T at binding, advanced per vertex.
+func PerVertex[T any](binding uint32) VertexBinding {
+	return VertexBinding{Binding: binding, Rate: vk.VertexInputRateVertex, Type: reflect.TypeFor[T]()}
+}
+
+// PerInstance binds T at binding, advanced per instance.
+func PerInstance[T any](binding uint32) VertexBinding {
+	return VertexBinding{Binding: binding, Rate: vk.VertexInputRateInstance, Type: reflect.TypeFor[T]()}
+}
+
+// VertexLayout is the vertex input state of a pipeline.
+type VertexLayout struct {
+	Bindings   []vk.VertexInputBindingDescription
+	Attributes []vk.VertexInputAttributeDescription
+}
+
+// NewVertexLayout derives the binding and attribute descriptions of all the bindings.
+// Locations must not collide across bindings.
+func NewVertexLayout(bindings ...VertexBinding) (VertexLayout, error) {
+	var layout VertexLayout
+	usedBindings := make(map[uint32]bool)
+	usedLocations := make(map[uint32]string)
+	for _, b := range bindings {
+		if usedBindings[b.Binding] {
+			return layout, fmt.Errorf("NewVertexLayout: binding %d is used twice", b.Binding)
+		}
+		usedBindings[b.Binding] = true
+		attributes, err := vertexAttributes(b.Type)
+		if err != nil {
+			return layout, err
+		}
+		layout.Bindings = append(layout.Bindings, vk.VertexInputBindingDescription{
+			Binding:   b.Binding,
+			Stride:    uint32(b.Type.Size()),
+			InputRate: b.Rate,
+		})
+		for _, a := range attributes {
+			for i := range a.locations {
+				location := a.location + i
+				if field, ok := usedLocations[location]; ok {
+					return layout, fmt.Errorf("NewVertexLayout: %s.%s and %s share location %d", b.Type, a.name, field, location)
+				}
+				usedLocations[location] = b.Type.String() + "." + a.name
+				layout.Attributes = append(layout.Attributes, vk.VertexInputAttributeDescription{
+					Location: location,
+					Binding:  b.Binding,
+					Format:   a.format,
+					Offset:   a.offset + i*a.columnSize,
+				})
+			}
+		}
+	}
+	return layout, nil
+}
+
+// createInfo returns the vertex input state, the layout must outlive its use.
+func (l VertexLayout) createInfo() vk.PipelineVertexInputStateCreateInfo {
+	return vk.PipelineVertexInputStateCreateInfo{
+		SType:                           vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount:   uint32(len(l.Bindings)),
+		PVertexBindingDescriptions:      l.Bindings,
+		VertexAttributeDescriptionCount: uint32(len(l.Attributes)),
+		PVertexAttributeDescriptions:    l.Attributes,
+	}
+}
+
+type vertexAttribute struct {
+	name       string
+	location   uint32
+	locations  uint32 // columns of a matrix, 1 otherwise
+	format     vk.Format
+	offset     uint32
+	columnSize uint32
+}
+
+// vertexAttributeCache holds the attributes already derived per type.
+var vertexAttributeCache sync.Map
+
+func vertexAttributes(t reflect.Type) ([]vertexAttribute, error) {
+	if cached, ok := vertexAttributeCache.Load(t); ok {
+		return cached.([]vertexAttribute), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("vertex type %s is not a struct", t)
+	}
+	var attributes []vertexAttribute
+	var next uint32
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if typeHasPointers(field.Type) {
+			return nil, fmt.Errorf("vertex type %s: field %s holds pointers", t, field.Name)
+		}
+		tag, tagged := field.Tag.Lookup("vk")
+		if tag == "-" || !field.IsExported() {
+			if tagged && tag != "-" {
+				return nil, fmt.Errorf("vertex type %s: unexported field %s has a vk tag", t, field.Name)
+			}
+			continue
+		}
+		a, err := parseVertexField(field, tag, next)
+		if err != nil {
+			return nil, fmt.Errorf("vertex type %s: %s", t, err)
+		}
+		attributes = append(attributes, a)
+		next = a.location + a.locations
+	}
+	if len(attributes) == 0 {
+		return nil, fmt.Errorf("vertex type %s has no attributes", t)
+	}
+	vertexAttributeCache.Store(t, attributes)
+	return attributes, nil
+}
+
+func parseVertexField(field reflect.StructField, tag string, location uint32) (vertexAttribute, error) {
+	a := vertexAttribute{
+		name:      field.Name,
+		location:  location,
+		locations: 1,
+		offset:    uint32(field.Offset),
+	}
+	var formatName string
+	var normalized bool
+	for _, option := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch key {
+		case "":
+		case "location":
+			l, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return a, fmt.Errorf("field %s: bad location %q", field.Name, value)
+			}
+			a.location = uint32(l)
+		case "format":
+			formatName = value
+		case "normalized":
+			normalized = true
+		default:
+			return a, fmt.Errorf("field %s: unknown vk tag option %q", field.Name, key)
+		}
+	}
+
+	// arrays of vectors are matrices taking a location per column
+	column := field.Type
+	if column.Kind() == reflect.Array && column.Elem().Kind() == reflect.Array {
+		a.locations = uint32(column.Len())
+		column = column.Elem()
+	}
+	a.columnSize = uint32(column.Size())
+
+	if formatName != "" {
+		format, ok := FormatByName(formatName)
+		info := formatTable[format]
+		if !ok || info.IsCompressed() || info.Aspect != aspectColor {
+			return a, fmt.Errorf("field %s: unknown vertex format %q", field.Name, formatName)
+		}
+		if info.Size > a.columnSize {
+			return a, fmt.Errorf("field %s: format %s needs %d bytes, the field has %d", field.Name, formatName, info.Size, a.columnSize)
+		}
+		a.format = format
+		return a, nil
+	}
+	kind, components := column.Kind(), 1
+	if kind == reflect.Array {
+		kind, components = column.Elem().Kind(), column.Len()
+	}
+	format, ok := vertexFormats[vertexComponents{kind, components, normalized}]
+	if !ok {
+		return a, fmt.Errorf("field %s: no vertex format for %s, set one with the format tag", field.Name, field.Type)
+	}
+	a.format = format
+	return a, nil
+}
+
+func typeHasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Slice, reflect.Map, reflect.String,
+		reflect.Interface, reflect.Func, reflect.Chan:
+		return true
+	case reflect.Array:
+		return typeHasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if typeHasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type vertexComponents struct {
+	kind       reflect.Kind
+	count      int
+	normalized bool
+}
+
+var vertexFormats = map[vertexComponents]vk.Format{
+	{reflect.Float32, 1, false}: vk.FormatR32Sfloat,
+	{reflect.Float32, 2, false}: vk.FormatR32g32Sfloat,
+	{reflect.Float32, 3, false}: vk.FormatR32g32b32Sfloat,
+	{reflect.Float32, 4, false}: vk.FormatR32g32b32a32Sfloat,
+	{reflect.Int32, 1, false}:   vk.FormatR32Sint,
+	{reflect.Int32, 2, false}:   vk.FormatR32g32Sint,
+	{reflect.Int32, 3, false}:   vk.FormatR32g32b32Sint,
+	{reflect.Int32, 4, false}:   vk.FormatR32g32b32a32Sint,
+	{reflect.Uint32, 1, false}:  vk.FormatR32Uint,
+	{reflect.Uint32, 2, false}:  vk.FormatR32g32Uint,
+	{reflect.Uint32, 3, false}:  vk.FormatR32g32b32Uint,
+	{reflect.Uint32, 4, false}:  vk.FormatR32g32b32a32Uint,
+	{reflect.Int16, 1, false}:   vk.FormatR16Sint,
+	{reflect.Int16, 2, false}:   vk.FormatR16g16Sint,
+	{reflect.Int16, 4, false}:   vk.FormatR16g16b16a16Sint,
+	{reflect.Int16, 1, true}:    vk.FormatR16Snorm,
+	{reflect.Int16, 2, true}:    vk.FormatR16g16Snorm,
+	{reflect.Int16, 4, true}:    vk.FormatR16g16b16a16Snorm,
+	{reflect.Uint16, 1, false}:  vk.FormatR16Uint,
+	{reflect.Uint16, 2, false}:  vk.FormatR16g16Uint,
+	{reflect.Uint16, 4, false}:  vk.FormatR16g16b16a16Uint,
+	{reflect.Uint16, 1, true}:   vk.FormatR16Unorm,
+	{reflect.Uint16, 2, true}:   vk.FormatR16g16Unorm,
+	{reflect.Uint16, 4, true}:   vk.FormatR16g16b16a16Unorm,
+	{reflect.Int8, 1, false}:    vk.FormatR8Sint,
+	{reflect.Int8, 2, false}:    vk.FormatR8g8Sint,
+	{reflect.Int8, 4, false}:    vk.FormatR8g8b8a8Sint,
+	{reflect.Int8, 1, true}:     vk.FormatR8Snorm,
+	{reflect.Int8, 2, true}:     vk.FormatR8g8Snorm,
+	{reflect.Int8, 4, true}:     vk.FormatR8g8b8a8Snorm,
+	{reflect.Uint8, 1, false}:   vk.FormatR8Uint,
+	{reflect.Uint8, 2, false}:   vk.FormatR8g8Uint,
+	{reflect.Uint8, 4, false}:   vk.FormatR8g8b8a8Uint,
+	{reflect.Uint8, 1, true}:    vk.FormatR8Unorm,
+	{reflect.Uint8, 2, true}:    vk.FormatR8g8Unorm,
+	{reflect.Uint8, 4, true}:    vk.FormatR8g8b8a8Unorm,
+}
+
+// VertexBuffer is a device local buffer of vertices of type T.
+type VertexBuffer[T any] struct {
+	*Buffer
+	Count int
+}
+
+// NewVertexBuffer uploads the vertices into a new vertex buffer, the copy completes
+// with the next Uploader.Flush. T must be a valid vertex type, see VertexBinding.
+func NewVertexBuffer[T any](ctx context.Context, uploader *Uploader, vertices []T) (*VertexBuffer[T], error) {
+	if _, err := vertexAttributes(reflect.TypeFor[T]()); err != nil {
+		return nil, err
+	}
+	buffer, err := uploader.CreateBufferWithData(ctx, vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit), sliceBytes(vertices))
+	if err != nil {
+		return nil, err
+	}
+	return &VertexBuffer[T]{Buffer: buffer, Count: len(vertices)}, nil
+}
+
+// Update overwrites the vertices starting at first.
+func (vb *VertexBuffer[T]) Update(ctx context.Context, uploader *Uploader, first int, vertices []T) error {
+	if first < 0 || first+len(vertices) > vb.Count {
+		return fmt.Errorf("VertexBuffer.Update: vertices [%d, %d) out of %d", first, first+len(vertices), vb.Count)
+	}
+	offset := vk.DeviceSize(first) * vk.DeviceSize(unsafe.Sizeof(*new(T)))
+	return uploader.UploadBuffer(ctx, vb.Buffer, offset, sliceBytes(vertices))
+}
+
+// Binding describes the buffer as per-vertex data at binding.
+func (vb *VertexBuffer[T]) Binding(binding uint32) VertexBinding {
+	return PerVertex[T](binding)
+}
+
+// InstanceBinding describes the buffer as per-instance data at binding.
+func (vb *VertexBuffer[T]) InstanceBinding(binding uint32) VertexBinding {
+	return PerInstance[T](binding)
+}
+
+// sliceBytes returns the memory of a slice of plain values.
+func sliceBytes[T any](values []T) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	size := int(unsafe.Sizeof(values[0])) * len(values)
+	return unsafe.Slice((*byte)(unsafe.Pointer(&values[0])), size)
+}
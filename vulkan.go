@@ -1,8 +1,11 @@
 package asch
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 	"unsafe"
 
 	vk "github.com/tomas-mraz/vulkan"
@@ -10,13 +13,40 @@ import (
 
 var debug = false
 
+// frameTimeout limits DrawFrame when the context has no deadline.
+const frameTimeout = 10 * time.Second
+
 type Vulkan struct {
 	Device    vk.Device
 	Instance  vk.Instance
 	Surface   vk.Surface
 	GpuDevice vk.PhysicalDevice
-	Queue     vk.Queue
-	dbg       vk.DebugReportCallback
+	// Properties of GpuDevice, including its limits.
+	Properties vk.PhysicalDeviceProperties
+
+	// Queue is the graphics queue. Roles living in the same queue family
+	// share one *Queue, so e.g. Queue == PresentQueue on most devices.
+	Queue         *Queue
+	PresentQueue  *Queue
+	ComputeQueue  *Queue
+	TransferQueue *Queue
+	QueueFamilies QueueFamilyIndices
+
+	Features DeviceFeatures
+
+	// Allocator sub-allocates the memory of buffers and images.
+	Allocator *Allocator
+	// Samplers deduplicates the samplers of the device.
+	Samplers *SamplerCache
+	// DescriptorLayouts deduplicates the descriptor set layouts of the device.
+	DescriptorLayouts *DescriptorLayoutCache
+
+	// Deletions holds resources waiting for the GPU to finish with them. It is collected
+	// by DrawFrame as the VulkanRenderInfo.Deletions of the renderer, and flushed by
+	// DestroyInOrder once the device is idle, before the allocator is destroyed.
+	Deletions *DeletionQueue
+
+	dbg vk.DebugReportCallback
 }
 
 func SetDebug(state bool) {
@@ -98,7 +128,7 @@ func NewDevice(appName string, instanceExtensions []string, createSurfaceFunc fu
 
 	var appInfo = &vk.ApplicationInfo{
 		SType:              vk.StructureTypeApplicationInfo,
-		ApiVersion:         vk.MakeVersion(1, 0, 0),
+		ApiVersion:         vk.MakeVersion(1, 2, 0),
 		ApplicationVersion: vk.MakeVersion(1, 0, 0),
 		PApplicationName:   appName + "\x00",
 		PEngineName:        "no engine" + "\x00",
@@ -132,7 +162,15 @@ func NewDevice(appName string, instanceExtensions []string, createSurfaceFunc fu
 		PpEnabledLayerNames:     instanceLayers,
 	}
 	var vo Vulkan
-	err := vk.Error(vk.CreateInstance(&instanceCreateInfo, nil, &vo.Instance))
+	ret := vk.CreateInstance(&instanceCreateInfo, nil, &vo.Instance)
+	if ret == vk.ErrorIncompatibleDriver {
+		// Vulkan 1.0 loaders refuse any newer apiVersion
+		appInfo.Free()
+		instanceCreateInfo.Free()
+		appInfo.ApiVersion = vk.MakeVersion(1, 0, 0)
+		ret = vk.CreateInstance(&instanceCreateInfo, nil, &vo.Instance)
+	}
+	err := vk.Error(ret)
 	if err != nil {
 		err = fmt.Errorf("vk.CreateInstance failed with %s", err)
 		return vo, err
@@ -164,6 +202,10 @@ func NewDevice(appName string, instanceExtensions []string, createSurfaceFunc fu
 	}
 
 	vo.GpuDevice = gpuDevices[0] //FIXME select GPU device
+	vk.GetPhysicalDeviceProperties(vo.GpuDevice, &vo.Properties)
+	vo.Properties.Deref()
+	vo.Properties.Limits.Deref()
+	apiVersion := min(appInfo.ApiVersion, vo.Properties.ApiVersion)
 	existingExtensions = getDeviceExtensions(vo.GpuDevice)
 	slog.Debug(fmt.Sprintf("Device extensions: %v", existingExtensions))
 
@@ -177,14 +219,31 @@ func NewDevice(appName string, instanceExtensions []string, createSurfaceFunc fu
 		// "VK_LAYER_LUNARG_api_dump\x00",
 	}
 
-	queueCreateInfos := []vk.DeviceQueueCreateInfo{{
-		SType:            vk.StructureTypeDeviceQueueCreateInfo,
-		QueueCount:       1,
-		PQueuePriorities: []float32{1.0},
-	}}
+	vo.QueueFamilies, err = findQueueFamilies(vo.GpuDevice, vo.Surface)
+	if err != nil {
+		vk.DestroySurface(vo.Instance, vo.Surface, nil)
+		vk.DestroyInstance(vo.Instance, nil)
+		return vo, err
+	}
+	slog.Debug(fmt.Sprintf("Queue families: %+v", vo.QueueFamilies))
+
+	var queueCreateInfos []vk.DeviceQueueCreateInfo
+	for _, family := range vo.QueueFamilies.unique() {
+		queueCreateInfos = append(queueCreateInfos, vk.DeviceQueueCreateInfo{
+			SType:            vk.StructureTypeDeviceQueueCreateInfo,
+			QueueFamilyIndex: family,
+			QueueCount:       1,
+			PQueuePriorities: []float32{1.0},
+		})
+	}
 	deviceExtensions := []string{
 		"VK_KHR_swapchain\x00",
 	}
+	// the budget is read with vkGetPhysicalDeviceMemoryProperties2 of Vulkan 1.1
+	memoryBudget := apiVersion >= vk.MakeVersion(1, 1, 0) && slices.Contains(existingExtensions, vk.ExtMemoryBudgetExtensionName)
+	if memoryBudget {
+		deviceExtensions = append(deviceExtensions, vk.ExtMemoryBudgetExtensionName+"\x00")
+	}
 	deviceCreateInfo := vk.DeviceCreateInfo{
 		SType:                   vk.StructureTypeDeviceCreateInfo,
 		QueueCreateInfoCount:    uint32(len(queueCreateInfos)),
@@ -194,8 +253,8 @@ func NewDevice(appName string, instanceExtensions []string, createSurfaceFunc fu
 		EnabledLayerCount:       uint32(len(deviceLayers)),
 		PpEnabledLayerNames:     deviceLayers,
 	}
-	var device vk.Device // we choose the first GPU available for this device
-	err = vk.Error(vk.CreateDevice(vo.GpuDevice, &deviceCreateInfo, nil, &device))
+	// we choose the first GPU available for this device
+	device, features, err := createDevice(vo.GpuDevice, deviceCreateInfo, apiVersion)
 	if err != nil {
 		gpuDevices = nil
 		vk.DestroySurface(vo.Instance, vo.Surface, nil)
@@ -204,9 +263,35 @@ func NewDevice(appName string, instanceExtensions []string, createSurfaceFunc fu
 		return vo, err
 	} else {
 		vo.Device = device
-		var queue vk.Queue
-		vk.GetDeviceQueue(device, 0, 0, &queue)
-		vo.Queue = queue
+		vo.Deletions = NewDeletionQueue()
+		vo.Features = features
+		slog.Debug(fmt.Sprintf("Device features: %+v", vo.Features))
+		vo.Allocator, err = NewAllocator(device, vo.GpuDevice)
+		if err != nil {
+			vk.DestroyDevice(device, nil)
+			vk.DestroySurface(vo.Instance, vo.Surface, nil)
+			vk.DestroyInstance(vo.Instance, nil)
+			return vo, err
+		}
+		if vo.Features.BufferDeviceAddress {
+			vo.Allocator.EnableDeviceAddress()
+		}
+		if memoryBudget && !vo.Allocator.EnableMemoryBudget(vo.Instance) {
+			slog.Debug("VK_EXT_memory_budget is enabled but cannot be queried, the budget is estimated")
+		}
+		vo.Samplers = NewSamplerCache(&vo)
+		vo.DescriptorLayouts = NewDescriptorLayoutCache(device)
+		queues := make(map[uint32]*Queue)
+		queueFor := func(family uint32) *Queue {
+			if queues[family] == nil {
+				queues[family] = newQueue(device, family, 0)
+			}
+			return queues[family]
+		}
+		vo.Queue = queueFor(vo.QueueFamilies.Graphics)
+		vo.PresentQueue = queueFor(vo.QueueFamilies.Present)
+		vo.ComputeQueue = queueFor(vo.QueueFamilies.Compute)
+		vo.TransferQueue = queueFor(vo.QueueFamilies.Transfer)
 	}
 
 	if debug {
@@ -256,9 +341,11 @@ func VulkanStart(device vk.Device, swapchain *VulkanSwapchainInfo, r *VulkanRend
 
 		vk.CmdBeginRenderPass(r.cmdBuffers[i], &renderPassBeginInfo, vk.SubpassContentsInline)
 		vk.CmdBindPipeline(r.cmdBuffers[i], vk.PipelineBindPointGraphics, gfx.pipeline)
-		offsets := make([]vk.DeviceSize, len(b.vertexBuffers))
-		vk.CmdBindVertexBuffers(r.cmdBuffers[i], 0, 1, b.vertexBuffers, offsets)
-		vk.CmdDraw(r.cmdBuffers[i], 3, 1, 0, 0)
+		draw := Draw{
+			VertexBuffers: b.vertexBuffers,
+			Count:         b.vertexCount,
+		}
+		draw.Record(r.cmdBuffers[i])
 		vk.CmdEndRenderPass(r.cmdBuffers[i])
 
 		ret = vk.EndCommandBuffer(r.cmdBuffers[i])
@@ -278,23 +365,25 @@ func VulkanStart(device vk.Device, swapchain *VulkanSwapchainInfo, r *VulkanRend
 	check(ret, "vk.CreateSemaphore")
 }
 
-func DrawFrame(device vk.Device, queue vk.Queue, s VulkanSwapchainInfo, r VulkanRenderInfo) bool {
-	var nextIdx uint32
-	var err error
+// DrawFrame submits the pre-recorded command buffer of the next swapchain image on queue and
+// presents it on presentQueue, usually Vulkan.Queue and Vulkan.PresentQueue.
+// All waits honour the context; without a deadline a frame may take at most frameTimeout.
+func DrawFrame(ctx context.Context, device vk.Device, queue, presentQueue *Queue, s VulkanSwapchainInfo, r VulkanRenderInfo) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, frameTimeout)
+		defer cancel()
+	}
 
 	// Phase 1: vk.AcquireNextImage
 	// 			get the framebuffer index we should draw in
-	//
-	//			N.B. non-infinite timeouts may be not yet implemented
-	//			by your Vulkan driver
 
-	ret := vk.AcquireNextImage(device, s.DefaultSwapchain(), vk.MaxUint64, r.DefaultSemaphore(), vk.NullFence, &nextIdx)
-	if ret == vk.Suboptimal || ret == vk.ErrorOutOfDate {
-		slog.Warn("vk.AcquireNextImage returned Suboptimal or ErrorOutOfDate")
+	nextIdx, ret, err := AcquireNextImage(ctx, device, s.DefaultSwapchain(), r.DefaultSemaphore(), vk.NullFence)
+	if err != nil {
+		return err
 	}
-	if !(ret == vk.Success || ret == vk.Suboptimal) {
-		slog.Error(vk.Error(ret).Error())
-		return false
+	if ret == vk.Suboptimal {
+		slog.Warn("vk.AcquireNextImage returned Suboptimal")
 	}
 
 	// Phase 2: vk.QueueSubmit
@@ -312,20 +401,15 @@ func DrawFrame(device vk.Device, queue vk.Queue, s VulkanSwapchainInfo, r Vulkan
 		//SignalSemaphoreCount: 1,
 		//PSignalSemaphores:    r.DefaultSemaphore(),
 	}}
-	err = vk.Error(vk.QueueSubmit(queue, 1, submitInfo, r.DefaultFence()))
+	err = queue.Submit(r.DefaultFence(), submitInfo...)
 	if err != nil {
-		err = fmt.Errorf("vk.QueueSubmit failed with %s", err)
-		slog.Warn(err.Error())
-		return false
+		return err
 	}
-
-	const timeoutNano = 10 * 1000 * 1000 * 1000 // 10 sec
-	err = vk.Error(vk.WaitForFences(device, 1, r.fences, vk.True, timeoutNano))
+	err = WaitForFences(ctx, device, r.fences, true)
 	if err != nil {
-		err = fmt.Errorf("vk.WaitForFences failed with %s", err)
-		slog.Warn(err.Error())
-		return false
+		return err
 	}
+	r.completeFrame()
 
 	// Phase 3: vk.QueuePresent
 
@@ -336,19 +420,30 @@ func DrawFrame(device vk.Device, queue vk.Queue, s VulkanSwapchainInfo, r Vulkan
 		PSwapchains:    s.Swapchains,
 		PImageIndices:  imageIndices,
 	}
-	ret2 := vk.QueuePresent(queue, &presentInfo)
-	if ret2 == vk.Suboptimal || ret2 == vk.ErrorOutOfDate {
-		slog.Error("vk.QueuePresent returned Suboptimal or ErrorOutOfDate")
-	}
-	if ret2 != vk.Success {
-		slog.Error(vk.Error(ret2).Error())
-		return false
+	ret = presentQueue.Present(&presentInfo)
+	switch ret {
+	case vk.Success:
+		return nil
+	case vk.Suboptimal:
+		slog.Warn("vk.QueuePresent returned Suboptimal")
+		return nil
+	case vk.ErrorOutOfDate:
+		return fmt.Errorf("vk.QueuePresent: %w", ErrSwapchainOutOfDate)
+	default:
+		return fmt.Errorf("vk.QueuePresent failed with %s", vk.Error(ret))
 	}
-	return true
 }
 
 func DestroyInOrder(v *Vulkan, swapchain *VulkanSwapchainInfo, r *VulkanRenderInfo, buffer *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) {
 
+	// nothing may be in use by the GPU from here on
+	if err := vk.Error(vk.DeviceWaitIdle(v.Device)); err != nil {
+		slog.Warn(fmt.Sprintf("vk.DeviceWaitIdle failed with %s", err))
+	}
+	if r.Deletions != nil && r.Deletions != v.Deletions {
+		r.Deletions.Flush()
+	}
+
 	vk.FreeCommandBuffers(v.Device, r.cmdPool, uint32(len(r.cmdBuffers)), r.cmdBuffers)
 	r.cmdBuffers = nil
 
@@ -356,11 +451,22 @@ func DestroyInOrder(v *Vulkan, swapchain *VulkanSwapchainInfo, r *VulkanRenderIn
 	vk.DestroyRenderPass(v.Device, r.RenderPass, nil)
 	vk.DestroySemaphore(v.Device, r.DefaultSemaphore(), nil)
 	vk.DestroyFence(v.Device, r.DefaultFence(), nil)
-	vk.FreeMemory(v.Device, buffer.getDeviceMemory(), nil)
 
 	swapchain.Destroy()
 	gfx.Destroy()
 	buffer.Destroy()
+	if v.Deletions != nil {
+		v.Deletions.Flush()
+	}
+	if v.Samplers != nil {
+		v.Samplers.Destroy()
+	}
+	if v.DescriptorLayouts != nil {
+		v.DescriptorLayouts.Destroy()
+	}
+	if v.Allocator != nil {
+		v.Allocator.Destroy()
+	}
 
 	vk.DestroyDevice(v.Device, nil)
 	if v.dbg != vk.NullDebugReportCallback {
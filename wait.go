@@ -0,0 +1,103 @@
+package asch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	vk "github.com/tomas-mraz/vulkan"
+)
+
+var (
+	// ErrTimeout is returned when a GPU wait runs past the context deadline.
+	ErrTimeout = errors.New("asch: gpu wait timed out")
+	// ErrSwapchainOutOfDate is returned when the swapchain no longer matches the surface.
+	ErrSwapchainOutOfDate = errors.New("asch: swapchain out of date")
+)
+
+// waitSlice bounds every single driver wait, so that cancellation
+// and deadlines are noticed while the GPU is still busy.
+const waitSlice = 100 * time.Millisecond
+
+// waitError describes why a wait stopped early. Deadlines are reported as ErrTimeout,
+// both ErrTimeout and context.DeadlineExceeded match the returned error.
+func waitError(ctx context.Context, name string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w: %w", name, ErrTimeout, ctx.Err())
+	}
+	return fmt.Errorf("%s: %w", name, ctx.Err())
+}
+
+// sliceTimeout returns the timeout in nanoseconds for the next driver wait.
+func sliceTimeout(ctx context.Context) uint64 {
+	timeout := waitSlice
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, max(time.Until(deadline), 0))
+	}
+	return uint64(timeout.Nanoseconds())
+}
+
+// WaitForFences waits until all fences (or any of them) are signalled or the context is done.
+func WaitForFences(ctx context.Context, device vk.Device, fences []vk.Fence, waitAll bool) error {
+	all := vk.Bool32(vk.False)
+	if waitAll {
+		all = vk.True
+	}
+	for {
+		if ctx.Err() != nil {
+			return waitError(ctx, "vk.WaitForFences")
+		}
+		ret := vk.WaitForFences(device, uint32(len(fences)), fences, all, sliceTimeout(ctx))
+		if ret == vk.Timeout {
+			continue
+		}
+		if err := vk.Error(ret); err != nil {
+			return fmt.Errorf("vk.WaitForFences failed with %s", err)
+		}
+		return nil
+	}
+}
+
+// AcquireNextImage acquires the next swapchain image, retrying with bounded timeouts
+// until the context is done. vk.Suboptimal is returned as the result with a nil error,
+// vk.ErrorOutOfDate comes back as ErrSwapchainOutOfDate.
+func AcquireNextImage(ctx context.Context, device vk.Device, swapchain vk.Swapchain, semaphore vk.Semaphore, fence vk.Fence) (uint32, vk.Result, error) {
+	var imageIndex uint32
+	for {
+		if ctx.Err() != nil {
+			return 0, vk.Timeout, waitError(ctx, "vk.AcquireNextImage")
+		}
+		ret := vk.AcquireNextImage(device, swapchain, sliceTimeout(ctx), semaphore, fence, &imageIndex)
+		switch ret {
+		case vk.Success, vk.Suboptimal:
+			return imageIndex, ret, nil
+		case vk.Timeout, vk.NotReady:
+			continue
+		case vk.ErrorOutOfDate:
+			return 0, ret, fmt.Errorf("vk.AcquireNextImage: %w", ErrSwapchainOutOfDate)
+		default:
+			return 0, ret, fmt.Errorf("vk.AcquireNextImage failed with %s", vk.Error(ret))
+		}
+	}
+}
+
+// WaitIdle waits for the whole device to become idle. vkDeviceWaitIdle takes no timeout
+// and must not outlive the caller, who may destroy the device next, so the context is only
+// checked before the call.
+func (v *Vulkan) WaitIdle(ctx context.Context) error {
+	return waitBlocking(ctx, "vk.DeviceWaitIdle", func() error {
+		if err := vk.Error(vk.DeviceWaitIdle(v.Device)); err != nil {
+			return fmt.Errorf("vk.DeviceWaitIdle failed with %s", err)
+		}
+		return nil
+	})
+}
+
+// waitBlocking runs a driver call without timeout unless the context is already done.
+func waitBlocking(ctx context.Context, name string, call func() error) error {
+	if ctx.Err() != nil {
+		return waitError(ctx, name)
+	}
+	return call()
+}